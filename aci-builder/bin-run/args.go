@@ -12,22 +12,23 @@ import (
 )
 
 var cliDebugFlag bool
+var cliNetList rktcommon.NetList
+var cliLocalConfig string
 
 func init() {
 
 	var discardString string
 	var discardBool bool
-	var discardNetlist rktcommon.NetList
 
 	flag.BoolVar(&cliDebugFlag, "debug", false, "Run in debug mode")
 
 	// The following flags need to be supported by stage1 according to
 	// https://github.com/coreos/rkt/blob/master/Documentation/devel/stage1-implementors-guide.md
 	// TODO: either implement functionality or give not implemented warnings
-	flag.Var(&discardNetlist, "net", "Setup networking")
+	flag.Var(&cliNetList, "net", "Setup networking")
 	flag.BoolVar(&discardBool, "interactive", true, "The pod is interactive")
 	flag.StringVar(&discardString, "mds-token", "", "MDS auth token")
-	flag.StringVar(&discardString, "local-config", rktcommon.DefaultLocalConfigDir, "Local config path")
+	flag.StringVar(&cliLocalConfig, "local-config", rktcommon.DefaultLocalConfigDir, "Local config path")
 }
 
 func ProcessArgsAndReturnPodUUID() *types.UUID {
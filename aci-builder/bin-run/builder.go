@@ -1,13 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
@@ -28,8 +32,10 @@ type Builder struct {
 	aciHomePath   string
 	aciTargetPath string
 	upperId       string
+	stepLog       *common.StepLogWriter // nil when catching, shells need the terminal
 	pod           *stage1commontypes.Pod
 	fullManifest  *common.AciManifest // includes non-standard sections such as 'Builder'
+	tmpMounts     []string
 }
 
 func NewBuilder(podRoot string, podUUID *types.UUID) (*Builder, error) {
@@ -74,14 +80,26 @@ func (b *Builder) Build() error {
 		return errs.WithEF(err, b.fields, "can't set FD_CLOEXEC on rkt lock")
 	}
 
+	if err := b.startStepLog(); err != nil {
+		return err
+	}
+	defer b.stopStepLog()
+	defer b.unmountTmp()
+
 	if err := b.runBuild(); err != nil {
 		return err
 	}
 
+	if b.command() == common.CommandShell {
+		return nil
+	}
+
+	b.step(common.StepManifest)
 	if err := b.writeManifest(); err != nil {
 		return err
 	}
 
+	b.step(common.StepTar)
 	if err := b.tarAci(); err != nil {
 		return err
 	}
@@ -89,6 +107,48 @@ func (b *Builder) Build() error {
 	return nil
 }
 
+// startStepLog sends builder's output and logs to target/logs, one file per step
+func (b *Builder) startStepLog() error {
+	catchError, _ := manifestApp(b.pod).App.Environment.Get(common.EnvCatchOnError)
+	catchStep, _ := manifestApp(b.pod).App.Environment.Get(common.EnvCatchOnStep)
+	if catchError == "true" || catchStep == "true" || b.command() == common.CommandShell {
+		logs.WithF(b.fields).Debug("Interactive build, steps are not logged")
+		return nil
+	}
+
+	stepLog, err := common.NewStepLogWriter(b.aciTargetPath+common.PathLogs, common.StepStage1, os.Stdout)
+	if err != nil {
+		return errs.WithEF(err, b.fields, "Failed to prepare step logs")
+	}
+	b.stepLog = stepLog
+	logAppender().Out = stepLog
+	return nil
+}
+
+func (b *Builder) stopStepLog() {
+	if b.stepLog == nil {
+		return
+	}
+	logAppender().Out = os.Stdout
+	b.stepLog.Close()
+}
+
+func (b *Builder) step(step string) {
+	if b.stepLog == nil {
+		return
+	}
+	if err := b.stepLog.Step(step); err != nil {
+		logs.WithEF(err, b.fields.WithField("step", step)).Warn("Failed to switch step log")
+	}
+}
+
+func (b *Builder) output() io.Writer {
+	if b.stepLog == nil {
+		return os.Stdout
+	}
+	return b.stepLog
+}
+
 ////////////////////////////////////////////
 
 func (b *Builder) writeManifest() error {
@@ -113,6 +173,13 @@ func (b *Builder) writeManifest() error {
 	if err != nil {
 		return errs.WithEF(err, b.fields.WithField("content", string(content)), "Failed to process manifest template")
 	}
+	lock, err := common.ReadLockFile(b.aciTargetPath + common.PathAciManifestLock)
+	if err != nil {
+		return errs.WithEF(err, b.fields, "Failed to read lock file")
+	}
+	if lock != nil {
+		lock.Apply(aciManifest)
+	}
 	target := b.pod.Root + PATH_OVERLAY + "/" + upperId + PATH_UPPER + common.PathManifest
 
 	dgrVersion, ok := manifestApp(b.pod).App.Environment.Get(common.EnvDgrVersion)
@@ -163,7 +230,10 @@ func (b *Builder) tarAci() error {
 	params = append(params, "-cf", destination, common.PathManifest[1:], rootfsAlias)
 
 	logs.WithF(b.fields).Debug("Calling tar to collect all files")
-	if err := common.ExecCmd("tar", params...); err != nil {
+	cmd := exec.Command("tar", params...)
+	cmd.Stdout = b.output()
+	cmd.Stderr = b.output()
+	if err := cmd.Run(); err != nil {
 		logs.WithFields(b.fields).WithField("params", params).Error("Parameters to 'tar' within the builder")
 		return errs.WithEF(err, b.fields, "Failed to tar aci")
 	}
@@ -194,14 +264,101 @@ func (b *Builder) runBuild() error {
 	//	var stderr bytes.Buffer
 	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Env = env
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = b.output()
 	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = b.output()
 
-	if err := cmd.Run(); err != nil {
-		return errs.WithEF(err, b.fields, "Builder run failed")
+	var network *Network
+	if cliNetList.Contained() && !cliNetList.None() {
+		network, err = NewNetwork(b.pod.UUID.String(), &cliNetList, cliLocalConfig)
+		if err != nil {
+			return errs.WithEF(err, b.fields, "Failed to prepare builder network")
+		}
+		if err := network.Setup(); err != nil {
+			return errs.WithEF(err, b.fields, "Failed to setup builder network")
+		}
+		defer network.Teardown()
+	}
+
+	run := func(cmd *exec.Cmd) error {
+		if network != nil {
+			return network.Run(cmd)
+		}
+		return cmd.Run()
+	}
+
+	if b.command() != common.CommandBuild {
+		if err := run(cmd); err != nil {
+			return errs.WithEF(err, b.fields, "Builder run failed")
+		}
+		return nil
+	}
+	return b.runBuildSteps(cmd, run)
+}
+
+// runBuildSteps runs builder.sh once, or once per build step when the build is checkpointed after each step but the
+// last one, a failed checkpoint only stopping the following ones.
+func (b *Builder) runBuildSteps(cmd *exec.Cmd, run func(cmd *exec.Cmd) error) error {
+	var overlays []overlay
+	var err error
+	if checkpoint, _ := manifestApp(b.pod).App.Environment.Get(common.EnvBuilderCheckpoint); checkpoint == "true" {
+		if overlays, err = b.overlays(); err != nil {
+			logs.WithEF(err, b.fields).Warn("Build will not be checkpointed")
+		}
+	}
+	if overlays == nil {
+		if resume, _ := manifestApp(b.pod).App.Environment.Get(common.EnvBuilderResume); resume == "true" {
+			logs.WithF(b.fields).Warn("Build cannot be checkpointed, building from scratch")
+		}
+		if err := run(cmd); err != nil {
+			return errs.WithEF(err, b.fields, "Builder run failed")
+		}
+		return nil
+	}
+
+	manifestTmpl, err := ioutil.ReadFile(b.aciTargetPath + common.PathManifestYmlTmpl)
+	if err != nil {
+		return errs.WithEF(err, b.fields.WithField("file", b.aciTargetPath+common.PathManifestYmlTmpl), "Failed to read manifest template")
+	}
+	keys, err := common.BuildStepKeys(b.aciHomePath, b.aciTargetPath, string(manifestTmpl))
+	if err != nil {
+		return err
+	}
+	start, err := b.resume(keys, overlays)
+	if err != nil {
+		return err
+	}
+
+	checkpoints, _ := common.LoadCheckpoints(b.aciTargetPath + common.PathCheckpoints)
+	if len(checkpoints) > start {
+		checkpoints = checkpoints[:start]
 	}
+	for i := start; i < len(common.BuildSteps); i++ {
+		step := common.BuildSteps[i]
+		stepCmd := exec.Command(cmd.Path, append(append([]string{}, cmd.Args[1:len(cmd.Args)-1]...),
+			"--setenv="+common.EnvBuildStep+"="+string(step), cmd.Args[len(cmd.Args)-1])...)
+		stepCmd.Env = cmd.Env
+		stepCmd.Stdin = cmd.Stdin
+		stepCmd.Stdout = cmd.Stdout
+		stepCmd.Stderr = cmd.Stderr
 
+		if err := run(stepCmd); err != nil {
+			return errs.WithEF(err, b.fields.WithField("step", step), "Builder run failed")
+		}
+		if i == len(common.BuildSteps)-1 || overlays == nil {
+			continue
+		}
+		if err := b.checkpoint(step, overlays); err != nil {
+			logs.WithEF(err, b.fields).Warn("Build will not be checkpointed anymore")
+			overlays = nil
+			continue
+		}
+		checkpoints = append(checkpoints, common.Checkpoint{Step: step, Key: keys[i]})
+		if err := checkpoints.Save(b.aciTargetPath + common.PathCheckpoints); err != nil {
+			logs.WithEF(err, b.fields).Warn("Build will not be checkpointed anymore")
+			overlays = nil
+		}
+	}
 	return nil
 }
 
@@ -209,7 +366,21 @@ func (b *Builder) prepareNspawnArgsAndEnv(commandPath string) ([]string, []strin
 	var args []string
 	env := os.Environ()
 
+	resources, err := b.builderResources()
+	if err != nil {
+		return args, env, err
+	}
+	scopeArgs, err := b.scopeArgs(resources)
+	if err != nil {
+		return args, env, err
+	}
+	args = append(args, scopeArgs...)
 	args = append(args, b.stage1Rootfs+"/dgr/usr/lib/ld-linux-x86-64.so.2")
+	if len(scopeArgs) > 0 { // systemd-run of the host must not load the libraries of stage1
+		args = append(args, "--library-path", b.stage1Rootfs+"/dgr/usr/lib")
+	} else {
+		env = append(env, "LD_LIBRARY_PATH="+b.stage1Rootfs+"/dgr/usr/lib")
+	}
 	args = append(args, b.stage1Rootfs+"/dgr/usr/bin/systemd-nspawn")
 	if context := os.Getenv(rktcommon.EnvSELinuxContext); context != "" {
 		args = append(args, fmt.Sprintf("-Z%s", context))
@@ -217,7 +388,6 @@ func (b *Builder) prepareNspawnArgsAndEnv(commandPath string) ([]string, []strin
 	args = append(args, "--register=no")
 	args = append(args, "-q")
 	args = append(args, "--link-journal=auto")
-	env = append(env, "LD_LIBRARY_PATH="+b.stage1Rootfs+"/dgr/usr/lib")
 	if !logs.IsDebugEnabled() {
 		args = append(args, "--quiet")
 	}
@@ -250,6 +420,9 @@ func (b *Builder) prepareNspawnArgsAndEnv(commandPath string) ([]string, []strin
 	catchStep, _ := manifestApp(b.pod).App.Environment.Get(common.EnvCatchOnStep)
 	args = append(args, "--setenv="+common.EnvCatchOnError+"="+string(catchError))
 	args = append(args, "--setenv="+common.EnvCatchOnStep+"="+string(catchStep))
+	if b.stepLog != nil {
+		args = append(args, "--setenv="+common.EnvStepMarker+"="+common.StepMarker)
+	}
 
 	version, ok := manifestApp(b.pod).Image.Labels.Get("version")
 	if ok {
@@ -259,6 +432,16 @@ func (b *Builder) prepareNspawnArgsAndEnv(commandPath string) ([]string, []strin
 	args = append(args, "--setenv=ACI_EXEC="+"'"+strings.Join(manifestApp(b.pod).App.Exec, "' '")+"'")
 	args = append(args, "--setenv=ROOTFS="+PATH_OPT+PATH_STAGE2+"/"+manifestApp(b.pod).Name.String()+common.PathRootfs)
 
+	if cliNetList.None() {
+		args = append(args, "--private-network")
+	}
+	if resources.TmpSize != "" {
+		tmpArgs, err := b.mountTmp(resources.TmpSize)
+		if err != nil {
+			return args, env, err
+		}
+		args = append(args, tmpArgs...)
+	}
 	args = append(args, "--capability=all")
 	args = append(args, "--directory="+b.stage1Rootfs)
 	args = append(args, "--bind="+b.aciHomePath+"/:/dgr/aci-home")
@@ -318,6 +501,83 @@ func (b *Builder) prepareNspawnArgsAndEnv(commandPath string) ([]string, []strin
 	return args, env, nil
 }
 
+func (b *Builder) builderResources() (common.BuilderResources, error) {
+	resources := common.BuilderResources{}
+	content, ok := manifestApp(b.pod).App.Environment.Get(common.EnvBuilderResources)
+	if !ok || content == "" {
+		return resources, nil
+	}
+	if err := json.Unmarshal([]byte(content), &resources); err != nil {
+		return resources, errs.WithEF(err, b.fields.WithField("content", content), "Failed to read builder resources")
+	}
+	logs.WithF(b.fields).WithField("resources", resources).Debug("Limiting builder resources")
+	return resources, nil
+}
+
+// scopeArgs runs nspawn in a transient systemd scope limiting its resources, as nspawn does not create one without
+// registering the machine. Build runlevels are run in nested nspawns inside this scope, so are limited too
+func (b *Builder) scopeArgs(resources common.BuilderResources) ([]string, error) {
+	var properties []string
+	if resources.Memory != "" {
+		properties = append(properties, "MemoryLimit="+resources.Memory)
+	}
+	if resources.CPUShares != 0 {
+		properties = append(properties, "CPUShares="+strconv.Itoa(resources.CPUShares))
+	}
+	if resources.CPUQuota != "" {
+		properties = append(properties, "CPUQuota="+resources.CPUQuota)
+	}
+	if resources.Pids != 0 {
+		properties = append(properties, "TasksMax="+strconv.Itoa(resources.Pids))
+	}
+	if len(properties) == 0 {
+		return nil, nil
+	}
+
+	systemdRun, err := exec.LookPath("systemd-run")
+	if err != nil {
+		return nil, errs.WithEF(err, b.fields, "systemd-run is required on the host to limit builder resources")
+	}
+	args := []string{systemdRun, "--scope", "--quiet"}
+	for _, property := range properties {
+		args = append(args, "--property="+property)
+	}
+	return append(args, "--"), nil
+}
+
+// mountTmp mounts the size limited /tmp of the builder and of the rootfs once, so they are kept between the nspawns
+// of build steps
+func (b *Builder) mountTmp(size string) ([]string, error) {
+	var args []string
+	targets := []string{PATH_TMP, PATH_OPT + PATH_STAGE2 + "/" + manifestApp(b.pod).Name.String() + common.PathRootfs + PATH_TMP}
+	for i, target := range targets {
+		dir := b.pod.Root + PATH_BUILDER_TMP + "/" + strconv.Itoa(i)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return args, errs.WithEF(err, b.fields.WithField("path", dir), "Failed to create tmp directory")
+		}
+		if err := syscall.Mount("tmpfs", dir, "tmpfs", 0, "mode=1777,size="+size); err != nil {
+			return args, errs.WithEF(err, b.fields.WithField("path", dir).WithField("size", size), "Failed to mount tmpfs")
+		}
+		b.tmpMounts = append(b.tmpMounts, dir)
+		args = append(args, "--bind="+dir+":"+target)
+	}
+	return args, nil
+}
+
+func (b *Builder) unmountTmp() {
+	for _, dir := range b.tmpMounts {
+		if err := syscall.Unmount(dir, syscall.MNT_DETACH); err != nil {
+			logs.WithEF(err, b.fields.WithField("path", dir)).Warn("Failed to unmount tmpfs")
+		}
+	}
+	b.tmpMounts = nil
+}
+
+func (b *Builder) command() common.BuilderCommand {
+	command, _ := manifestApp(b.pod).App.Environment.Get(common.EnvBuilderCommand)
+	return common.BuilderCommand(command)
+}
+
 func (b *Builder) getCommandPath() (string, error) {
 	command, ok := manifestApp(b.pod).App.Environment.Get(common.EnvBuilderCommand)
 	if !ok {
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/blablacar/dgr/dgr/common"
+	rktcommon "github.com/coreos/rkt/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const PATH_PROC_MOUNTS = "/proc/self/mounts"
+
+// overlay is a rootfs mounted by rkt whose upper directory holds everything written by the build
+type overlay struct {
+	name    string
+	target  string
+	upper   string
+	options string
+}
+
+// overlays are ordered from the outermost mount, stage2's rootfs being mounted inside stage1's one
+func (b *Builder) overlays() ([]overlay, error) {
+	stage1Id, err := ioutil.ReadFile(b.pod.Root + "/" + rktcommon.Stage1TreeStoreIDFilename)
+	if err != nil {
+		return nil, errs.WithEF(err, b.fields, "Failed to read stage1 treeStoreID")
+	}
+	stage2Id, err := b.upperTreeStoreId()
+	if err != nil {
+		return nil, err
+	}
+
+	overlays := []overlay{
+		{name: "stage1", target: b.stage1Rootfs, upper: b.pod.Root + PATH_OVERLAY + "/" + string(stage1Id) + PATH_UPPER},
+		{name: "stage2", target: b.stage2Rootfs, upper: b.pod.Root + PATH_OVERLAY + "/" + stage2Id + PATH_UPPER},
+	}
+	for i := range overlays {
+		options, err := overlayMountOptions(overlays[i].target)
+		if err != nil {
+			return nil, err
+		}
+		overlays[i].options = options
+	}
+	return overlays, nil
+}
+
+func overlayMountOptions(target string) (string, error) {
+	f, err := os.Open(PATH_PROC_MOUNTS)
+	if err != nil {
+		return "", errs.WithEF(err, data.WithField("file", PATH_PROC_MOUNTS), "Failed to read mounts")
+	}
+	defer f.Close()
+
+	options := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] != target || fields[2] != "overlay" {
+			continue
+		}
+		kept := []string{}
+		for _, option := range strings.Split(fields[3], ",") {
+			if strings.HasPrefix(option, "lowerdir=") || strings.HasPrefix(option, "upperdir=") || strings.HasPrefix(option, "workdir=") {
+				kept = append(kept, option)
+			}
+		}
+		options = strings.Join(kept, ",") // the last one is the visible one
+	}
+	if options == "" {
+		return "", errs.WithF(data.WithField("path", target), "Rootfs is not an overlay mount, cannot checkpoint build")
+	}
+	return options, nil
+}
+
+func (b *Builder) checkpointDir(step common.BuildStep) string {
+	return b.aciTargetPath + common.PathCheckpoints + "/" + string(step)
+}
+
+// checkpoint saves the upper directories of the overlays, whiteouts and opaque directories included
+func (b *Builder) checkpoint(step common.BuildStep, overlays []overlay) error {
+	fields := b.fields.WithField("step", step)
+	logs.WithF(fields).Info("Checkpointing build")
+
+	dir := b.checkpointDir(step)
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errs.WithEF(err, fields.WithField("path", dir), "Failed to create checkpoint directory")
+	}
+	for _, o := range overlays {
+		if err := b.runTar("--numeric-owner", "--xattrs", "--xattrs-include=trusted.*",
+			"-C", o.upper, "-cf", dir+"/"+o.name+".tar", "."); err != nil {
+			return errs.WithEF(err, fields.WithField("overlay", o.name), "Failed to checkpoint overlay")
+		}
+	}
+	return nil
+}
+
+// restore replaces the content of the overlays with the checkpoint of a step.
+// Overlays are unmounted during the restore since their upper directories cannot be changed while mounted.
+func (b *Builder) restore(step common.BuildStep, overlays []overlay) error {
+	fields := b.fields.WithField("step", step)
+	logs.WithF(fields).Info("Restoring build checkpoint")
+
+	for i := len(overlays) - 1; i >= 0; i-- {
+		if err := syscall.Unmount(overlays[i].target, 0); err != nil {
+			return errs.WithEF(err, fields.WithField("path", overlays[i].target), "Failed to unmount overlay")
+		}
+	}
+
+	for _, o := range overlays {
+		files, err := ioutil.ReadDir(o.upper)
+		if err != nil {
+			return errs.WithEF(err, fields.WithField("path", o.upper), "Failed to read overlay upper directory")
+		}
+		for _, f := range files {
+			if err := os.RemoveAll(o.upper + "/" + f.Name()); err != nil {
+				return errs.WithEF(err, fields.WithField("path", o.upper), "Failed to clean overlay upper directory")
+			}
+		}
+		if err := b.runTar("--numeric-owner", "--xattrs", "--xattrs-include=trusted.*", "-p",
+			"-C", o.upper, "-xf", b.checkpointDir(step)+"/"+o.name+".tar"); err != nil {
+			return errs.WithEF(err, fields.WithField("overlay", o.name), "Failed to restore overlay")
+		}
+	}
+
+	for _, o := range overlays {
+		if err := syscall.Mount("overlay", o.target, "overlay", 0, o.options); err != nil {
+			return errs.WithEF(err, fields.WithField("path", o.target), "Failed to mount overlay")
+		}
+	}
+	return nil
+}
+
+func (b *Builder) runTar(args ...string) error {
+	cmd := exec.Command("tar", args...)
+	cmd.Stdout = b.output()
+	cmd.Stderr = b.output()
+	return cmd.Run()
+}
+
+// resume restores the checkpoint preceding the first step to run and returns the index of this step
+func (b *Builder) resume(keys []string, overlays []overlay) (int, error) {
+	resume, _ := manifestApp(b.pod).App.Environment.Get(common.EnvBuilderResume)
+	if resume != "true" {
+		return 0, nil
+	}
+	checkpoints, err := common.LoadCheckpoints(b.aciTargetPath + common.PathCheckpoints)
+	if err != nil {
+		logs.WithEF(err, b.fields).Warn("Cannot read checkpoints, building from scratch")
+		return 0, nil
+	}
+	index := checkpoints.ResumeIndex(keys)
+	if index == len(keys) {
+		index-- // the last step is never checkpointed, it is the one producing the aci content
+	}
+	if index == 0 {
+		logs.WithF(b.fields).Info("No usable checkpoint, building from scratch")
+		return 0, nil
+	}
+	if err := b.restore(common.BuildSteps[index-1], overlays); err != nil {
+		return 0, errs.WithEF(err, b.fields, "Failed to restore checkpoint")
+	}
+	logs.WithF(b.fields.WithField("step", common.BuildSteps[index])).Info("Resuming build")
+	return index, nil
+}
@@ -9,3 +9,4 @@ const PATH_UPPER = "/upper"
 const PATH_STAGE2 = "/stage2"
 const PATH_ATTRIBUTES = "/attributes"
 const PATH_TMP = "/tmp"
+const PATH_BUILDER_TMP = "/builder-tmp"
@@ -8,8 +8,12 @@ import (
 	_ "github.com/n0rad/go-erlog/register"
 )
 
+func logAppender() *erlog.ErlogWriterAppender {
+	return logs.GetDefaultLog().(*erlog.ErlogLogger).Appenders[0].(*erlog.ErlogWriterAppender)
+}
+
 func main() {
-	logs.GetDefaultLog().(*erlog.ErlogLogger).Appenders[0].(*erlog.ErlogWriterAppender).Out = os.Stdout
+	logAppender().Out = os.Stdout
 
 	uuid := ProcessArgsAndReturnPodUUID()
 
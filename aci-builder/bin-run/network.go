@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/containernetworking/cni/pkg/invoke"
+	"github.com/containernetworking/cni/pkg/types"
+	rktcommon "github.com/coreos/rkt/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const PATH_NETNS = "/var/run/netns"
+const PATH_NET_D = "/net.d"
+
+const defaultNetName = "default"
+const defaultNetConf = `{
+  "name": "default",
+  "type": "ptp",
+  "ipMasq": true,
+  "ipam": {
+    "type": "host-local",
+    "subnet": "172.16.28.0/24",
+    "routes": [{"dst": "0.0.0.0/0"}]
+  }
+}`
+
+var defaultCniPaths = []string{"/usr/lib/rkt/plugins/net", "/usr/lib/cni", "/opt/cni/bin"}
+
+type attachedNet struct {
+	name   string
+	args   string
+	conf   []byte
+	plugin string
+	ifName string
+}
+
+// Network is a private network namespace for the builder, attached to the requested CNI networks
+type Network struct {
+	fields      data.Fields
+	podUUID     string
+	nsPath      string
+	cniPaths    []string
+	attachments []attachedNet
+}
+
+func NewNetwork(podUUID string, netList *rktcommon.NetList, localConfig string) (*Network, error) {
+	n := &Network{
+		fields:   data.WithField("networks", netList.Strings()),
+		podUUID:  podUUID,
+		nsPath:   PATH_NETNS + "/dgr-" + podUUID,
+		cniPaths: defaultCniPaths,
+	}
+	if cniPath := os.Getenv("CNI_PATH"); cniPath != "" {
+		n.cniPaths = filepath.SplitList(cniPath)
+	}
+
+	confs, err := loadNetConfs(localConfig + PATH_NET_D)
+	if err != nil {
+		return nil, errs.WithEF(err, n.fields, "Failed to load network configurations")
+	}
+
+	names := netList.StringsOnlyNames()
+	if netList.All() {
+		names = []string{}
+		for name := range confs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	for i, name := range names {
+		conf, ok := confs[name]
+		if !ok {
+			if name != defaultNetName {
+				return nil, errs.WithF(n.fields.WithField("network", name).WithField("path", localConfig+PATH_NET_D),
+					"Network configuration not found")
+			}
+			conf = []byte(defaultNetConf)
+		}
+
+		netConf := types.NetConf{}
+		if err := json.Unmarshal(conf, &netConf); err != nil {
+			return nil, errs.WithEF(err, n.fields.WithField("network", name), "Failed to read network configuration")
+		}
+		plugin, err := invoke.FindInPath(netConf.Type, n.cniPaths)
+		if err != nil {
+			return nil, errs.WithEF(err, n.fields.WithField("network", name), "Cannot find network plugin")
+		}
+		n.attachments = append(n.attachments, attachedNet{
+			name:   name,
+			args:   netList.SpecificArgs(name),
+			conf:   conf,
+			plugin: plugin,
+			ifName: "eth" + strconv.Itoa(i),
+		})
+	}
+	return n, nil
+}
+
+func loadNetConfs(dir string) (map[string][]byte, error) {
+	confs := make(map[string][]byte)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return confs, nil
+		}
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".conf") {
+			continue
+		}
+		content, err := ioutil.ReadFile(dir + "/" + f.Name())
+		if err != nil {
+			return nil, errs.WithEF(err, data.WithField("file", dir+"/"+f.Name()), "Failed to read network configuration")
+		}
+		netConf := types.NetConf{}
+		if err := json.Unmarshal(content, &netConf); err != nil {
+			return nil, errs.WithEF(err, data.WithField("file", dir+"/"+f.Name()), "Invalid network configuration")
+		}
+		if _, ok := confs[netConf.Name]; !ok {
+			confs[netConf.Name] = content
+		}
+	}
+	return confs, nil
+}
+
+func (n *Network) Setup() error {
+	logs.WithF(n.fields).Debug("Creating builder network namespace")
+	if err := n.createNamespace(); err != nil {
+		return err
+	}
+
+	for _, att := range n.attachments {
+		logs.WithF(n.fields.WithField("network", att.name)).Debug("Attaching builder to network")
+		res, err := invoke.ExecPluginWithResult(att.plugin, att.conf, n.pluginArgs("ADD", att))
+		if err != nil {
+			n.Teardown()
+			return errs.WithEF(err, n.fields.WithField("network", att.name), "Failed to attach builder to network")
+		}
+		logs.WithF(n.fields.WithField("network", att.name).WithField("result", res.String())).Debug("Builder attached to network")
+	}
+	return nil
+}
+
+func (n *Network) Teardown() {
+	for i := len(n.attachments) - 1; i >= 0; i-- {
+		att := n.attachments[i]
+		if err := invoke.ExecPluginWithoutResult(att.plugin, att.conf, n.pluginArgs("DEL", att)); err != nil {
+			logs.WithEF(err, n.fields.WithField("network", att.name)).Warn("Failed to detach builder from network")
+		}
+	}
+	if err := syscall.Unmount(n.nsPath, 0); err != nil {
+		logs.WithEF(err, n.fields.WithField("path", n.nsPath)).Warn("Failed to unmount network namespace")
+	}
+	if err := os.Remove(n.nsPath); err != nil {
+		logs.WithEF(err, n.fields.WithField("path", n.nsPath)).Warn("Failed to remove network namespace")
+	}
+}
+
+// Run starts the command inside the network namespace and waits for it
+func (n *Network) Run(cmd *exec.Cmd) error {
+	errChan := make(chan error)
+	go func() {
+		// the thread is left locked so that it's destroyed with the goroutine instead of returning to the pool in another namespace
+		runtime.LockOSThread()
+		if err := n.enterNamespace(); err != nil {
+			errChan <- err
+			return
+		}
+		errChan <- cmd.Run()
+	}()
+	return <-errChan
+}
+
+func (n *Network) pluginArgs(command string, att attachedNet) *invoke.Args {
+	return &invoke.Args{
+		Command:       command,
+		ContainerID:   n.podUUID,
+		NetNS:         n.nsPath,
+		PluginArgsStr: att.args,
+		IfName:        att.ifName,
+		Path:          strings.Join(n.cniPaths, ":"),
+	}
+}
+
+func (n *Network) createNamespace() error {
+	if err := os.MkdirAll(PATH_NETNS, 0755); err != nil {
+		return errs.WithEF(err, n.fields.WithField("path", PATH_NETNS), "Failed to create network namespaces directory")
+	}
+	f, err := os.Create(n.nsPath)
+	if err != nil {
+		return errs.WithEF(err, n.fields.WithField("path", n.nsPath), "Failed to create network namespace file")
+	}
+	f.Close()
+
+	errChan := make(chan error)
+	go func() {
+		runtime.LockOSThread()
+		if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+			errChan <- errs.WithEF(err, n.fields, "Failed to unshare network namespace")
+			return
+		}
+		threadNs := fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid())
+		if err := syscall.Mount(threadNs, n.nsPath, "none", syscall.MS_BIND, ""); err != nil {
+			errChan <- errs.WithEF(err, n.fields.WithField("path", n.nsPath), "Failed to bind mount network namespace")
+			return
+		}
+		errChan <- nil
+	}()
+
+	if err := <-errChan; err != nil {
+		os.Remove(n.nsPath)
+		return err
+	}
+	return nil
+}
+
+func (n *Network) enterNamespace() error {
+	f, err := os.Open(n.nsPath)
+	if err != nil {
+		return errs.WithEF(err, n.fields.WithField("path", n.nsPath), "Failed to open network namespace")
+	}
+	defer f.Close()
+	if _, _, errno := syscall.RawSyscall(sysSetns, f.Fd(), syscall.CLONE_NEWNET, 0); errno != 0 {
+		return errs.WithEF(errno, n.fields.WithField("path", n.nsPath), "Failed to enter network namespace")
+	}
+	return nil
+}
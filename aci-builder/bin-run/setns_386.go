@@ -0,0 +1,4 @@
+package main
+
+// setns(2), not exposed by the syscall package on 386
+const sysSetns = 346
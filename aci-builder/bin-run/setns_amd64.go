@@ -0,0 +1,4 @@
+package main
+
+// setns(2), not exposed by the syscall package on amd64
+const sysSetns = 308
@@ -11,6 +11,8 @@ onError() {
     exit 1
 }
 
+dgr_step "stage1"
+
 export SYSTEMD_LOG_LEVEL=err
 export ROOTFS="/opt/stage2/${ACI_NAME}/rootfs"
 chmod 755 /opt/stage2 && chmod 755 /opt/stage2/${ACI_NAME} # this is required as soon as you run builder action as non root
@@ -50,94 +52,173 @@ chmod 777 ${ROOTFS}/dgr/attributes
 # save envs
 export | grep -v -E " SHLV=| ROOTFS=| TARGET= | ACI_PATH= | ACI_HOME= | ACI_EXEC=" > /dgr/builder/export
 
-# inherit build
-execute_files "/dgr/runlevels/inherit-build-early" || onError "Inherit-build-early"
+# Steps are run one by one by the stage1 that checkpoints the overlays after each of them,
+# they must only depend on what previous steps left in the filesystem
+step_inherit_build_early() {
+    execute_files "/dgr/runlevels/inherit-build-early" || onError "Inherit-build-early"
+}
 
-# builder runlevel
-execute_files "${ACI_HOME}/runlevels/builder" || onError "Builder"
-if [ "$(ls -A "${ACI_HOME}/runlevels/builder" 2> /dev/null)" ] && [ "${CATCH_ON_STEP}" == "true" ]; then
-    echo_purple "Catch requested dropping to shell after builder"
-    sh
-fi
+step_builder() {
+    execute_files "${ACI_HOME}/runlevels/builder" || onError "Builder"
+    if [ "$(ls -A "${ACI_HOME}/runlevels/builder" 2> /dev/null)" ] && [ "${CATCH_ON_STEP}" == "true" ]; then
+        echo_purple "Catch requested dropping to shell after builder"
+        sh
+    fi
+}
 
-# copy internals
-mkdir -p ${ROOTFS}/dgr/bin
-cmp -s /dgr/bin/busybox ${ROOTFS}/dgr/bin/busybox || cp /dgr/bin/busybox ${ROOTFS}/dgr/bin/busybox
-cmp -s /dgr/bin/functions.sh ${ROOTFS}/dgr/bin/functions.sh || cp /dgr/bin/functions.sh ${ROOTFS}/dgr/bin/functions.sh
-cmp -s /dgr/bin/prestart ${ROOTFS}/dgr/bin/prestart || cp /dgr/bin/prestart ${ROOTFS}/dgr/bin/prestart
-cmp -s /dgr/bin/templater ${ROOTFS}/dgr/bin/templater || cp /dgr/bin/templater ${ROOTFS}/dgr/bin/templater
+copy_internals() {
+    mkdir -p ${ROOTFS}/dgr/bin
+    cmp -s /dgr/bin/busybox ${ROOTFS}/dgr/bin/busybox || cp /dgr/bin/busybox ${ROOTFS}/dgr/bin/busybox
+    cmp -s /dgr/bin/functions.sh ${ROOTFS}/dgr/bin/functions.sh || cp /dgr/bin/functions.sh ${ROOTFS}/dgr/bin/functions.sh
+    cmp -s /dgr/bin/prestart ${ROOTFS}/dgr/bin/prestart || cp /dgr/bin/prestart ${ROOTFS}/dgr/bin/prestart
+    cmp -s /dgr/bin/templater ${ROOTFS}/dgr/bin/templater || cp /dgr/bin/templater ${ROOTFS}/dgr/bin/templater
 
-mkdir -p ${ROOTFS}/usr/bin # this is required by the systemd-nspawn
+    mkdir -p ${ROOTFS}/usr/bin # this is required by the systemd-nspawn
+}
 
-# inherit
-if [ -d ${ACI_HOME}/runlevels/inherit-build-early ]; then
-    mkdir -p ${ROOTFS}/dgr/runlevels/inherit-build-early
-    chmod 777 ${ROOTFS}/dgr/runlevels/inherit-build-early
-    cp -Rf ${ACI_HOME}/runlevels/inherit-build-early/. ${ROOTFS}/dgr/runlevels/inherit-build-early
-fi
-if [ -d ${ACI_HOME}/runlevels/inherit-build-late ]; then
-    mkdir -p ${ROOTFS}/dgr/runlevels/inherit-build-late
-    chmod 777 ${ROOTFS}/dgr/runlevels/inherit-build-late
-    cp -Rf ${ACI_HOME}/runlevels/inherit-build-late/. ${ROOTFS}/dgr/runlevels/inherit-build-late
-fi
+rootfs_nspawn() {
+    LD_LIBRARY_PATH=/dgr/usr/lib /dgr/usr/lib/ld-linux-x86-64.so.2 /dgr/usr/bin/systemd-nspawn \
+        --register=no -q --directory=${ROOTFS} --capability=all \
+        --bind=/dgr/builder:/dgr/builder --bind=${ACI_HOME}:/dgr/aci-home "$@"
+}
 
-if [ -d ${ACI_HOME}/runlevels/build ]; then
-    cp -Rf ${ACI_HOME}/runlevels/build /dgr/builder/runlevels
-fi
-if [ -d ${ACI_HOME}/runlevels/build-late ]; then
-    cp -Rf ${ACI_HOME}/runlevels/build-late /dgr/builder/runlevels
-fi
+step_build() {
+    copy_internals
 
-# build runlevel
-if [ -d ${ACI_HOME}/runlevels/build ] || [ -d ${ACI_HOME}/runlevels/build-late ] || [ -d ${ROOTFS}/dgr/runlevels/inherit-build-early ]; then
+    # inherit
+    if [ -d ${ACI_HOME}/runlevels/inherit-build-early ]; then
+        mkdir -p ${ROOTFS}/dgr/runlevels/inherit-build-early
+        chmod 777 ${ROOTFS}/dgr/runlevels/inherit-build-early
+        cp -Rf ${ACI_HOME}/runlevels/inherit-build-early/. ${ROOTFS}/dgr/runlevels/inherit-build-early
+    fi
+    if [ -d ${ACI_HOME}/runlevels/inherit-build-late ]; then
+        mkdir -p ${ROOTFS}/dgr/runlevels/inherit-build-late
+        chmod 777 ${ROOTFS}/dgr/runlevels/inherit-build-late
+        cp -Rf ${ACI_HOME}/runlevels/inherit-build-late/. ${ROOTFS}/dgr/runlevels/inherit-build-late
+    fi
 
-    LD_LIBRARY_PATH=/dgr/usr/lib /dgr/usr/lib/ld-linux-x86-64.so.2 /dgr/usr/bin/systemd-nspawn \
-        --register=no -q --directory=${ROOTFS} --capability=all \
-        --bind=/dgr/builder:/dgr/builder dgr/builder/stage2/step-build.sh || onError "Build"
-fi
+    # build runlevel
+    if [ -d ${ACI_HOME}/runlevels/build ]; then
+        cp -Rf ${ACI_HOME}/runlevels/build /dgr/builder/runlevels
+    fi
+    if [ -d ${ACI_HOME}/runlevels/build ] || [ -d ${ACI_HOME}/runlevels/build-late ] || [ -d ${ROOTFS}/dgr/runlevels/inherit-build-early ]; then
+        LD_LIBRARY_PATH=/dgr/usr/lib /dgr/usr/lib/ld-linux-x86-64.so.2 /dgr/usr/bin/systemd-nspawn \
+            --register=no -q --directory=${ROOTFS} --capability=all \
+            --bind=/dgr/builder:/dgr/builder dgr/builder/stage2/step-build.sh || onError "Build"
+        dgr_step "stage1"
+    fi
+}
 
-# prestart
-if [ "$(ls -A ${ACI_HOME}/runlevels/prestart-early 2> /dev/null)" ]; then
-    mkdir -p ${ROOTFS}/dgr/runlevels/prestart-early
-    chmod 777 ${ROOTFS}/dgr/runlevels/prestart-early
-    cp -Rf ${ACI_HOME}/runlevels/prestart-early/. ${ROOTFS}/dgr/runlevels/prestart-early
-fi
-if [ "$(ls -A ${ACI_HOME}/runlevels/prestart-late 2> /dev/null)" ]; then
-    mkdir -p ${ROOTFS}/dgr/runlevels/prestart-late
-    chmod 777 ${ROOTFS}/dgr/runlevels/prestart-late
-    cp -Rf ${ACI_HOME}/runlevels/prestart-late/. ${ROOTFS}/dgr/runlevels/prestart-late
-fi
+step_files() {
+    # prestart
+    if [ "$(ls -A ${ACI_HOME}/runlevels/prestart-early 2> /dev/null)" ]; then
+        mkdir -p ${ROOTFS}/dgr/runlevels/prestart-early
+        chmod 777 ${ROOTFS}/dgr/runlevels/prestart-early
+        cp -Rf ${ACI_HOME}/runlevels/prestart-early/. ${ROOTFS}/dgr/runlevels/prestart-early
+    fi
+    if [ "$(ls -A ${ACI_HOME}/runlevels/prestart-late 2> /dev/null)" ]; then
+        mkdir -p ${ROOTFS}/dgr/runlevels/prestart-late
+        chmod 777 ${ROOTFS}/dgr/runlevels/prestart-late
+        cp -Rf ${ACI_HOME}/runlevels/prestart-late/. ${ROOTFS}/dgr/runlevels/prestart-late
+    fi
 
-# attributes
-if [ "$(ls -A ${ACI_HOME}/attributes 2> /dev/null)" ]; then
-    mkdir -p ${ROOTFS}/dgr/attributes/${ACI_NAME}
-    find ${ACI_HOME}/attributes \( -name "*.yml" -o -name "*.yaml" \) -exec cp {} ${ROOTFS}/dgr/attributes/${ACI_NAME} \;
-fi
+    # attributes
+    if [ "$(ls -A ${ACI_HOME}/attributes 2> /dev/null)" ]; then
+        mkdir -p ${ROOTFS}/dgr/attributes/${ACI_NAME}
+        find ${ACI_HOME}/attributes \( -name "*.yml" -o -name "*.yaml" \) -exec cp {} ${ROOTFS}/dgr/attributes/${ACI_NAME} \;
+    fi
 
-# files
-if [ -d ${ACI_HOME}/files ]; then
-    cp -Rf ${ACI_HOME}/files/. ${ROOTFS}
-fi
+    # files
+    if [ -d ${ACI_HOME}/files ]; then
+        cp -Rf ${ACI_HOME}/files/. ${ROOTFS}
+    fi
 
-# templates
-if [ "$(ls -A ${ACI_HOME}/templates 2> /dev/null)"  ]; then
-    mkdir -p ${ROOTFS}/dgr/templates
-    cp -Rf ${ACI_HOME}/templates/. ${ROOTFS}/dgr/templates
-fi
+    # templates
+    if [ "$(ls -A ${ACI_HOME}/templates 2> /dev/null)"  ]; then
+        mkdir -p ${ROOTFS}/dgr/templates
+        cp -Rf ${ACI_HOME}/templates/. ${ROOTFS}/dgr/templates
+    fi
+}
 
-# build-late runlevel
-if [ -d ${ACI_HOME}/runlevels/build ] || [ -d ${ACI_HOME}/runlevels/build-late ] || [ -d ${ROOTFS}/dgr/runlevels/inherit-build-late ]; then
-    LD_LIBRARY_PATH=/dgr/usr/lib /dgr/usr/lib/ld-linux-x86-64.so.2 /dgr/usr/bin/systemd-nspawn \
-        --register=no -q --directory=${ROOTFS} --capability=all \
-        --bind=/dgr/builder:/dgr/builder dgr/builder/stage2/step-build-late.sh || onError "Build-late"
-fi
+step_build_late() {
+    # build-late runlevel
+    if [ -d ${ACI_HOME}/runlevels/build-late ]; then
+        cp -Rf ${ACI_HOME}/runlevels/build-late /dgr/builder/runlevels
+    fi
+    if [ -d ${ACI_HOME}/runlevels/build ] || [ -d ${ACI_HOME}/runlevels/build-late ] || [ -d ${ROOTFS}/dgr/runlevels/inherit-build-late ]; then
+        LD_LIBRARY_PATH=/dgr/usr/lib /dgr/usr/lib/ld-linux-x86-64.so.2 /dgr/usr/bin/systemd-nspawn \
+            --register=no -q --directory=${ROOTFS} --capability=all \
+            --bind=/dgr/builder:/dgr/builder dgr/builder/stage2/step-build-late.sh || onError "Build-late"
+        dgr_step "stage1"
+    fi
 
-# inherit build
-execute_files "/dgr/runlevels/inherit-build-late" || onError "Inherit-build-late"
+    # inherit build
+    execute_files "/dgr/runlevels/inherit-build-late" || onError "Inherit-build-late"
 
-rmdir ${ROOTFS}/dgr/builder >/dev/null 2>&1 || true
+    rmdir ${ROOTFS}/dgr/builder >/dev/null 2>&1 || true
 
-if [ "${CATCH_ON_STEP}" == "true" ]; then
-    echo_purple "Catch requested dropping to shell at end of build"
-    sh
-fi
+    if [ "${CATCH_ON_STEP}" == "true" ]; then
+        echo_purple "Catch requested dropping to shell at end of build"
+        sh
+    fi
+}
+
+run_runlevel() {
+    case "${1}" in
+        "inherit-build-early"|"inherit-build-late")
+            execute_files "/dgr/runlevels/${1}"
+            ;;
+        "builder")
+            execute_files "${ACI_HOME}/runlevels/builder"
+            ;;
+        "build"|"build-late")
+            rm -Rf /dgr/builder/runlevels/${1}
+            if [ -d ${ACI_HOME}/runlevels/${1} ]; then
+                cp -Rf ${ACI_HOME}/runlevels/${1} /dgr/builder/runlevels
+            fi
+            rootfs_nspawn dgr/builder/stage2/step-runlevel.sh "${1}"
+            ;;
+        *)
+            echo_red "Unknown runlevel '${1}'"
+            return 1
+            ;;
+    esac
+}
+
+# same environment as a build, without running runlevels unless one is requested
+step_shell() {
+    copy_internals
+    if [ -n "${DGR_SHELL_RUNLEVEL}" ]; then
+        echo_purple "Running runlevel ${DGR_SHELL_RUNLEVEL}"
+        run_runlevel "${DGR_SHELL_RUNLEVEL}" || echo_red "Runlevel ${DGR_SHELL_RUNLEVEL} failed"
+    fi
+
+    if [ "${DGR_SHELL_STAGE}" == "builder" ]; then
+        echo_purple "Opening shell in builder, aci rootfs is in ${ROOTFS}"
+        cd ${ACI_HOME}
+        sh
+    else
+        echo_purple "Opening shell in aci rootfs, aci home is in /dgr/aci-home"
+        rootfs_nspawn /dgr/bin/busybox sh
+    fi
+}
+
+case "${DGR_BUILD_STEP}" in
+    "inherit-build-early") step_inherit_build_early ;;
+    "builder") step_builder ;;
+    "build") step_build ;;
+    "files") step_files ;;
+    "build-late") step_build_late ;;
+    "shell") step_shell ;;
+    "")
+        step_inherit_build_early
+        step_builder
+        step_build
+        step_files
+        step_build_late
+        ;;
+    *)
+        echo_red "Unknown build step '${DGR_BUILD_STEP}'. This is a builder issue"
+        exit 1
+        ;;
+esac
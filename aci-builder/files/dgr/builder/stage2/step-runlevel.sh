@@ -0,0 +1,7 @@
+#!/dgr/bin/busybox sh
+set -e
+. /dgr/builder/export
+. /dgr/bin/functions.sh
+isLevelEnabled "debug" && set -x
+
+execute_files "/dgr/builder/runlevels/${1}"
@@ -11,20 +11,29 @@ echo_purple() {
   echo -e "\033[0;35m${1}\033[0m"
 }
 
+# switch build output to the log file of a step, when dgr logs steps
+dgr_step() {
+  dgr_current_step=$1
+  [ -z "${DGR_STEP_MARKER}" ] || echo "${DGR_STEP_MARKER}${1}"
+}
+
 execute_files() {
   fdir=$1
   [ -d "$fdir" ] || return 0
 
   if [ "$(ls -A "${fdir}")" ]; then
+      previous_step=${dgr_current_step}
       for file in "${fdir}"/*; do
         if [ -f "$file" ]; then
             [ -e "$file" ] && {
                 [ -x "$file" ] || chmod +x "$file" >/dev/null 2>&1 || true
+                dgr_step "${fdir##*/}-${file##*/}"
                 isLevelEnabled 4 && echo_green "Running script -> $file"
                 "$file" || return 1
             }
         fi
       done
+      [ -z "${previous_step}" ] || dgr_step "${previous_step}"
   fi
 }
 
@@ -13,7 +13,7 @@ import (
 	"github.com/n0rad/go-erlog/logs"
 )
 
-func (aci *Aci) prepareRktRunArguments(command common.BuilderCommand, builderHash string, stage1Hash string) []string {
+func (aci *Aci) prepareRktRunArguments(command common.BuilderCommand, builderHash string, stage1Hash string) ([]string, error) {
 	var args []string
 
 	if logs.IsDebugEnabled() {
@@ -26,30 +26,95 @@ func (aci *Aci) prepareRktRunArguments(command common.BuilderCommand, builderHas
 	args = append(args, "--set-env="+common.EnvBuilderCommand+"="+string(command))
 	args = append(args, "--set-env="+common.EnvCatchOnError+"="+strconv.FormatBool(aci.args.CatchOnError))
 	args = append(args, "--set-env="+common.EnvCatchOnStep+"="+strconv.FormatBool(aci.args.CatchOnStep))
-	args = append(args, "--net=host")
+	args = append(args, "--set-env="+common.EnvBuilderResume+"="+strconv.FormatBool(aci.args.Resume))
+	args = append(args, "--set-env="+common.EnvBuilderCheckpoint+"="+strconv.FormatBool(aci.args.Resume || aci.args.Checkpoint))
+	if command == common.CommandShell {
+		args = append(args, "--set-env="+common.EnvShellStage+"="+aci.args.ShellStage)
+		args = append(args, "--set-env="+common.EnvShellRunlevel+"="+aci.args.ShellRunlevel)
+	}
+	args = append(args, "--net="+aci.builderNetwork())
 	args = append(args, "--insecure-options=image")
 	args = append(args, "--uuid-file-save="+aci.target+pathBuilderUuid)
 	args = append(args, "--interactive")
 	if stage1Hash != "" {
 		args = append(args, "--stage1-hash="+stage1Hash)
+	} else if id := aci.lock.Id(aci.manifest.Builder.Image); id != "" {
+		args = append(args, "--stage1-hash="+id)
 	} else {
 		args = append(args, "--stage1-name="+aci.manifest.Builder.Image.String())
 	}
 
+	if resources := aci.builderResources(); !resources.IsEmpty() {
+		content, err := json.Marshal(resources)
+		if err != nil {
+			return nil, errs.WithEF(err, aci.fields, "Failed to marshal builder resources")
+		}
+		args = append(args, "--set-env="+common.EnvBuilderResources+"="+string(content))
+	}
+
 	for _, v := range aci.args.SetEnv.Strings() {
 		args = append(args, "--set-env="+v)
 	}
 	args = append(args, builderHash)
-	return args
+	return args, nil
+}
+
+func (aci *Aci) builderResources() common.BuilderResources {
+	return aci.manifest.Builder.Resources.WithDefaults(Home.Config.Builder.Resources)
+}
+
+func (aci *Aci) builderNetwork() string {
+	if aci.args.BuilderNetwork != "" {
+		return aci.args.BuilderNetwork
+	}
+	if aci.manifest.Builder.Network != "" {
+		return aci.manifest.Builder.Network
+	}
+	return common.NetworkHost
 }
 
 func (aci *Aci) RunBuilderCommand(command common.BuilderCommand) error {
 	defer aci.giveBackUserRightsToTarget()
 	logs.WithF(aci.fields).Info("Building")
 
+	if err := aci.runBuilder(command); err != nil {
+		return err
+	}
+
+	content, err := common.ExtractManifestContentFromAci(aci.target + pathImageAci)
+	if err != nil {
+		logs.WithEF(err, aci.fields).Warn("Failed to extract manifest.json")
+	}
+
+	if err := ioutil.WriteFile(aci.target+pathManifestJson, content, 0644); err != nil {
+		logs.WithEF(err, aci.fields).Warn("Failed to write manifest.json")
+	}
+
+	im := &schema.ImageManifest{}
+	if err = im.UnmarshalJSON(content); err != nil {
+		return errs.WithEF(err, aci.fields.WithField("content", string(content)), "Cannot unmarshall json content")
+	}
+
+	fullname := common.ExtractNameVersionFromManifest(im)
+	logs.WithField("fullname", *fullname).Info("Finished building aci")
+	if err := ioutil.WriteFile(aci.target+pathVersion, []byte(*fullname), 0644); err != nil {
+		return errs.WithEF(err, aci.fields, "Failed to write version file in target")
+	}
+
+	return nil
+}
+
+// runBuilder runs the command in the builder container, prepared like for a build
+func (aci *Aci) runBuilder(command common.BuilderCommand) error {
+	if err := aci.useLock(); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(aci.target, 0777); err != nil {
 		return errs.WithEF(err, aci.fields, "Cannot create target directory")
 	}
+	if err := aci.writeTargetLock(); err != nil {
+		return err
+	}
 
 	if err := ioutil.WriteFile(aci.target+common.PathManifestYmlTmpl, []byte(aci.manifestTmpl), 0644); err != nil {
 		return errs.WithEF(err, aci.fields.WithField("file", aci.target+common.PathManifestYmlTmpl), "Failed to write manifest template")
@@ -67,35 +132,53 @@ func (aci *Aci) RunBuilderCommand(command common.BuilderCommand) error {
 
 	logs.WithF(aci.fields).Info("Calling rkt to start build")
 	defer aci.cleanupRun(builderHash, stage1Hash)
-	if err := Home.Rkt.Run(aci.prepareRktRunArguments(command, builderHash, stage1Hash)); err != nil {
-		return errs.WithEF(err, aci.fields, "Builder container return with failed status")
+	runArgs, err := aci.prepareRktRunArguments(command, builderHash, stage1Hash)
+	if err != nil {
+		return err
+	}
+	switch {
+	case aci.runInBackground(command):
+		err = Home.Rkt.RunContext(aci.ctx, runArgs)
+	case aci.interactive(command):
+		err = Home.Rkt.RunInteractive(runArgs)
+	default:
+		err = Home.Rkt.Run(runArgs)
 	}
-
-	content, err := common.ExtractManifestContentFromAci(aci.target + pathImageAci)
 	if err != nil {
-		logs.WithEF(err, aci.fields).Warn("Failed to extract manifest.json")
+		if aci.ctx.Err() == nil {
+			aci.logFailedStep()
+		}
+		return errs.WithEF(err, aci.fields, "Builder container return with failed status")
 	}
 
-	if err := ioutil.WriteFile(aci.target+pathManifestJson, content, 0644); err != nil {
-		logs.WithEF(err, aci.fields).Warn("Failed to write manifest.json")
-	}
+	return nil
+}
 
-	im := &schema.ImageManifest{}
-	if err = im.UnmarshalJSON(content); err != nil {
-		return errs.WithEF(err, aci.fields.WithField("content", string(content)), "Cannot unmarshall json content")
-	}
+// runInBackground tells if rkt runs in its own process group, cancelled with the context, as for concurrent builds
+// of a pod's acis. Catch and shell use the terminal and run in foreground.
+func (aci *Aci) runInBackground(command common.BuilderCommand) bool {
+	return aci.args.Jobs != 1 && !aci.interactive(command)
+}
 
-	fullname := common.ExtractNameVersionFromManifest(im)
-	logs.WithField("fullname", *fullname).Info("Finished building aci")
-	if err := ioutil.WriteFile(aci.target+pathVersion, []byte(*fullname), 0644); err != nil {
-		return errs.WithEF(err, aci.fields, "Failed to write version file in target")
-	}
+// interactive tells if the builder may open a shell, rkt being attached to the terminal
+func (aci *Aci) interactive(command common.BuilderCommand) bool {
+	return command == common.CommandShell || aci.args.CatchOnError || aci.args.CatchOnStep
+}
 
-	return nil
+// writeTargetLock gives the lock to the builder, for the dependencies of the built image's manifest
+func (aci *Aci) writeTargetLock() error {
+	file := aci.target + common.PathAciManifestLock
+	if len(aci.lock.Dependencies) == 0 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return errs.WithEF(err, aci.fields.WithField("file", file), "Failed to remove lock file from target")
+		}
+		return nil
+	}
+	return aci.lock.Write(file)
 }
 
 func (aci *Aci) cleanupRun(builderHash string, stage1Hash string) {
-	if !Args.KeepBuilder {
+	if !aci.args.KeepBuilder {
 		if _, _, err := Home.Rkt.RmFromFile(aci.target + pathBuilderUuid); err != nil {
 			logs.WithEF(err, aci.fields).Warn("Failed to remove build container")
 		}
@@ -113,8 +196,17 @@ func (aci *Aci) cleanupRun(builderHash string, stage1Hash string) {
 }
 
 func (aci *Aci) Build() error {
+	if err := aci.runHooks(HookPreBuild, pathImageAci); err != nil {
+		return err
+	}
+	if err := aci.useLock(); err != nil {
+		return err
+	}
 	aci.checkDependencies()
-	return aci.RunBuilderCommand(common.CommandBuild)
+	if err := aci.RunBuilderCommand(common.CommandBuild); err != nil {
+		return err
+	}
+	return aci.runHooks(HookPostBuild, pathImageAci)
 }
 
 func (aci *Aci) CleanAndBuild() error {
@@ -124,7 +216,7 @@ func (aci *Aci) CleanAndBuild() error {
 
 func (aci *Aci) checkDependencies() {
 	aci.checkWg.Add(2)
-	if !aci.args.ParallelBuild {
+	if aci.args.Jobs == 1 {
 		aci.checkCompatibilityVersions()
 		aci.checkLatestVersions()
 	} else {
@@ -145,7 +237,9 @@ func (aci *Aci) prepareStage1aci() (string, error) {
 		return "", errs.WithEF(err, aci.fields.WithField("path", aci.target+pathBuilder), "Failed to create stage1 aci path")
 	}
 
-	Home.Rkt.Fetch(aci.manifest.Builder.Image.String())
+	if _, err := Home.Rkt.Fetch(aci.manifest.Builder.Image.String()); err != nil && Home.Config.Discovery.Offline {
+		return "", errs.WithEF(err, aci.fields.WithField("builder", aci.manifest.Builder.Image), "Builder is not in rkt store, fetch it before going offline")
+	}
 	manifestStr, err := Home.Rkt.CatManifest(aci.manifest.Builder.Image.String())
 	if err != nil {
 		return "", errs.WithEF(err, aci.fields, "Failed to read stage1 image manifest")
@@ -168,6 +262,9 @@ func (aci *Aci) prepareStage1aci() (string, error) {
 		return "", errs.WithEF(err, aci.fields, "Invalid image on stage1 for rkt")
 	}
 	manifest.Dependencies = append(manifest.Dependencies, stage1Image...)
+	if err := aci.lock.Pin(manifest.Dependencies); err != nil {
+		return "", errs.WithEF(err, aci.fields, "Failed to pin dependencies of stage1")
+	}
 
 	name, err := types.NewACIdentifier(prefixBuilderStage1 + aci.manifest.NameAndVersion.Name())
 	if err != nil {
@@ -217,7 +314,12 @@ func (aci *Aci) prepareBuildAci() (string, error) {
 		return "", errs.WithEF(err, aci.fields, "Failed to prepare all retain set isolator")
 	}
 
-	aci.manifest.Aci.App.Isolators = types.Isolators([]types.Isolator{*allIsolator})
+	resourceIsolators, err := aci.builderResources().ToIsolators()
+	if err != nil {
+		return "", errs.WithEF(err, aci.fields, "Invalid builder resources")
+	}
+
+	aci.manifest.Aci.App.Isolators = append(types.Isolators([]types.Isolator{*allIsolator}), resourceIsolators...)
 
 	if err := common.WriteAciManifest(aci.manifest, aci.target+pathBuilder+common.PathManifest, common.PrefixBuilder+aci.manifest.NameAndVersion.Name(), BuildVersion); err != nil {
 		return "", err
@@ -1,15 +1,37 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
 
+	"github.com/blablacar/dgr/dgr/common"
 	"github.com/n0rad/go-erlog/logs"
 )
 
 func (aci *Aci) Clean() {
 	logs.WithF(aci.fields).Debug("Cleaning")
 
+	if aci.args.Resume {
+		aci.cleanKeepingCheckpoints()
+		return
+	}
+
 	if err := os.RemoveAll(aci.target + "/"); err != nil {
 		logs.WithEF(err, aci.fields).WithField("dir", aci.target).Warn("Cannot remove directory")
 	}
 }
+
+func (aci *Aci) cleanKeepingCheckpoints() {
+	files, err := ioutil.ReadDir(aci.target)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if "/"+f.Name() == common.PathCheckpoints {
+			continue
+		}
+		if err := os.RemoveAll(aci.target + "/" + f.Name()); err != nil {
+			logs.WithEF(err, aci.fields).WithField("file", aci.target+"/"+f.Name()).Warn("Cannot remove file")
+		}
+	}
+}
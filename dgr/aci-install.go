@@ -17,10 +17,13 @@ func (aci *Aci) Install() ([]string, error) {
 		}
 	}
 
+	if err := aci.runHooks(HookPreInstall, pathImageAci); err != nil {
+		return hashs, err
+	}
 	hash, err := Home.Rkt.Fetch(aci.target + pathImageAci)
 	if err != nil {
 		return hashs, errs.WithEF(err, aci.fields, "Failed to install aci")
 	}
 	hashs = append(hashs, hash)
-	return hashs, nil
+	return hashs, aci.runHooks(HookPostInstall, pathImageAci)
 }
@@ -1,13 +1,9 @@
 package main
 
 import (
-	"net/http"
-	"strings"
-
+	"github.com/appc/spec/schema"
 	"github.com/blablacar/dgr/dgr/common"
-	"github.com/coreos/rkt/rkt/config"
 	"github.com/n0rad/go-erlog/errs"
-	"github.com/n0rad/go-erlog/logs"
 )
 
 func (aci *Aci) Push() error {
@@ -27,72 +23,27 @@ func (aci *Aci) Push() error {
 	if err := aci.EnsureZipSign(); err != nil {
 		return err
 	}
+	if err := aci.verifySignature(aci.target + pathImageGzAci); err != nil {
+		return err
+	}
 
 	im, err := common.ExtractManifestFromAci(aci.target + pathImageAci)
 	if err != nil {
 		return errs.WithEF(err, aci.fields.WithField("file", pathImageAci), "Failed to extract manifest from aci file")
 	}
 
-	return aci.upload(common.ExtractNameVersionFromManifest(im))
+	if err := aci.runHooks(HookPrePush, pathImageGzAci); err != nil {
+		return err
+	}
+	if err := aci.upload(im); err != nil {
+		return err
+	}
+	return aci.runHooks(HookPostPush, pathImageGzAci)
 }
 
-func (aci *Aci) upload(name *common.ACFullname) error {
-	if Home.Config.Push.Type == "maven" && name.DomainName() == "aci.blbl.cr" { // TODO this definitely need to be removed
-		logs.WithF(aci.fields).Info("Uploading aci")
-		if err := common.ExecCmd("curl", "-f", "-i", "-L",
-			"-F", "r=releases",
-			"-F", "hasPom=false",
-			"-F", "e=aci",
-			"-F", "g=com.blablacar.aci.linux.amd64",
-			"-F", "p=aci",
-			"-F", "v="+name.Version(),
-			"-F", "a="+strings.Split(string(name.Name()), "/")[1],
-			"-F", "file=@"+aci.target+pathImageGzAci,
-			"-u", Home.Config.Push.Username+":"+Home.Config.Push.Password,
-			Home.Config.Push.Url+"/service/local/artifact/maven/content"); err != nil {
-			return errs.WithEF(err, aci.fields, "Failed to push aci")
-		}
-	} else {
-		systemConf := Home.Config.Rkt.SystemConfig
-		if systemConf == "" {
-			systemConf = "/usr/lib/rkt"
-		}
-		localConf := Home.Config.Rkt.LocalConfig
-		if localConf == "" {
-			localConf = "/etc/rkt"
-		}
-
-		conf, err := config.GetConfigFrom(systemConf, localConf)
-		if err != nil {
-			return errs.WithEF(err, aci.fields, "Failed to get rkt configuration")
-		}
-
-		upload := Uploader{
-			Acipath: aci.target + pathImageGzAci,
-			Ascpath: aci.target + pathImageGzAciAsc,
-			Uri:     name.String(),
-			Debug:   false,
-			SetHTTPHeaders: func(r *http.Request) {
-				if r.URL == nil {
-					return
-				}
-				headerer, ok := conf.AuthPerHost[r.URL.Host]
-				if !ok {
-					logs.WithFields(aci.fields).WithField("domain", r.URL.Host).
-						Warn("No auth credential found in rkt configuration for this domain")
-					return
-				}
-				header := headerer.GetHeader()
-				for k, v := range header {
-					r.Header[k] = append(r.Header[k], v...)
-				}
-			},
-		}
-		err = upload.Upload()
-		if err != nil {
-			return errs.WithEF(err, aci.fields, "Failed to upload aci")
-		}
-
-	}
-	return nil
+func (aci *Aci) upload(im *schema.ImageManifest) error {
+	osName, _ := im.Labels.Get(osLabelName)
+	arch, _ := im.Labels.Get(archLabelName)
+	artifact := common.NewPushArtifact(*common.ExtractNameVersionFromManifest(im), aci.target+pathImageGzAci, common.ExtAci, osName, arch)
+	return pushArtifact(artifact, aci.fields)
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+func (aci *Aci) Run() error {
+	overrides, err := prepareRunOverrides(aci.args)
+	if err != nil {
+		return err
+	}
+	if err := aci.EnsureBuilt(); err != nil {
+		return err
+	}
+
+	args := []string{"--interactive"}
+	for _, volume := range overrides.volumes {
+		args = append(args, "--volume="+volume.name.String()+",kind=host,source="+volume.path)
+	}
+	for _, port := range overrides.ports {
+		args = append(args, "--port="+port.name.String()+":"+strconv.FormatUint(uint64(port.hostPort), 10))
+	}
+	for _, env := range overrides.env {
+		args = append(args, "--set-env="+env.Name+"="+env.Value)
+	}
+	args = append(args, aci.target+pathImageAci)
+	if aci.args.RunExec != "" {
+		exec := strings.Fields(aci.args.RunExec)
+		args = append(args, "--exec="+exec[0])
+		if len(exec) > 1 {
+			args = append(args, "--")
+			args = append(args, exec[1:]...)
+		}
+	}
+
+	logs.WithF(aci.fields).Info("Running")
+	if err := runInteractive(args, aci.target+pathRunUuid); err != nil {
+		return errs.WithEF(err, aci.fields, "Run of aci failed")
+	}
+	return nil
+}
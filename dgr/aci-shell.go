@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+func (aci *Aci) Shell(app string) error {
+	defer aci.giveBackUserRightsToTarget()
+	if app != "" {
+		return errs.WithF(aci.fields.WithField("app", app), "App can only be selected in a pod")
+	}
+	if err := aci.checkShellArgs(); err != nil {
+		return err
+	}
+
+	logs.WithF(aci.fields).WithField("stage", aci.args.ShellStage).Info("Opening shell")
+	return aci.runBuilder(common.CommandShell)
+}
+
+func (aci *Aci) checkShellArgs() error {
+	if aci.args.ShellStage != common.ShellStageBuilder && aci.args.ShellStage != common.ShellStageRootfs {
+		return errs.WithF(aci.fields.WithField("stage", aci.args.ShellStage), "Unknown shell stage")
+	}
+	if aci.args.ShellRunlevel == "" {
+		return nil
+	}
+	for _, runlevel := range common.ShellRunlevels {
+		if runlevel == aci.args.ShellRunlevel {
+			return nil
+		}
+	}
+	return errs.WithF(aci.fields.WithFields(data.Fields{"runlevel": aci.args.ShellRunlevel, "supported": common.ShellRunlevels}),
+		"Unsupported runlevel")
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"github.com/blablacar/dgr/dgr/common"
 	"github.com/n0rad/go-erlog/errs"
 	"github.com/n0rad/go-erlog/logs"
 )
@@ -24,19 +23,61 @@ func (aci *Aci) ZipSign() error {
 	return aci.signFile(aci.target + pathImageGzAci)
 }
 
+// signFile signs the requested image file, or the ones set by files of the sign configuration
 func (aci *Aci) signFile(file string) error {
 	sign, err := Home.Config.GetSignKeyring(aci.manifest.NameAndVersion.DomainName())
 	if err != nil {
 		return errs.WithEF(err, aci.fields, "Failed to sign image. Cannot found keyring")
 	}
-	if sign.Disabled {
+	enabled, err := signEnabled(sign)
+	if err != nil {
+		return errs.WithEF(err, aci.fields, "Failed to sign image")
+	}
+	if !enabled {
 		logs.WithF(aci.fields).WithField("domain", aci.manifest.NameAndVersion.DomainName()).Warn("Sign disabled for this aci's domain")
 		return nil
 	}
 
-	if err := common.ExecCmd("gpg", "--yes", "--no-default-keyring", "--armor",
-		"--keyring", sign.Keyring, "--output", file+suffixAsc, "--detach-sig", file); err != nil {
-		return errs.WithEF(err, aci.fields, "Failed to sign image")
+	for _, image := range sign.signedImages(aci.target, file) {
+		if image == aci.target+pathImageGzAci {
+			if err := aci.EnsureZip(); err != nil {
+				return err
+			}
+		}
+		if err := signFile(sign, image); err != nil {
+			return errs.WithEF(err, aci.fields, "Failed to sign image")
+		}
+	}
+	return nil
+}
+
+// verifySignature checks the image signature with the signing keyring, before pushing it
+func (aci *Aci) verifySignature(file string) error {
+	sign, err := Home.Config.GetSignKeyring(aci.manifest.NameAndVersion.DomainName())
+	if err != nil {
+		return errs.WithEF(err, aci.fields, "Failed to verify image. Cannot found keyring")
+	}
+	enabled, err := signEnabled(sign)
+	if err != nil {
+		return errs.WithEF(err, aci.fields, "Failed to verify image")
+	}
+	if !enabled {
+		return nil
+	}
+
+	signed := false
+	for _, image := range sign.signedImages(aci.target, file) {
+		signed = signed || image == file
+	}
+	if !signed {
+		if sign.Required {
+			return errs.WithF(aci.fields.WithField("file", file).WithField("files", sign.Files), "Signing is required but this image file is not signed")
+		}
+		return nil
+	}
+
+	if err := verifyFile(sign, file); err != nil {
+		return errs.WithEF(err, aci.fields, "Image signature verification failed")
 	}
 	return nil
 }
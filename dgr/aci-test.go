@@ -25,8 +25,15 @@ func (aci *Aci) Test() error {
 		return err
 	}
 
+	if err := aci.runHooks(HookPreTest, pathImageAci); err != nil {
+		return err
+	}
+
 	logs.WithF(aci.fields).Info("Testing")
 
+	if err := aci.useLock(); err != nil {
+		return err
+	}
 	ImportInternalTesterIfNeeded(aci.manifest)
 
 	logs.WithF(aci.fields).Info("Building test aci")
@@ -44,7 +51,7 @@ func (aci *Aci) Test() error {
 	if err := aci.checkResult(); err != nil {
 		return err
 	}
-	return nil
+	return aci.runHooks(HookPostTest, pathImageAci)
 }
 
 func (aci *Aci) checkResult() error {
@@ -79,7 +86,7 @@ func (aci *Aci) checkResult() error {
 		return errs.WithF(aci.fields, "Something goes wrong while running tests")
 	}
 
-	if Args.NoTestFail && !testFound {
+	if aci.args.NoTestFail && !testFound {
 		return errs.WithEF(err, aci.fields, "No tests found")
 	}
 	return nil
@@ -89,21 +96,34 @@ func (aci *Aci) runTestAci(testerHash string, hashAcis []string) error {
 	os.MkdirAll(aci.target+pathTestsResult, 0777)
 
 	defer aci.cleanupTest(testerHash, hashAcis)
-	if err := Home.Rkt.Run([]string{"--set-env=" + common.EnvLogLevel + "=" + logs.GetLevel().String(),
+	out, err := common.NewStepLogWriter(aci.target+common.PathLogs, common.StepTest, os.Stdout)
+	if err != nil {
+		return errs.WithEF(err, aci.fields, "Failed to prepare test log")
+	}
+	defer out.Close()
+	runArgs := []string{"--set-env=" + common.EnvLogLevel + "=" + logs.GetLevel().String(),
 		"--net=default",
 		"--mds-register=false",
 		"--uuid-file-save=" + aci.target + pathTesterUuid,
 		"--volume=" + mountAcname + ",kind=host,source=" + aci.target + pathTestsResult,
 		testerHash,
 		"--exec", "/test",
-	}); err != nil {
+	}
+	if aci.runInBackground(common.CommandBuild) {
+		err = Home.Rkt.RunContextWithOutput(aci.ctx, out, runArgs)
+	} else {
+		err = Home.Rkt.RunWithOutput(out, runArgs)
+	}
+	if err != nil {
+		out.Close()
+		aci.logFailedStep()
 		return errs.WithEF(err, aci.fields, "Run of test aci failed")
 	}
 	return nil
 }
 
 func (aci *Aci) cleanupTest(testerHash string, hashAcis []string) {
-	if !Args.KeepBuilder {
+	if !aci.args.KeepBuilder {
 		if _, _, err := Home.Rkt.RmFromFile(aci.target + pathTesterUuid); err != nil {
 			logs.WithEF(err, aci.fields).Warn("Failed to remove test container")
 		}
@@ -121,6 +141,9 @@ func (aci *Aci) cleanupTest(testerHash string, hashAcis []string) {
 }
 
 func (aci *Aci) buildTestAci() (string, error) {
+	if err := aci.useLock(); err != nil {
+		return "", err
+	}
 	manifest, err := common.ExtractManifestFromAci(aci.target + common.PathImageAci)
 	if err != nil {
 		return "", errs.WithEF(err, aci.fields.WithField("file", aci.target+common.PathImageAci), "Failed to extract manifest from aci")
@@ -165,6 +188,8 @@ func (aci *Aci) buildTestAci() (string, error) {
 	}
 
 	testAci.FullyResolveDep = false // this is required to run local tests without discovery
+	testAci.lock = aci.lock
+	testAci.skipHooks = true
 	testAci.target = aci.target + pathTestsTarget
 
 	if err := testAci.CleanAndBuild(); err != nil {
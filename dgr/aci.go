@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/blablacar/dgr/dgr/common"
@@ -36,6 +38,7 @@ const prefixTest = "test/"
 const prefixBuilderStage1 = "builder-stage1/"
 
 type Aci struct {
+	ctx             context.Context
 	checkWg         *sync.WaitGroup
 	fields          data.Fields
 	path            string
@@ -45,6 +48,9 @@ type Aci struct {
 	manifest        *common.AciManifest
 	args            BuildArgs
 	FullyResolveDep bool
+	skipHooks       bool
+	lock            *common.LockFile
+	locked          bool
 }
 
 func NewAciWithManifest(path string, args BuildArgs, manifestTmpl string, checkWg *sync.WaitGroup) (*Aci, error) {
@@ -74,6 +80,7 @@ func NewAciWithManifest(path string, args BuildArgs, manifestTmpl string, checkW
 	}
 
 	aci := &Aci{
+		ctx:             context.Background(),
 		fields:          fields,
 		args:            args,
 		path:            fullPath,
@@ -148,10 +155,32 @@ func (aci *Aci) checkCompatibilityVersions() {
 	defer aci.checkWg.Done()
 	for _, dep := range aci.manifest.Aci.Dependencies {
 		logs.WithF(aci.fields).WithField("dependency", dep.String()).Info("Fetching dependency")
-		Home.Rkt.Fetch(dep.String())
+		if _, err := Home.Rkt.Fetch(dep.String()); err != nil && Home.Config.Discovery.Offline {
+			logs.WithEF(err, aci.fields.WithField("dependency", dep.String())).Error("Dependency is not in rkt store, fetch it before going offline")
+		}
 	}
 }
 
+// useLock pins dependencies to the versions and image ids of the lock file, once, before they are fetched
+func (aci *Aci) useLock() error {
+	if aci.locked {
+		return nil
+	}
+	if aci.lock == nil {
+		lock, err := readProjectLock(aci.path+common.PathAciManifestLock, aci.manifest.LockableDependencies(), aci.args.Frozen, aci.fields)
+		if err != nil {
+			return err
+		}
+		aci.lock = lock
+	}
+	if err := verifyLock(*aci.lock, aci.manifest.LockableDependencies(), aci.fields); err != nil {
+		return err
+	}
+	aci.lock.Apply(aci.manifest)
+	aci.locked = true
+	return nil
+}
+
 func (aci *Aci) checkLatestVersions() {
 	defer aci.checkWg.Done()
 	CheckLatestVersion(aci.manifest.Aci.Dependencies, "dependency")
@@ -165,7 +194,11 @@ func CheckLatestVersion(deps []common.ACFullname, warnText string) {
 		if dep.Version() == "" {
 			continue
 		}
-		version, _ := dep.LatestVersion()
+		version, err := latestVersion(dep)
+		if err != nil {
+			logs.WithEF(err, data.WithField("dependency", dep.String())).Debug("Latest version not checked")
+			continue
+		}
 		if version != "" && common.Version(dep.Version()).LessThan(common.Version(version)) {
 			logs.WithField("newer", dep.Name()+":"+version).
 				WithField("current", dep.String()).
@@ -174,6 +207,39 @@ func CheckLatestVersion(deps []common.ACFullname, warnText string) {
 	}
 }
 
+func (aci *Aci) runHooks(hook Hook, image string) error {
+	if aci.skipHooks {
+		return nil
+	}
+	fullname := aci.manifest.NameAndVersion
+	if content, err := ioutil.ReadFile(aci.target + pathVersion); err == nil {
+		fullname = *common.NewACFullName(string(content))
+	}
+	return runHooks(hook, HookEnv{
+		Path:     aci.path,
+		Target:   aci.target,
+		Fullname: fullname,
+		Image:    aci.target + image,
+	}, aci.fields)
+}
+
+const failedStepTailLines = 30
+
+// logFailedStep displays the end of the last step log written in target, the one that failed
+func (aci *Aci) logFailedStep() {
+	path, err := common.LastStepLog(aci.target + common.PathLogs)
+	if err != nil {
+		logs.WithEF(err, aci.fields).Debug("No step log to display")
+		return
+	}
+	lines, err := common.TailFile(path, failedStepTailLines)
+	if err != nil {
+		logs.WithEF(err, aci.fields).Warn("Failed to read failed step log")
+		return
+	}
+	logs.WithF(aci.fields.WithField("log", path)).Error("Step failed, end of its log:\n" + strings.Join(lines, "\n"))
+}
+
 func (aci *Aci) giveBackUserRightsToTarget() {
 	giveBackUserRights(aci.target)
 }
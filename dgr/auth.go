@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/blablacar/dgr/dgr/discovery"
+	"github.com/coreos/rkt/rkt/config"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+// authHeaders sets on requests the credentials of dgr configuration for their host, or else the ones of rkt configuration
+func authHeaders(fields data.Fields) (func(*http.Request), error) {
+	systemConf, localConf := rktConfigDirs()
+	conf, err := config.GetConfigFrom(systemConf, localConf)
+	if err != nil {
+		return nil, errs.WithEF(err, fields, "Failed to get rkt configuration")
+	}
+
+	return func(r *http.Request) {
+		if r.URL == nil {
+			return
+		}
+		ok, err := Home.Config.Auths.SetHeader(r)
+		if err != nil {
+			logs.WithEF(err, fields.WithField("host", r.URL.Host)).Error("Failed to get credentials")
+			return
+		}
+		if ok {
+			return
+		}
+		headerer, ok := conf.AuthPerHost[r.URL.Host]
+		if !ok {
+			logs.WithF(fields.WithField("host", r.URL.Host)).
+				Warn("No auth credential found in dgr or rkt configuration for this host")
+			return
+		}
+		header := headerer.GetHeader()
+		for k, v := range header {
+			r.Header[k] = append(r.Header[k], v...)
+		}
+	}, nil
+}
+
+// discoveryHeaders returns the credentials of dgr configuration for the domain of the image, to discover it
+func discoveryHeaders(app discovery.App) (map[string]http.Header, error) {
+	host := strings.Split(app.Name.String(), "/")[0]
+	headers, err := Home.Config.Auths.HostHeaders(host)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("name", app.Name), "Failed to get discovery credentials")
+	}
+	return headers, nil
+}
+
+// fetchHosts returns the hosts of the aci and signature urls discovered for the image, where rkt downloads it from
+func fetchHosts(image string) []string {
+	fields := data.WithField("image", image)
+	app, err := discovery.NewAppFromString(image)
+	if err != nil {
+		logs.WithEF(err, fields).Debug("Invalid image name, no fetch hosts")
+		return nil
+	}
+	if app.Labels["os"] == "" {
+		app.Labels["os"] = resolverOs
+	}
+	if app.Labels["arch"] == "" {
+		app.Labels["arch"] = resolverArch
+	}
+	endpoints, _, err := discoverEndpoints(*app, false)
+	if err != nil {
+		logs.WithEF(err, fields).Debug("Discovery failed, credentials only given for the domain of the image")
+		return nil
+	}
+
+	hosts := []string{}
+	for _, endpoint := range endpoints.ACIEndpoints {
+		for _, u := range []string{endpoint.ACI, endpoint.ASC} {
+			if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+				hosts = append(hosts, parsed.Host)
+			}
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+
+	"github.com/n0rad/go-erlog/logs"
+	"github.com/spf13/cobra"
+)
+
+var configScope string
+var configOrigin bool
+
+var configSignCheckCmd = &cobra.Command{
+	Use:   "sign-check name",
+	Short: "show the sign rule of an image name",
+	Long:  `show the sign configuration entry applying to an image name, and the key it signs with`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if err := signCheck(args[0]); err != nil {
+			logs.WithE(err).Fatal("Sign check failed")
+		}
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set key value",
+	Short: "set a configuration value",
+	Long:  `set a configuration value, like 'rkt.path' or 'upload.retries', in the configuration file of the scope`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if err := configSet(args[0], args[1], configScope); err != nil {
+			logs.WithE(err).Fatal("Failed to set configuration")
+		}
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset key",
+	Short: "remove a configuration value",
+	Long:  `remove a configuration value from the configuration file of the scope`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if err := configUnset(args[0], configScope); err != nil {
+			logs.WithE(err).Fatal("Failed to unset configuration")
+		}
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "validate configuration files",
+	Long:  `check configuration files, environment and flags for unknown keys and invalid values`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configValidate(); err != nil {
+			logs.WithE(err).Fatal("Validation failed")
+		}
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "display the effective configuration",
+	Long:  `display the configuration merged from system, user and project files, environment and flags`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configShow(configOrigin); err != nil {
+			logs.WithE(err).Fatal("Failed to show configuration")
+		}
+	},
+}
+
+func init() {
+	configSetCmd.Flags().StringVarP(&configScope, "scope", "s", configScopeUser, "configuration file to write (system, user or project)")
+	configUnsetCmd.Flags().StringVarP(&configScope, "scope", "s", configScopeUser, "configuration file to write (system, user or project)")
+	configShowCmd.Flags().BoolVar(&configOrigin, "origin", false, "display the file, env or flags that set each value")
+
+	configCmd.AddCommand(configSignCheckCmd, configSetCmd, configUnsetCmd, configValidateCmd, configShowCmd)
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"sync"
+	"text/tabwriter"
 
 	"github.com/blablacar/dgr/dgr/common"
 	"github.com/n0rad/go-erlog/data"
@@ -14,6 +16,18 @@ import (
 const initManifestContent = `name: aci.example.com/aci-dummy:1
 `
 
+const initPodManifestContent = `name: pod.example.com/pod-dummy:1
+pod:
+  apps:
+    - name: aci-dummy-front
+    - name: aci-dummy-back
+`
+
+var initPod bool
+var initTemplate string
+var initListTemplates bool
+var initAttributes envMap
+
 var initCmd = &cobra.Command{
 
 	Use:   "init",
@@ -22,6 +36,13 @@ var initCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		checkNoArgs(args)
 
+		if initListTemplates {
+			listInitTemplatesAndExit()
+		}
+		if initPod && initTemplate != "" {
+			logs.Fatal("--pod and --template cannot be used together")
+		}
+
 		fields := data.WithField("path", workPath)
 		if _, err := os.Stat(workPath); err != nil {
 			if err := os.MkdirAll(workPath, 0755); err != nil {
@@ -39,7 +60,19 @@ var initCmd = &cobra.Command{
 			}
 		}
 
-		if err := ioutil.WriteFile(workPath+common.PathAciManifest, []byte(initManifestContent), 0644); err != nil {
+		if initTemplate != "" {
+			defer giveBackUserRights(workPath)
+			if err := initFromTemplate(workPath, initTemplate); err != nil {
+				logs.WithE(err).Fatal("Init command failed")
+			}
+			return
+		}
+
+		if initPod {
+			if err := ioutil.WriteFile(workPath+pathPodManifestYml, []byte(initPodManifestContent), 0644); err != nil {
+				logs.WithEF(err, fields).Fatal("failed to write pod manifest")
+			}
+		} else if err := ioutil.WriteFile(workPath+common.PathAciManifest, []byte(initManifestContent), 0644); err != nil {
 			logs.WithEF(err, fields).Fatal("failed to write aci manifest")
 		}
 
@@ -54,4 +87,36 @@ var initCmd = &cobra.Command{
 
 func init() {
 	initCmd.Flags().BoolVarP(&Args.Force, "force", "f", false, "Force init command if path is not empty")
+	initCmd.Flags().BoolVar(&initPod, "pod", false, "Init a pod instead of an aci")
+	initCmd.Flags().StringVarP(&initTemplate, "template", "t", "", "Init from a template name, directory or git repository ('url//dir' for a sub-directory)")
+	initCmd.Flags().BoolVar(&initListTemplates, "list-templates", false, "List available init templates")
+	initCmd.Flags().Var(&initAttributes, "set", "Template attribute name=value (name, domain and version have defaults), can be repeated")
+}
+
+func initFromTemplate(path string, ref string) error {
+	tmpl, cleanup, err := findInitTemplate(ref)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	attributes, err := initTemplateAttributes(path, initAttributes)
+	if err != nil {
+		return err
+	}
+	logs.WithField("template", tmpl.Name).WithField("source", tmpl.Source).Info("Init from template")
+	return tmpl.Render(path, attributes)
+}
+
+func listInitTemplatesAndExit() {
+	templates, err := listInitTemplates()
+	if err != nil {
+		logs.WithE(err).Fatal("Cannot list init templates")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tDESCRIPTION")
+	for _, tmpl := range templates {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", tmpl.Name, tmpl.Source, tmpl.Description)
+	}
+	w.Flush()
+	os.Exit(0)
 }
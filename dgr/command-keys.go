@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+
+	"github.com/n0rad/go-erlog/logs"
+	"github.com/spf13/cobra"
+)
+
+var keysDomain string
+var keysName string
+var keysEmail string
+var keysOutput string
+var keysPrefix string
+var keysRoot bool
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "manage signing keys",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+		os.Exit(1)
+	},
+}
+
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "generate a signing key for a domain",
+	Long:  `generate an openpgp key in the home, and set it as the sign keyring of the domain in config.yml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkNoArgsAndDomain(cmd, args)
+		if err := generateKey(keysDomain, keysName, keysEmail, Args.Force); err != nil {
+			logs.WithE(err).Fatal("Keys generate command failed")
+		}
+	},
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list signing keys of domains",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if err := listKeys(); err != nil {
+			logs.WithE(err).Fatal("Keys list command failed")
+		}
+	},
+}
+
+var keysExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export the public key of a domain",
+	Long:  `export the armored public key of a domain, to be served with ac-discovery-pubkeys`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkNoArgsAndDomain(cmd, args)
+		if err := exportKey(keysDomain, keysOutput); err != nil {
+			logs.WithE(err).Fatal("Keys export command failed")
+		}
+	},
+}
+
+var keysTrustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "trust the public key of a domain in rkt",
+	Long:  `install the public key of a domain in the trust store of rkt, for a prefix or for all images`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkNoArgsAndDomain(cmd, args)
+		if keysRoot && keysPrefix != "" {
+			logs.Fatal("--prefix and --root cannot be used together")
+		}
+		if err := trustKey(keysDomain, keysPrefix, keysRoot); err != nil {
+			logs.WithE(err).Fatal("Keys trust command failed")
+		}
+	},
+}
+
+func checkNoArgsAndDomain(cmd *cobra.Command, args []string) {
+	if len(args) != 0 || keysDomain == "" {
+		cmd.Usage()
+		os.Exit(1)
+	}
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{keysGenerateCmd, keysExportCmd, keysTrustCmd} {
+		cmd.Flags().StringVarP(&keysDomain, "domain", "d", "", "Domain of the images (required)")
+	}
+	keysGenerateCmd.Flags().StringVar(&keysName, "name", "dgr", "Name of the key identity")
+	keysGenerateCmd.Flags().StringVar(&keysEmail, "email", "", "Email of the key identity (default dgr@domain)")
+	keysGenerateCmd.Flags().BoolVarP(&Args.Force, "force", "f", false, "Replace existing key of the domain")
+	keysExportCmd.Flags().StringVarP(&keysOutput, "output", "o", "", "Output file (default stdout)")
+	keysTrustCmd.Flags().StringVar(&keysPrefix, "prefix", "", "Image name prefix the key is trusted for (default the domain)")
+	keysTrustCmd.Flags().BoolVar(&keysRoot, "root", false, "Trust the key for all images")
+
+	keysCmd.AddCommand(keysGenerateCmd, keysListCmd, keysExportCmd, keysTrustCmd)
+}
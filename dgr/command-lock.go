@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/n0rad/go-erlog/logs"
+	"github.com/spf13/cobra"
+)
+
+var lockUpdate bool
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "pin dependencies in a lock file",
+	Long:  `write the resolved versions and image ids of dependencies to aci-manifest.lock or pod-manifest.lock`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkNoArgs(args)
+		if err := lock(lockUpdate, Args.Frozen); err != nil {
+			logs.WithE(err).Fatal("Lock command failed")
+		}
+	},
+}
+
+func init() {
+	lockCmd.Flags().BoolVar(&lockUpdate, "update", false, "Resolve again dependencies already locked")
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/n0rad/go-erlog/logs"
+	"github.com/spf13/cobra"
+)
+
+var outdatedJson bool
+var updateDep string
+var updateToMajor bool
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "list dependencies with their latest version",
+	Long:  `list dependencies of the aci, the pod, or the acis and pods of the workspace, with their current and latest versions`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkNoArgs(args)
+		if err := outdated(outdatedJson); err != nil {
+			logs.WithE(err).Fatal("Outdated command failed")
+		}
+	},
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "update dependencies to their latest version",
+	Long:  `rewrite manifests with the latest versions of dependencies, keeping comments and formatting`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkNoArgs(args)
+		if err := update(updateDep, updateToMajor); err != nil {
+			logs.WithE(err).Fatal("Update command failed")
+		}
+	},
+}
+
+func init() {
+	outdatedCmd.Flags().BoolVar(&outdatedJson, "json", false, "Output as json")
+
+	updateCmd.Flags().StringVar(&updateDep, "dep", "", "Update only this dependency name")
+	updateCmd.Flags().BoolVar(&updateToMajor, "major", false, "Also update to a new major version")
+}
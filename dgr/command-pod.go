@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"github.com/n0rad/go-erlog/logs"
+	"github.com/spf13/cobra"
+)
+
+var podFetchOutput string
+
+var podCmd = &cobra.Command{
+	Use:   "pod",
+	Short: "commands on pushed pods",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+		os.Exit(1)
+	},
+}
+
+var podFetchCmd = &cobra.Command{
+	Use:   "fetch name[:version]",
+	Short: "fetch a pushed pod",
+	Long:  `discover, verify and download a pod manifest and fetch its app images in rkt`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if err := fetchPod(args[0], podFetchOutput); err != nil {
+			logs.WithE(err).Fatal("Pod fetch command failed")
+		}
+	},
+}
+
+func init() {
+	podFetchCmd.Flags().StringVarP(&podFetchOutput, "output", "o", "", "Pod manifest file (default name-version.pod-manifest.json)")
+	podCmd.AddCommand(podFetchCmd)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/logs"
+	"github.com/spf13/cobra"
+)
+
+var serveDir string
+var serveListen string
+var serveTlsCert string
+var serveTlsKey string
+var serveAuthHost string
+var serveSessionTimeout time.Duration
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "serve images with appc discovery",
+	Long:  `serve acis, pod manifests, signatures and public keys of a directory, answering discovery and accepting pushes`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		server, err := NewImageServer(serveDir, serveAuthHost, serveSessionTimeout)
+		if err != nil {
+			logs.WithE(err).Fatal("Cannot prepare image server")
+		}
+		if err := server.ListenAndServe(serveListen, serveTlsCert, serveTlsKey); err != nil {
+			logs.WithE(err).Fatal("Serve command failed")
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVarP(&serveDir, "dir", "d", ".", "Directory of images, laid out as "+common.PushArtifactTemplate)
+	serveCmd.Flags().StringVarP(&serveListen, "listen", "l", "localhost:8080", "Address to listen on, ':8080' for all interfaces")
+	serveCmd.Flags().StringVar(&serveTlsCert, "tls-cert", "", "Certificate file to serve https")
+	serveCmd.Flags().StringVar(&serveTlsKey, "tls-key", "", "Key file of the certificate")
+	serveCmd.Flags().StringVar(&serveAuthHost, "auth-host", "", "Require for pushes the credentials of the auth configuration of this host")
+	serveCmd.Flags().DurationVar(&serveSessionTimeout, "session-timeout", time.Hour, "Remove uploads not used for this duration")
+}
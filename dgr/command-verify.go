@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+
+	"github.com/n0rad/go-erlog/logs"
+	"github.com/spf13/cobra"
+)
+
+var verifyKeyring string
+var verifyDiscover bool
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify file",
+	Short: "verify signature of an aci or pod manifest",
+	Long:  `check the detached .asc signature of an aci or pod manifest, with keys trusted by rkt, a keyring or keys found by discovery`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if verifyKeyring != "" && verifyDiscover {
+			logs.Fatal("--keyring and --discover cannot be used together")
+		}
+		if err := verifyImage(args[0], verifyKeyring, verifyDiscover); err != nil {
+			logs.WithE(err).Fatal("Verify command failed")
+		}
+	},
+}
+
+func init() {
+	verifyCmd.Flags().StringVar(&verifyKeyring, "keyring", "", "Keyring file of trusted keys, instead of the rkt trust store")
+	verifyCmd.Flags().BoolVar(&verifyDiscover, "discover", false, "Trust keys found with ac-discovery-pubkeys of the image name")
+}
@@ -18,6 +18,8 @@ type DgrCommand interface {
 	Build() error
 	CleanAndBuild() error
 	CleanAndTry() error
+	Shell(app string) error
+	Run() error
 	Clean()
 	Push() error
 	Install() ([]string, error)
@@ -101,7 +103,7 @@ var configCmd = &cobra.Command{
 		}
 		b := bytes.Buffer{}
 		w := bufio.NewWriter(&b)
-		if err := tmpl.Execute(w, Home.Config); err != nil {
+		if err := tmpl.Execute(w, Home.Config.Redacted()); err != nil {
 			logs.WithE(err).Fatal("Failed to process config templating")
 		}
 		w.Flush()
@@ -125,6 +127,42 @@ var testCmd = newTestCommand(false)
 var tryCmd = newTryCommand(false)
 var signCmd = newSignCommand(false)
 
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "run the built image",
+	Long:  `run the built aci or pod in rkt, building it if needed`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkNoArgs(args)
+
+		checkWg := &sync.WaitGroup{}
+		if err := NewAciOrPod(workPath, Args, checkWg).Run(); err != nil {
+			logs.WithE(err).Fatal("Run command failed")
+		}
+		checkWg.Wait()
+	},
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell [app]",
+	Short: "open a shell in the build environment",
+	Long:  `open a shell in the build environment of the aci, or of the given app of the pod, without running runlevels`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			logs.WithField("args", args).Fatal("Unknown arguments")
+		}
+		app := ""
+		if len(args) == 1 {
+			app = args[0]
+		}
+
+		checkWg := &sync.WaitGroup{}
+		if err := NewAciOrPod(workPath, Args, checkWg).Shell(app); err != nil {
+			logs.WithE(err).Fatal("Shell command failed")
+		}
+		checkWg.Wait()
+	},
+}
+
 ///////////////////////////////////////////////////////////////
 
 func checkNoArgs(args []string) {
@@ -167,6 +205,8 @@ func newBuildCommand(userClean bool) *cobra.Command {
 		},
 	}
 	cmd.Flags().BoolVarP(&Args.KeepBuilder, "keep-builder", "k", false, "Keep builder container after exit")
+	cmd.Flags().BoolVar(&Args.Resume, "resume", false, "Resume build from the first step that failed or whose inputs changed")
+	cmd.Flags().BoolVar(&Args.Checkpoint, "checkpoint", false, "Checkpoint build after each step, to resume it later (implied by --resume)")
 	cmd.Flags().BoolVarP(&Args.CatchOnError, "catch-on-error", "c", false, "Catch a shell on build* runlevel fail") // TODO This is builder dependent and should be pushed by builder ? or find a way to become generic
 	cmd.Flags().BoolVarP(&Args.CatchOnStep, "catch-on-step", "C", false, "Catch a shell after each build* runlevel")
 	return cmd
@@ -275,4 +315,14 @@ func init() {
 	cleanCmd.AddCommand(newBuildCommand(true))
 	cleanCmd.AddCommand(newTryCommand(true))
 	cleanCmd.AddCommand(newSignCommand(true))
+
+	runCmd.Flags().StringSliceVarP(&Args.RunAttributes, "attributes", "a", []string{}, "Attributes file overriding image's ones, can be repeated")
+	runCmd.Flags().VarP(&Args.RunEnv, "env", "e", "Environment variable name=value for the apps, can be repeated")
+	runCmd.Flags().StringSliceVarP(&Args.RunVolumes, "volume", "v", []string{}, "Host directory for a mount point, as name=/host/path, can be repeated")
+	runCmd.Flags().StringSliceVar(&Args.RunPorts, "port", []string{}, "Port forwarded from the host, as name:hostPort, can be repeated")
+	runCmd.Flags().StringVar(&Args.RunExec, "exec", "", "Command run instead of the app's exec (aci only)")
+
+	shellCmd.Flags().StringVar(&Args.ShellStage, "stage", common.ShellStageRootfs, "Where to open the shell, "+common.ShellStageBuilder+" or "+common.ShellStageRootfs)
+	shellCmd.Flags().StringVar(&Args.ShellRunlevel, "run-runlevel", "", "Run this runlevel before opening the shell ("+strings.Join(common.ShellRunlevels, ", ")+")")
+	shellCmd.Flags().BoolVarP(&Args.KeepBuilder, "keep-builder", "k", false, "Keep builder container after exit")
 }
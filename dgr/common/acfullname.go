@@ -2,15 +2,9 @@ package common
 
 import (
 	"encoding/json"
-	"net/http"
-	"regexp"
 	"strings"
 
-	"github.com/appc/spec/discovery"
 	"github.com/juju/errors"
-	"github.com/n0rad/go-erlog/data"
-	"github.com/n0rad/go-erlog/errs"
-	"github.com/n0rad/go-erlog/logs"
 )
 
 type ACFullname string
@@ -25,37 +19,6 @@ func (n *ACFullname) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func (n ACFullname) LatestVersion() (string, error) {
-	app, err := discovery.NewAppFromString(n.Name() + ":latest")
-	if app.Labels["os"] == "" {
-		app.Labels["os"] = "linux"
-	}
-	if app.Labels["arch"] == "" {
-		app.Labels["arch"] = "amd64"
-	}
-
-	endpoints, _, err := discovery.DiscoverACIEndpoints(*app, nil, discovery.InsecureTLS|discovery.InsecureHTTP, 0) //TODO support security
-	if err != nil {
-		return "", errors.Annotate(err, "Latest discovery fail")
-	}
-
-	r, _ := regexp.Compile(`^\d+(.\d+){0,2}(-[\.\-\dA-Za-z]+){0,1}$`) // TODO this is nexus specific
-
-	if len(endpoints) == 0 {
-		return "", errs.WithF(data.WithField("aci", string(n)), "Discovery does not give an endpoint to check latest version")
-	}
-
-	url := getRedirectForLatest(endpoints[0].ACI)
-	logs.WithField("url", url).Debug("latest verion url")
-
-	for _, part := range strings.Split(url, "/") {
-		if r.Match([]byte(part)) {
-			return part, nil
-		}
-	}
-	return "", errors.New("No latest version found")
-}
-
 func (n ACFullname) MarshalJSON() ([]byte, error) {
 	return json.Marshal(n.String())
 }
@@ -70,15 +33,19 @@ func NewACFullName(s string) *ACFullname {
 	return &n
 }
 
-func (n ACFullname) FullyResolved() (*ACFullname, error) {
+// FullyResolved returns the name with its version, the latest one given by the resolver when not set
+func (n ACFullname) FullyResolved(resolver LatestResolver) (*ACFullname, error) {
 	version := n.Version()
 	if version != "" {
 		return &n, nil
 	}
-	version, err := n.LatestVersion()
+	version, err := resolver.LatestVersion(n)
 	if err != nil {
 		return nil, errors.Annotate(err, "Cannot fully resolve AcFullname")
 	}
+	if version == "" {
+		return nil, errors.New("No latest version found")
+	}
 	return NewACFullName(n.Name() + ":" + version), nil
 }
 
@@ -121,32 +88,3 @@ func (n ACFullname) DomainName() string {
 func (n ACFullname) Name() string {
 	return strings.Split(string(n), ":")[0]
 }
-
-////////////////////////////////
-
-func getRedirectForLatest(url string) string {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return ""
-	}
-	transport := http.DefaultTransport
-	//	if insecureSkipVerify {
-	//		transport = &http.Transport{
-	//			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	//		}
-	//	}
-	client := &http.Client{Transport: transport}
-	myurl := ""
-	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-		myurl = req.URL.Path
-		return errors.New("do not want to get the file")
-	}
-	_, err2 := client.Do(req)
-	if err2 != nil {
-		if myurl != "" {
-			return myurl
-		}
-		return ""
-	}
-	return myurl
-}
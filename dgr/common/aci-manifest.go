@@ -113,6 +113,11 @@ func WriteAciManifest(m *AciManifest, targetFile string, projectName string, dgr
 	if err != nil {
 		return errs.WithEF(err, fields, "Failed to prepare dependencies for manifest")
 	}
+	if m.Lock != nil {
+		if err := m.Lock.Pin(im.Dependencies); err != nil {
+			return errs.WithEF(err, fields, "Failed to pin dependencies of manifest")
+		}
+	}
 	im.Name = *name
 	im.Labels = labels
 
@@ -0,0 +1,324 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const (
+	AuthTypeBasic   = "basic"
+	AuthTypeBearer  = "bearer"
+	AuthTypeCommand = "command"
+	AuthTypeNetrc   = "netrc"
+)
+
+const redacted = "<redacted>"
+
+// AuthConfig gives credentials for hosts, like 'aci.example.com' or '*.example.com' as in sign domains
+type AuthConfig struct {
+	Hosts    []string `yaml:"hosts,omitempty"`
+	Type     string   `yaml:"type"`
+	User     string   `yaml:"user,omitempty"`     // basic
+	Password string   `yaml:"password,omitempty"` // basic
+	Token    string   `yaml:"token,omitempty"`    // bearer
+	Command  string   `yaml:"command,omitempty"`  // run with sh, printing a bearer token on stdout
+	Netrc    string   `yaml:"netrc,omitempty"`    // netrc file, ~/.netrc by default
+}
+
+// Auths is the auth section of the configuration
+type Auths []AuthConfig
+
+type credentials struct {
+	user     string
+	password string
+	token    string
+}
+
+var commandTokens = struct {
+	sync.Mutex
+	tokens map[string]string
+}{tokens: make(map[string]string)}
+
+func (a AuthConfig) Validate() error {
+	fields := data.WithField("hosts", a.Hosts).WithField("type", a.Type)
+	if len(a.Hosts) == 0 && a.Type != AuthTypeNetrc {
+		return errs.WithF(fields, "Auth requires hosts, except for netrc")
+	}
+	switch a.Type {
+	case AuthTypeBasic:
+		if a.User == "" {
+			return errs.WithF(fields, "Basic auth requires user")
+		}
+	case AuthTypeBearer:
+		if a.Token == "" {
+			return errs.WithF(fields, "Bearer auth requires token")
+		}
+	case AuthTypeCommand:
+		if a.Command == "" {
+			return errs.WithF(fields, "Command auth requires command")
+		}
+	case AuthTypeNetrc:
+	default:
+		return errs.WithF(fields, "Unknown auth type, use basic, bearer, command or netrc")
+	}
+	return nil
+}
+
+// Redacted returns the auth without its secrets, to be logged
+func (a AuthConfig) Redacted() AuthConfig {
+	if a.Password != "" {
+		a.Password = redacted
+	}
+	if a.Token != "" {
+		a.Token = redacted
+	}
+	return a
+}
+
+func (auths Auths) Validate() error {
+	for _, auth := range auths {
+		if err := auth.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match returns the auth of the most specific hosts pattern matching the host.
+// Netrc auths without hosts apply to hosts not matched by any other.
+func (auths Auths) Match(host string) *AuthConfig {
+	host = strings.Split(host, ":")[0]
+	var match *AuthConfig
+	matchScore := 0
+	var fallback *AuthConfig
+	for i, auth := range auths {
+		if len(auth.Hosts) == 0 {
+			if fallback == nil {
+				fallback = &auths[i]
+			}
+			continue
+		}
+		for _, pattern := range auth.Hosts {
+			if score := MatchDomain(pattern, host); score > matchScore {
+				match, matchScore = &auths[i], score
+			}
+		}
+	}
+	if match != nil {
+		return match
+	}
+	return fallback
+}
+
+// Header returns the Authorization header for the host, nil without credentials for it
+func (auths Auths) Header(host string) (http.Header, error) {
+	creds, err := auths.credentials(host)
+	if err != nil || creds == nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	if creds.token != "" {
+		header.Set("Authorization", "Bearer "+creds.token)
+	} else {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(creds.user+":"+creds.password)))
+	}
+	return header, nil
+}
+
+// HostHeaders returns headers of each of the hosts having credentials, as given to discovery
+func (auths Auths) HostHeaders(hosts ...string) (map[string]http.Header, error) {
+	headers := make(map[string]http.Header)
+	for _, host := range hosts {
+		header, err := auths.Header(host)
+		if err != nil {
+			return nil, err
+		}
+		if header != nil {
+			headers[host] = header
+		}
+	}
+	return headers, nil
+}
+
+// SetHeader sets on the request the credentials of its host, telling if there was some
+func (auths Auths) SetHeader(req *http.Request) (bool, error) {
+	header, err := auths.Header(req.URL.Host)
+	if err != nil || header == nil {
+		return false, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return true, nil
+}
+
+// WriteRktAuth writes the credentials of the host as a rkt auth.d file in dir
+func (auths Auths) WriteRktAuth(dir string, host string) (bool, error) {
+	creds, err := auths.credentials(host)
+	if err != nil || creds == nil {
+		return false, err
+	}
+	auth := map[string]interface{}{
+		"rktKind":    "auth",
+		"rktVersion": "v1",
+		"domains":    []string{host},
+	}
+	if creds.token != "" {
+		auth["type"] = "oauth"
+		auth["credentials"] = map[string]string{"token": creds.token}
+	} else {
+		auth["type"] = "basic"
+		auth["credentials"] = map[string]string{"user": creds.user, "password": creds.password}
+	}
+	content, err := json.Marshal(auth)
+	if err != nil {
+		return false, errs.WithEF(err, data.WithField("host", host), "Failed to marshal rkt auth")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return false, errs.WithEF(err, data.WithField("path", dir), "Failed to create rkt auth directory")
+	}
+	file := filepath.Join(dir, "dgr-"+host+".json")
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) { // may be a link to a file of the user configuration
+		return false, errs.WithEF(err, data.WithField("file", file), "Failed to replace rkt auth")
+	}
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		return false, errs.WithEF(err, data.WithField("file", file), "Failed to write rkt auth")
+	}
+	return true, nil
+}
+
+func (auths Auths) credentials(host string) (*credentials, error) {
+	auth := auths.Match(host)
+	if auth == nil {
+		return nil, nil
+	}
+	host = strings.Split(host, ":")[0]
+	fields := data.WithField("host", host).WithField("type", auth.Type)
+
+	switch auth.Type {
+	case AuthTypeBasic:
+		return &credentials{user: auth.User, password: auth.Password}, nil
+	case AuthTypeBearer:
+		return &credentials{token: auth.Token}, nil
+	case AuthTypeCommand:
+		token, err := commandToken(auth.Command)
+		if err != nil {
+			return nil, errs.WithEF(err, fields, "Failed to get auth token from command")
+		}
+		return &credentials{token: token}, nil
+	case AuthTypeNetrc:
+		file := auth.Netrc
+		if file == "" {
+			file = "~/.netrc"
+		}
+		if strings.HasPrefix(file, "~/") {
+			file = filepath.Join(os.Getenv("HOME"), file[2:])
+		}
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) && len(auth.Hosts) == 0 {
+				return nil, nil
+			}
+			return nil, errs.WithEF(err, fields.WithField("file", file), "Failed to read netrc file")
+		}
+		user, password, ok := NetrcCredentials(string(source), host)
+		if !ok {
+			if len(auth.Hosts) == 0 {
+				return nil, nil
+			}
+			return nil, errs.WithF(fields.WithField("file", file), "No machine for host in netrc file")
+		}
+		return &credentials{user: user, password: password}, nil
+	}
+	return nil, errs.WithF(fields, "Unknown auth type")
+}
+
+// commandToken runs the command once per dgr run. It is not logged, as it may hold secrets.
+func commandToken(command string) (string, error) {
+	commandTokens.Lock()
+	defer commandTokens.Unlock()
+	if token, ok := commandTokens.tokens[command]; ok {
+		return token, nil
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return "", errs.With("Auth command printed no token")
+	}
+	commandTokens.tokens[command] = token
+	return token, nil
+}
+
+// NetrcCredentials returns login and password of the machine, or of the default entry
+func NetrcCredentials(content string, host string) (string, string, bool) {
+	var user, password string
+	var defaultUser, defaultPassword string
+	found, hasDefault := false, false
+	current := ""
+
+	fields := strings.Fields(content)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if found {
+				return user, password, true
+			}
+			if i+1 < len(fields) {
+				i++
+				current = fields[i]
+				found = current == host
+			}
+		case "default":
+			if found {
+				return user, password, true
+			}
+			current, hasDefault = "", true
+		case "login", "password":
+			if i+1 >= len(fields) {
+				break
+			}
+			key := fields[i]
+			i++
+			switch {
+			case found && key == "login":
+				user = fields[i]
+			case found:
+				password = fields[i]
+			case current == "" && hasDefault && key == "login":
+				defaultUser = fields[i]
+			case current == "" && hasDefault:
+				defaultPassword = fields[i]
+			}
+		case "macdef":
+			// macro definitions end with an empty line, not kept by Fields
+			for i+1 < len(fields) && fields[i+1] != "machine" && fields[i+1] != "default" {
+				i++
+			}
+		}
+	}
+	if found {
+		return user, password, true
+	}
+	if hasDefault {
+		return defaultUser, defaultPassword, true
+	}
+	return "", "", false
+}
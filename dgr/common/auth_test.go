@@ -0,0 +1,120 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestAuthValidate(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(AuthConfig{Hosts: []string{"aci.example.com"}, Type: AuthTypeBasic, User: "user"}.Validate()).To(Succeed())
+	Expect(AuthConfig{Type: AuthTypeNetrc}.Validate()).To(Succeed())
+	Expect(AuthConfig{Type: AuthTypeBearer, Token: "token"}.Validate()).NotTo(Succeed())
+	Expect(AuthConfig{Hosts: []string{"aci.example.com"}, Type: AuthTypeBearer}.Validate()).NotTo(Succeed())
+	Expect(AuthConfig{Hosts: []string{"aci.example.com"}, Type: AuthTypeCommand}.Validate()).NotTo(Succeed())
+	Expect(AuthConfig{Hosts: []string{"aci.example.com"}, Type: "digest"}.Validate()).NotTo(Succeed())
+
+	redacted := AuthConfig{Type: AuthTypeBasic, User: "user", Password: "secret"}.Redacted()
+	Expect(redacted.User).To(Equal("user"))
+	Expect(redacted.Password).To(Equal("<redacted>"))
+}
+
+func TestAuthHeader(t *testing.T) {
+	RegisterTestingT(t)
+
+	auths := Auths{
+		{Hosts: []string{"*.example.com"}, Type: AuthTypeBasic, User: "user", Password: "pass"},
+		{Hosts: []string{"aci.example.com"}, Type: AuthTypeBearer, Token: "token"},
+		{Hosts: []string{"cmd.example.org"}, Type: AuthTypeCommand, Command: "echo ' generated '"},
+	}
+
+	header, err := auths.Header("aci.example.com:443")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(header.Get("Authorization")).To(Equal("Bearer token"))
+
+	header, err = auths.Header("other.example.com")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(header.Get("Authorization")).To(Equal("Basic dXNlcjpwYXNz"))
+
+	header, err = auths.Header("cmd.example.org")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(header.Get("Authorization")).To(Equal("Bearer generated"))
+
+	header, err = auths.Header("example.net")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(header).To(BeNil())
+
+	headers, err := auths.HostHeaders("aci.example.com", "example.net")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(headers).To(HaveLen(1))
+
+	req, _ := http.NewRequest("GET", "https://aci.example.com/aci", nil)
+	Expect(auths.SetHeader(req)).To(BeTrue())
+	Expect(req.Header.Get("Authorization")).To(Equal("Bearer token"))
+
+	_, err = Auths{{Hosts: []string{"example.net"}, Type: AuthTypeCommand, Command: "exit 1"}}.Header("example.net")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestAuthNetrc(t *testing.T) {
+	RegisterTestingT(t)
+
+	content := `machine aci.example.com login user password pass
+macdef init
+cd /tmp
+
+machine other.example.com
+  login other
+  password secret
+default login anonymous password guest
+`
+	user, password, ok := NetrcCredentials(content, "other.example.com")
+	Expect(ok).To(BeTrue())
+	Expect(user).To(Equal("other"))
+	Expect(password).To(Equal("secret"))
+
+	user, _, ok = NetrcCredentials(content, "aci.example.com")
+	Expect(ok).To(BeTrue())
+	Expect(user).To(Equal("user"))
+
+	user, _, ok = NetrcCredentials(content, "example.net")
+	Expect(ok).To(BeTrue())
+	Expect(user).To(Equal("anonymous"))
+
+	_, _, ok = NetrcCredentials("machine aci.example.com login user password pass", "example.net")
+	Expect(ok).To(BeFalse())
+
+	file, _ := ioutil.TempFile("", "netrc")
+	defer os.Remove(file.Name())
+	file.WriteString(content)
+	file.Close()
+
+	header, err := Auths{{Type: AuthTypeNetrc, Netrc: file.Name()}}.Header("aci.example.com")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(header.Get("Authorization")).To(Equal("Basic dXNlcjpwYXNz"))
+}
+
+func TestAuthWriteRktAuth(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "auth")
+	defer os.RemoveAll(dir)
+
+	auths := Auths{{Hosts: []string{"aci.example.com"}, Type: AuthTypeBearer, Token: "token"}}
+	Expect(auths.WriteRktAuth(dir, "example.net")).To(BeFalse())
+	Expect(auths.WriteRktAuth(dir, "aci.example.com")).To(BeTrue())
+
+	content, err := ioutil.ReadFile(dir + "/dgr-aci.example.com.json")
+	Expect(err).NotTo(HaveOccurred())
+	var auth map[string]interface{}
+	Expect(json.Unmarshal(content, &auth)).To(Succeed())
+	Expect(auth["type"]).To(Equal("oauth"))
+	Expect(auth["domains"]).To(Equal([]interface{}{"aci.example.com"}))
+	Expect(auth["credentials"]).To(Equal(map[string]interface{}{"token": "token"}))
+}
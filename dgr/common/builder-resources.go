@@ -0,0 +1,87 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const EnvBuilderResources = "BUILDER_RESOURCES"
+
+type BuilderResources struct {
+	Memory    string `json:"memory,omitempty" yaml:"memory,omitempty"`
+	CPUShares int    `json:"cpuShares,omitempty" yaml:"cpuShares,omitempty"`
+	CPUQuota  string `json:"cpuQuota,omitempty" yaml:"cpuQuota,omitempty"`
+	Pids      int    `json:"pids,omitempty" yaml:"pids,omitempty"`
+	TmpSize   string `json:"tmpSize,omitempty" yaml:"tmpSize,omitempty"`
+}
+
+func (r BuilderResources) IsEmpty() bool {
+	return r == BuilderResources{}
+}
+
+// WithDefaults fills unset limits from the given defaults
+func (r BuilderResources) WithDefaults(defaults BuilderResources) BuilderResources {
+	if r.Memory == "" {
+		r.Memory = defaults.Memory
+	}
+	if r.CPUShares == 0 {
+		r.CPUShares = defaults.CPUShares
+	}
+	if r.CPUQuota == "" {
+		r.CPUQuota = defaults.CPUQuota
+	}
+	if r.Pids == 0 {
+		r.Pids = defaults.Pids
+	}
+	if r.TmpSize == "" {
+		r.TmpSize = defaults.TmpSize
+	}
+	return r
+}
+
+func (r BuilderResources) ToIsolators() (types.Isolators, error) {
+	fields := data.WithField("resources", r)
+	isolators := types.Isolators{}
+
+	if r.Memory != "" {
+		memory, err := types.NewResourceMemoryIsolator(r.Memory, r.Memory)
+		if err != nil {
+			return nil, errs.WithEF(err, fields, "Invalid memory limit")
+		}
+		isolators = append(isolators, memory.AsIsolator())
+	}
+
+	if r.CPUQuota != "" {
+		millis, err := r.CPUQuotaMillis()
+		if err != nil {
+			return nil, err
+		}
+		cpu, err := types.NewResourceCPUIsolator(millis, millis)
+		if err != nil {
+			return nil, errs.WithEF(err, fields, "Invalid cpu quota")
+		}
+		isolators = append(isolators, cpu.AsIsolator())
+	}
+
+	if r.CPUShares != 0 {
+		shares, err := types.NewLinuxCPUShares(r.CPUShares)
+		if err != nil {
+			return nil, errs.WithEF(err, fields, "Invalid cpu shares")
+		}
+		isolators = append(isolators, shares.AsIsolator())
+	}
+	return isolators, nil
+}
+
+/* 150% -> 1500m */
+func (r BuilderResources) CPUQuotaMillis() (string, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(r.CPUQuota, "%"), 64)
+	if err != nil || percent <= 0 {
+		return "", errs.WithEF(err, data.WithField("cpuQuota", r.CPUQuota), "Cpu quota must be a percentage of one cpu like 150%")
+	}
+	return strconv.Itoa(int(percent*10)) + "m", nil
+}
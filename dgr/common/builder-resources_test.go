@@ -0,0 +1,24 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestBuilderResources(t *testing.T) {
+	RegisterTestingT(t)
+
+	res := BuilderResources{Memory: "1G"}.WithDefaults(BuilderResources{Memory: "2G", Pids: 100})
+	Expect(res.Memory).To(Equal("1G"))
+	Expect(res.Pids).To(Equal(100))
+	Expect(BuilderResources{}.IsEmpty()).To(BeTrue())
+
+	Expect(BuilderResources{CPUQuota: "150%"}.CPUQuotaMillis()).To(Equal("1500m"))
+	_, err := BuilderResources{CPUQuota: "lot"}.CPUQuotaMillis()
+	Expect(err).To(HaveOccurred())
+
+	isolators, err := BuilderResources{Memory: "512M", CPUQuota: "50%", CPUShares: 512}.ToIsolators()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(isolators).To(HaveLen(3))
+}
@@ -0,0 +1,191 @@
+package common
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const PathCheckpoints = "/checkpoints"
+const pathCheckpointsJson = "/checkpoints.json"
+
+const EnvBuilderResume = "BUILDER_RESUME"
+const EnvBuilderCheckpoint = "BUILDER_CHECKPOINT"
+
+// EnvBuildStep tells builder.sh to run only this step
+const EnvBuildStep = "DGR_BUILD_STEP"
+
+type BuildStep string
+
+const (
+	BuildStepInheritBuildEarly BuildStep = "inherit-build-early"
+	BuildStepBuilder           BuildStep = "builder"
+	BuildStepBuild             BuildStep = "build"
+	BuildStepFiles             BuildStep = "files"
+	BuildStepBuildLate         BuildStep = "build-late"
+)
+
+// BuildSteps are the steps of builder.sh, in order
+var BuildSteps = []BuildStep{
+	BuildStepInheritBuildEarly,
+	BuildStepBuilder,
+	BuildStepBuild,
+	BuildStepFiles,
+	BuildStepBuildLate,
+}
+
+// Inputs are the project's directories copied or run by the step. The builder step gets the whole project, as
+// builder runlevels compile from sources anywhere in it, without the inputs of other steps.
+func (s BuildStep) Inputs() []string {
+	switch s {
+	case BuildStepBuilder:
+		return []string{"/"}
+	case BuildStepBuild:
+		return []string{"/runlevels/build", "/runlevels/inherit-build-early", "/runlevels/inherit-build-late"}
+	case BuildStepFiles:
+		return []string{"/runlevels/prestart-early", "/runlevels/prestart-late", "/attributes", "/files", "/templates"}
+	case BuildStepBuildLate:
+		return []string{"/runlevels/build-late"}
+	default:
+		return []string{}
+	}
+}
+
+type Checkpoint struct {
+	Step BuildStep `json:"step"`
+	Key  string    `json:"key"`
+}
+
+// Checkpoints are the steps completed by the last build, in order
+type Checkpoints []Checkpoint
+
+func LoadCheckpoints(dir string) (Checkpoints, error) {
+	checkpoints := Checkpoints{}
+	content, err := ioutil.ReadFile(dir + pathCheckpointsJson)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkpoints, nil
+		}
+		return nil, errs.WithEF(err, data.WithField("path", dir), "Failed to read checkpoints")
+	}
+	if err := json.Unmarshal(content, &checkpoints); err != nil {
+		return nil, errs.WithEF(err, data.WithField("content", string(content)), "Failed to unmarshal checkpoints")
+	}
+	return checkpoints, nil
+}
+
+func (c Checkpoints) Save(dir string) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errs.WithEF(err, data.WithField("checkpoints", c), "Failed to marshal checkpoints")
+	}
+	if err := ioutil.WriteFile(dir+pathCheckpointsJson, content, 0644); err != nil {
+		return errs.WithEF(err, data.WithField("path", dir), "Failed to write checkpoints")
+	}
+	return nil
+}
+
+// ResumeIndex is the index in BuildSteps of the first step that failed or whose inputs changed since its checkpoint
+func (c Checkpoints) ResumeIndex(keys []string) int {
+	for i := range keys {
+		if i >= len(c) || c[i].Step != BuildSteps[i] || c[i].Key != keys[i] {
+			return i
+		}
+	}
+	return len(keys)
+}
+
+// BuildStepKeys fingerprints the inputs of each step. A key includes the previous one, since a step
+// depends on the result of all steps before it. The version is not part of it, as it changes on each pod build,
+// so neither is the manifest file nor the target directory written by the build.
+func BuildStepKeys(aciPath string, targetPath string, manifestTmpl string) ([]string, error) {
+	manifest, err := ProcessManifestTemplate(manifestTmpl, nil, false)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("content", manifestTmpl), "Failed to process manifest template")
+	}
+	manifest.NameAndVersion = *NewACFullName(manifest.NameAndVersion.Name())
+	manifestContent, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("manifest", manifest), "Failed to marshal manifest")
+	}
+
+	skipped := []string{filepath.Clean(aciPath + PathAciManifest), filepath.Clean(targetPath)}
+	for _, step := range BuildSteps {
+		if step == BuildStepBuilder {
+			continue
+		}
+		for _, input := range step.Inputs() {
+			skipped = append(skipped, filepath.Clean(aciPath+input))
+		}
+	}
+
+	keys := []string{}
+	sum := sha1.Sum(manifestContent)
+	previous := hex.EncodeToString(sum[:])
+	for _, step := range BuildSteps {
+		h := sha1.New()
+		io.WriteString(h, previous)
+		for _, input := range step.Inputs() {
+			if err := hashTree(h, filepath.Clean(aciPath+input), skipped); err != nil {
+				return nil, errs.WithEF(err, data.WithField("step", step), "Failed to fingerprint step inputs")
+			}
+		}
+		previous = hex.EncodeToString(h.Sum(nil))
+		keys = append(keys, previous)
+	}
+	return keys, nil
+}
+
+// hashTree writes the content of the tree, without the skipped paths other than root
+func hashTree(w io.Writer, root string, skipped []string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		if path != root && containsPath(skipped, path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// permissions are not part of the key since scripts are set executable when run
+		rel, _ := filepath.Rel(root, path)
+		io.WriteString(w, rel+"\x00"+(info.Mode()&os.ModeType).String()+"\x00")
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			io.WriteString(w, target)
+		} else if info.Mode().IsRegular() {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(w, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestBuildStepKeys(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "dgr-aci")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir+"/runlevels/build-late", 0755)
+
+	keys, err := BuildStepKeys(dir, dir+"/target", "name: example.com/aci:1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(keys).To(HaveLen(len(BuildSteps)))
+
+	otherVersion, _ := BuildStepKeys(dir, dir+"/target", "name: example.com/aci:2")
+	Expect(otherVersion).To(Equal(keys))
+
+	ioutil.WriteFile(dir+"/runlevels/build-late/10.late.sh", []byte("echo"), 0644)
+	changed, _ := BuildStepKeys(dir, dir+"/target", "name: example.com/aci:1")
+	Expect(changed[:4]).To(Equal(keys[:4]))
+	Expect(changed[4]).NotTo(Equal(keys[4]))
+
+	os.MkdirAll(dir+"/target/checkpoints", 0755)
+	ioutil.WriteFile(dir+"/target/checkpoints/checkpoints.json", []byte("[]"), 0644)
+	ioutil.WriteFile(dir+"/aci-manifest.yml", []byte("name: example.com/aci:3"), 0644)
+	written, _ := BuildStepKeys(dir, dir+"/target", "name: example.com/aci:1")
+	Expect(written).To(Equal(changed))
+
+	os.MkdirAll(dir+"/src", 0755)
+	ioutil.WriteFile(dir+"/src/main.c", []byte("int main() {}"), 0644)
+	source, _ := BuildStepKeys(dir, dir+"/target", "name: example.com/aci:1")
+	Expect(source[:1]).To(Equal(keys[:1]))
+	Expect(source[1]).NotTo(Equal(changed[1]))
+
+	checkpoints := Checkpoints{}
+	for i, step := range BuildSteps[:4] {
+		checkpoints = append(checkpoints, Checkpoint{Step: step, Key: keys[i]})
+	}
+	Expect(checkpoints.ResumeIndex(changed)).To(Equal(4))
+	Expect(checkpoints[:1].ResumeIndex(changed)).To(Equal(1))
+	Expect(Checkpoints{}.ResumeIndex(changed)).To(Equal(0))
+}
@@ -10,6 +10,7 @@ const PathManifest = "/manifest"
 const PathRootfs = "/rootfs"
 const PathAciManifest = "/aci-manifest.yml"
 const PathManifestYmlTmpl = "/aci-manifest.yml.tmpl"
+const PathAciManifestLock = "/aci-manifest.lock"
 
 const EnvDgrVersion = "DGR_VERSION"
 const EnvAciPath = "ACI_PATH"
@@ -21,14 +22,27 @@ const EnvCatchOnStep = "CATCH_ON_STEP"
 const EnvBuilderCommand = "BUILDER_COMMAND"
 const PrefixBuilder = "builder/"
 
+const NetworkHost = "host"
+const NetworkNone = "none"
+
 type BuilderCommand string
 
 const (
 	CommandBuild BuilderCommand = "build"
 	CommandInit  BuilderCommand = "init"
 	CommandTry   BuilderCommand = "try"
+	CommandShell BuilderCommand = "shell"
 )
 
+const EnvShellStage = "DGR_SHELL_STAGE"
+const EnvShellRunlevel = "DGR_SHELL_RUNLEVEL"
+
+const ShellStageBuilder = "builder"
+const ShellStageRootfs = "rootfs"
+
+// ShellRunlevels can be run alone before opening a shell
+var ShellRunlevels = []string{"inherit-build-early", "builder", "build", "build-late", "inherit-build-late"}
+
 func (b BuilderCommand) CommandManifestKey() (string, error) {
 	switch b {
 	case CommandBuild:
@@ -37,6 +51,8 @@ func (b BuilderCommand) CommandManifestKey() (string, error) {
 		return "blablacar.github.io/dgr/stage1/init", nil
 	case CommandTry:
 		return "blablacar.github.io/dgr/stage1/try", nil
+	case CommandShell:
+		return "blablacar.github.io/dgr/stage1/shell", nil
 	default:
 		return "", errs.WithF(data.WithField("command", b), "Unimplemented command manifest key")
 	}
@@ -0,0 +1,119 @@
+package common
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// YamlMapGet returns the value at the path of keys in a yaml document read as a MapSlice
+func YamlMapGet(m yaml.MapSlice, path ...string) (interface{}, bool) {
+	if len(path) == 0 {
+		return m, true
+	}
+	for _, item := range m {
+		if item.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return item.Value, true
+		}
+		child, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, false
+		}
+		return YamlMapGet(child, path[1:]...)
+	}
+	return nil, false
+}
+
+// YamlMapSet sets the value at the path of keys, creating missing maps and keeping the order of existing keys
+func YamlMapSet(m yaml.MapSlice, value interface{}, path ...string) yaml.MapSlice {
+	if len(path) == 0 {
+		return m
+	}
+	for i, item := range m {
+		if item.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			m[i].Value = value
+		} else {
+			child, _ := item.Value.(yaml.MapSlice)
+			m[i].Value = YamlMapSet(child, value, path[1:]...)
+		}
+		return m
+	}
+	if len(path) == 1 {
+		return append(m, yaml.MapItem{Key: path[0], Value: value})
+	}
+	return append(m, yaml.MapItem{Key: path[0], Value: YamlMapSet(nil, value, path[1:]...)})
+}
+
+// YamlMapUnset removes the value at the path of keys, and maps left empty
+func YamlMapUnset(m yaml.MapSlice, path ...string) yaml.MapSlice {
+	if len(path) == 0 {
+		return m
+	}
+	for i, item := range m {
+		if item.Key != path[0] {
+			continue
+		}
+		if len(path) > 1 {
+			child, ok := item.Value.(yaml.MapSlice)
+			if !ok {
+				return m
+			}
+			child = YamlMapUnset(child, path[1:]...)
+			if len(child) > 0 {
+				m[i].Value = child
+				return m
+			}
+		}
+		return append(m[:i], m[i+1:]...)
+	}
+	return m
+}
+
+// YamlMapMerge merges the overlay on the base, maps being merged and other values replaced.
+// The path of each value set by the overlay is given to set.
+func YamlMapMerge(base yaml.MapSlice, overlay yaml.MapSlice, set func(path []string)) yaml.MapSlice {
+	return yamlMapMerge(base, overlay, nil, set)
+}
+
+func yamlMapMerge(base yaml.MapSlice, overlay yaml.MapSlice, prefix []string, set func(path []string)) yaml.MapSlice {
+	for _, item := range overlay {
+		key := fmt.Sprint(item.Key)
+		path := append(append([]string{}, prefix...), key)
+		current, _ := YamlMapGet(base, key)
+		currentMap, currentIsMap := current.(yaml.MapSlice)
+		overlayMap, overlayIsMap := item.Value.(yaml.MapSlice)
+		if currentIsMap && overlayIsMap {
+			base = YamlMapSet(base, yamlMapMerge(currentMap, overlayMap, path, set), key)
+			continue
+		}
+		base = YamlMapSet(base, item.Value, key)
+		if overlayIsMap {
+			yamlMapLeaves(overlayMap, path, func(leaf []string, value interface{}) { set(leaf) })
+		} else {
+			set(path)
+		}
+	}
+	return base
+}
+
+// YamlMapLeaves calls fn for each value that is not a map, lists being values
+func YamlMapLeaves(m yaml.MapSlice, fn func(path []string, value interface{})) {
+	yamlMapLeaves(m, nil, fn)
+}
+
+func yamlMapLeaves(m yaml.MapSlice, prefix []string, fn func(path []string, value interface{})) {
+	for _, item := range m {
+		path := append(append([]string{}, prefix...), fmt.Sprint(item.Key))
+		if child, ok := item.Value.(yaml.MapSlice); ok {
+			yamlMapLeaves(child, path, fn)
+			continue
+		}
+		fn(path, item.Value)
+	}
+}
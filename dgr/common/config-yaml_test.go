@@ -0,0 +1,72 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+func TestYamlMapGetAndSet(t *testing.T) {
+	RegisterTestingT(t)
+
+	var config yaml.MapSlice
+	Expect(yaml.Unmarshal([]byte("targetWorkDir: /tmp\nrkt:\n  path: /bin/rkt\n"), &config)).To(Succeed())
+
+	value, ok := YamlMapGet(config, "rkt", "path")
+	Expect(ok).To(BeTrue())
+	Expect(value).To(Equal("/bin/rkt"))
+	_, ok = YamlMapGet(config, "rkt", "dir")
+	Expect(ok).To(BeFalse())
+	_, ok = YamlMapGet(config, "targetWorkDir", "sub")
+	Expect(ok).To(BeFalse())
+
+	config = YamlMapSet(config, "/var/lib/rkt", "rkt", "dir")
+	config = YamlMapSet(config, "/usr/bin/rkt", "rkt", "path")
+	config = YamlMapSet(config, "4G", "builder", "resources", "memory")
+	out, _ := yaml.Marshal(config)
+	Expect(string(out)).To(Equal("targetWorkDir: /tmp\nrkt:\n  path: /usr/bin/rkt\n  dir: /var/lib/rkt\nbuilder:\n  resources:\n    memory: 4G\n"))
+}
+
+func TestYamlMapUnset(t *testing.T) {
+	RegisterTestingT(t)
+
+	var config yaml.MapSlice
+	Expect(yaml.Unmarshal([]byte("rkt:\n  path: /bin/rkt\n  dir: /var\nbuilder:\n  resources:\n    memory: 4G\n"), &config)).To(Succeed())
+
+	config = YamlMapUnset(config, "rkt", "path")
+	config = YamlMapUnset(config, "builder", "resources", "memory")
+	config = YamlMapUnset(config, "unknown", "key")
+	out, _ := yaml.Marshal(config)
+	Expect(string(out)).To(Equal("rkt:\n  dir: /var\n"))
+}
+
+func TestYamlMapMerge(t *testing.T) {
+	RegisterTestingT(t)
+
+	var base, overlay yaml.MapSlice
+	Expect(yaml.Unmarshal([]byte("rkt:\n  path: /bin/rkt\n  insecureOptions: [image]\ntargetWorkDir: /tmp\n"), &base)).To(Succeed())
+	Expect(yaml.Unmarshal([]byte("rkt:\n  insecureOptions: [http]\nbuilder:\n  resources:\n    memory: 4G\n"), &overlay)).To(Succeed())
+
+	set := []string{}
+	merged := YamlMapMerge(base, overlay, func(path []string) {
+		set = append(set, strings.Join(path, "."))
+	})
+	out, _ := yaml.Marshal(merged)
+	Expect(string(out)).To(Equal("rkt:\n  path: /bin/rkt\n  insecureOptions:\n  - http\ntargetWorkDir: /tmp\nbuilder:\n  resources:\n    memory: 4G\n"))
+	Expect(set).To(Equal([]string{"rkt.insecureOptions", "builder.resources.memory"}))
+}
+
+func TestYamlMapLeaves(t *testing.T) {
+	RegisterTestingT(t)
+
+	var config yaml.MapSlice
+	Expect(yaml.Unmarshal([]byte("rkt:\n  path: /bin/rkt\nsign:\n- disabled: true\n"), &config)).To(Succeed())
+
+	leaves := []string{}
+	YamlMapLeaves(config, func(path []string, value interface{}) {
+		leaves = append(leaves, strings.Join(path, "."))
+	})
+	Expect(leaves).To(Equal([]string{"rkt.path", "sign"}))
+}
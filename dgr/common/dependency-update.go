@@ -0,0 +1,23 @@
+package common
+
+import (
+	"regexp"
+)
+
+// ReplaceDependencyVersion rewrites the version of a dependency in the text of a manifest, returning the number of
+// replacements. Only the name:version is changed, so comments and formatting are kept.
+func ReplaceDependencyVersion(content string, dep ACFullname, version string) (string, int) {
+	if dep.Version() == "" || dep.Version() == version {
+		return content, 0
+	}
+	pattern := regexp.MustCompile(`(^|[\s"'\[,])` + regexp.QuoteMeta(dep.String()) + `($|[\s"'\],#])`)
+	count := 0
+	for { // separators are consumed, so neighbours of a flow list need another pass
+		matches := len(pattern.FindAllStringIndex(content, -1))
+		if matches == 0 {
+			return content, count
+		}
+		content = pattern.ReplaceAllString(content, "${1}"+dep.Name()+":"+version+"${2}")
+		count += matches
+	}
+}
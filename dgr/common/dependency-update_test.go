@@ -0,0 +1,35 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestReplaceDependencyVersion(t *testing.T) {
+	RegisterTestingT(t)
+
+	manifest := `name: aci.example.com/aci-app:1.0
+aci:
+  dependencies:
+    - aci.example.com/aci-base:1.2   # base image
+    - "aci.example.com/aci-base:1.20"
+    - aci.example.com/aci-base-tools:1.2
+builder:
+  dependencies: [aci.example.com/aci-base:1.2,aci.example.com/aci-base:1.2]
+`
+	updated, count := ReplaceDependencyVersion(manifest, *NewACFullName("aci.example.com/aci-base:1.2"), "1.3")
+	Expect(count).To(Equal(3))
+	Expect(updated).To(Equal(`name: aci.example.com/aci-app:1.0
+aci:
+  dependencies:
+    - aci.example.com/aci-base:1.3   # base image
+    - "aci.example.com/aci-base:1.20"
+    - aci.example.com/aci-base-tools:1.2
+builder:
+  dependencies: [aci.example.com/aci-base:1.3,aci.example.com/aci-base:1.3]
+`))
+
+	_, count = ReplaceDependencyVersion(manifest, *NewACFullName("aci.example.com/aci-other:1.2"), "1.3")
+	Expect(count).To(Equal(0))
+}
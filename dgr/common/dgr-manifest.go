@@ -46,9 +46,11 @@ type MountInfo struct {
 }
 
 type BuilderDefinition struct {
-	Image        ACFullname   `json:"image,omitempty" yaml:"image,omitempty"`
-	Dependencies []ACFullname `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
-	MountPoints  []MountInfo  `json:"mountPoints,omitempty" yaml:"mountPoints,omitempty"`
+	Image        ACFullname       `json:"image,omitempty" yaml:"image,omitempty"`
+	Dependencies []ACFullname     `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	MountPoints  []MountInfo      `json:"mountPoints,omitempty" yaml:"mountPoints,omitempty"`
+	Network      string           `json:"network,omitempty" yaml:"network,omitempty"`
+	Resources    BuilderResources `json:"resources,omitempty" yaml:"resources,omitempty"`
 }
 
 type BuildDefinition struct {
@@ -63,6 +65,7 @@ type AciManifest struct {
 	Build          BuildDefinition   `json:"build,omitempty" yaml:"build,omitempty"`
 	Aci            AciDefinition     `json:"aci,omitempty" yaml:"aci,omitempty"`
 	Tester         TestManifest      `json:"tester,omitempty" yaml:"tester,omitempty"`
+	Lock           *LockFile         `json:"-" yaml:"-"` // image ids of dependencies, set by LockFile.Apply
 }
 
 type TestManifest struct {
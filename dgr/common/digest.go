@@ -0,0 +1,56 @@
+package common
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// DigestHeader is the RFC 3230 instance digest header, as 'sha-512=<base64>'
+const DigestHeader = "Digest"
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// Digest returns the sha-512 digest of the content, as a Digest header value
+func Digest(r io.Reader) (string, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", errs.WithE(err, "Failed to read content to digest")
+	}
+	return "sha-512=" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// CheckDigest compares the content with the first supported digest of the header.
+// It returns false when no digest can be checked.
+func CheckDigest(header string, r io.Reader) (bool, error) {
+	for _, instance := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(instance), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		newHash, ok := digestAlgorithms[strings.ToLower(parts[0])]
+		if !ok {
+			continue
+		}
+
+		h := newHash()
+		if _, err := io.Copy(h, r); err != nil {
+			return false, errs.WithE(err, "Failed to read content to digest")
+		}
+		if sum := base64.StdEncoding.EncodeToString(h.Sum(nil)); sum != parts[1] {
+			return true, errs.WithF(data.WithField("expected", parts[1]).WithField("actual", sum).
+				WithField("algorithm", parts[0]), "Digest mismatch")
+		}
+		return true, nil
+	}
+	return false, nil
+}
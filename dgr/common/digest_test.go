@@ -0,0 +1,38 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDigest(t *testing.T) {
+	RegisterTestingT(t)
+
+	digest, err := Digest(strings.NewReader("content"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(digest).To(HavePrefix("sha-512="))
+
+	checked, err := CheckDigest(digest, strings.NewReader("content"))
+	Expect(checked).To(BeTrue())
+	Expect(err).NotTo(HaveOccurred())
+
+	checked, err = CheckDigest(digest, strings.NewReader("other"))
+	Expect(checked).To(BeTrue())
+	Expect(err).To(HaveOccurred())
+}
+
+func TestCheckDigestAlgorithms(t *testing.T) {
+	RegisterTestingT(t)
+
+	content := []byte("content")
+	checked, err := CheckDigest("MD5=mgNkuembtIDdJeHwKEyFVQ==, SHA-256=7XACtDnprIRfIjV9giusFERzD722AW0+yUMil7nsn3M=", bytes.NewReader(content))
+	Expect(checked).To(BeTrue())
+	Expect(err).NotTo(HaveOccurred())
+
+	checked, err = CheckDigest("md5=mgNkuembtIDdJeHwKEyFVQ==", bytes.NewReader(content))
+	Expect(checked).To(BeFalse())
+	Expect(err).NotTo(HaveOccurred())
+}
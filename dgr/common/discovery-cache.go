@@ -0,0 +1,124 @@
+package common
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const defaultDiscoveryCacheTtl = time.Hour
+
+// DiscoveryConfig tunes network lookups of discovery endpoints and latest versions
+type DiscoveryConfig struct {
+	Offline  bool   `yaml:"offline,omitempty"`  // use only the cache and the rkt store
+	CacheTtl string `yaml:"cacheTtl,omitempty"` // duration, 0 to disable the cache
+}
+
+func (c DiscoveryConfig) Validate() error {
+	_, err := c.Ttl()
+	return err
+}
+
+func (c DiscoveryConfig) Ttl() (time.Duration, error) {
+	if c.CacheTtl == "" {
+		return defaultDiscoveryCacheTtl, nil
+	}
+	fields := data.WithField("cacheTtl", c.CacheTtl)
+	ttl, err := time.ParseDuration(c.CacheTtl)
+	if err != nil {
+		return 0, errs.WithEF(err, fields, "Invalid discovery cache ttl")
+	}
+	if ttl < 0 {
+		return 0, errs.WithF(fields, "Discovery cache ttl cannot be negative")
+	}
+	return ttl, nil
+}
+
+// DiscoveryCache keeps results of network lookups on disk, one json file per key
+type DiscoveryCache struct {
+	dir string
+	ttl time.Duration
+}
+
+type discoveryCacheEntry struct {
+	Key   string          `json:"key"`
+	Time  time.Time       `json:"time"`
+	Value json.RawMessage `json:"value"`
+}
+
+func NewDiscoveryCache(dir string, ttl time.Duration) DiscoveryCache {
+	return DiscoveryCache{dir: dir, ttl: ttl}
+}
+
+// Get reads the value of the key, telling if it was found.
+// Expired entries are read when expired is set, as in offline mode.
+func (c DiscoveryCache) Get(key string, value interface{}, expired bool) (bool, error) {
+	if c.ttl == 0 && !expired {
+		return false, nil
+	}
+	file := c.file(key)
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errs.WithEF(err, data.WithField("file", file), "Failed to read discovery cache")
+	}
+	var entry discoveryCacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil || entry.Key != key {
+		return false, nil // corrupted or colliding, looked up again
+	}
+	if !expired && time.Since(entry.Time) > c.ttl {
+		return false, nil
+	}
+	if err := json.Unmarshal(entry.Value, value); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c DiscoveryCache) Set(key string, value interface{}) error {
+	if c.ttl == 0 {
+		return nil
+	}
+	fields := data.WithField("key", key)
+	content, err := json.Marshal(value)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to marshal discovery cache value")
+	}
+	entry, err := json.Marshal(discoveryCacheEntry{Key: key, Time: time.Now(), Value: content})
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to marshal discovery cache entry")
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return errs.WithEF(err, fields.WithField("path", c.dir), "Failed to create discovery cache directory")
+	}
+
+	// written aside and renamed, as lookups run in parallel
+	tmp, err := ioutil.TempFile(c.dir, ".entry")
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to write discovery cache")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(entry); err != nil {
+		tmp.Close()
+		return errs.WithEF(err, fields, "Failed to write discovery cache")
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), c.file(key)); err != nil {
+		return errs.WithEF(err, fields, "Failed to write discovery cache")
+	}
+	return nil
+}
+
+func (c DiscoveryCache) file(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDiscoveryConfig(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(DiscoveryConfig{}.Ttl()).To(Equal(time.Hour))
+	Expect(DiscoveryConfig{CacheTtl: "10m"}.Ttl()).To(Equal(10 * time.Minute))
+	Expect(DiscoveryConfig{CacheTtl: "0"}.Ttl()).To(Equal(time.Duration(0)))
+	Expect(DiscoveryConfig{CacheTtl: "soon"}.Validate()).NotTo(Succeed())
+	Expect(DiscoveryConfig{CacheTtl: "-1h"}.Validate()).NotTo(Succeed())
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "discovery-cache")
+	defer os.RemoveAll(dir)
+
+	cache := NewDiscoveryCache(dir+"/cache", time.Hour)
+	var version string
+	Expect(cache.Get("latest:aci.example.com/aci-dummy", &version, false)).To(BeFalse())
+
+	Expect(cache.Set("latest:aci.example.com/aci-dummy", "1.2")).To(Succeed())
+	Expect(cache.Get("latest:aci.example.com/aci-dummy", &version, false)).To(BeTrue())
+	Expect(version).To(Equal("1.2"))
+	Expect(cache.Get("latest:aci.example.com/aci-other", &version, false)).To(BeFalse())
+
+	expired := NewDiscoveryCache(dir+"/cache", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	Expect(expired.Get("latest:aci.example.com/aci-dummy", &version, false)).To(BeFalse())
+	Expect(expired.Get("latest:aci.example.com/aci-dummy", &version, true)).To(BeTrue())
+
+	disabled := NewDiscoveryCache(dir+"/cache", 0)
+	Expect(disabled.Get("latest:aci.example.com/aci-dummy", &version, false)).To(BeFalse())
+	Expect(disabled.Set("latest:aci.example.com/aci-other", "2")).To(Succeed())
+	Expect(cache.Get("latest:aci.example.com/aci-other", &version, false)).To(BeFalse())
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"strings"
+)
+
+const domainMatchExact = 1 << 16
+
+// MatchDomain tells how specifically a domain pattern of the configuration matches a domain, 0 being no match.
+// A pattern is a domain, '*.example.com' for its sub-domains or '.example.com' for the domain and its sub-domains.
+// An exact match is more specific than any wildcard, the longest wildcard being the most specific.
+func MatchDomain(pattern string, domain string) int {
+	switch {
+	case pattern == domain:
+		return domainMatchExact + len(pattern)
+	case strings.HasPrefix(pattern, "*."):
+		if strings.HasSuffix(domain, pattern[1:]) {
+			return len(pattern)
+		}
+	case strings.HasPrefix(pattern, "."):
+		if domain == pattern[1:] || strings.HasSuffix(domain, pattern) {
+			return len(pattern)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMatchDomain(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(MatchDomain("example.com", "example.com")).To(BeNumerically(">", 0))
+	Expect(MatchDomain("example.com", "aci.example.com")).To(Equal(0))
+
+	Expect(MatchDomain("*.example.com", "aci.example.com")).To(BeNumerically(">", 0))
+	Expect(MatchDomain("*.example.com", "a.b.example.com")).To(BeNumerically(">", 0))
+	Expect(MatchDomain("*.example.com", "example.com")).To(Equal(0))
+	Expect(MatchDomain("*.example.com", "badexample.com")).To(Equal(0))
+
+	Expect(MatchDomain(".example.com", "example.com")).To(BeNumerically(">", 0))
+	Expect(MatchDomain(".example.com", "aci.example.com")).To(BeNumerically(">", 0))
+	Expect(MatchDomain(".example.com", "badexample.com")).To(Equal(0))
+
+	Expect(MatchDomain("aci.example.com", "aci.example.com")).To(BeNumerically(">", MatchDomain("*.example.com", "aci.example.com")))
+	Expect(MatchDomain("*.prod.example.com", "aci.prod.example.com")).To(BeNumerically(">", MatchDomain("*.example.com", "aci.prod.example.com")))
+}
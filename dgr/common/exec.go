@@ -2,9 +2,14 @@ package common
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/n0rad/go-erlog/logs"
 )
@@ -61,3 +66,112 @@ func ExecCmd(head string, parts ...string) error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// ExecCmdWithInput runs the command with the input as stdin
+func ExecCmdWithInput(input io.Reader, head string, parts ...string) error {
+	if logs.IsDebugEnabled() {
+		logs.WithField("command", strings.Join([]string{head, " ", strings.Join(parts, " ")}, " ")).Debug("Running external command")
+	}
+	cmd := exec.Command(head, parts...)
+	cmd.Stdin = input
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// ExecCmdWithOutput is ExecCmd with stdout and stderr sent to out
+func ExecCmdWithOutput(out io.Writer, head string, parts ...string) error {
+	if logs.IsDebugEnabled() {
+		logs.WithField("command", strings.Join([]string{head, " ", strings.Join(parts, " ")}, " ")).Debug("Running external command")
+	}
+	cmd := exec.Command(head, parts...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+// ExecCmdInteractive runs the command attached to the terminal
+func ExecCmdInteractive(head string, parts ...string) error {
+	if logs.IsDebugEnabled() {
+		logs.WithField("command", strings.Join([]string{head, " ", strings.Join(parts, " ")}, " ")).Debug("Running external command")
+	}
+	cmd := exec.Command(head, parts...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// process groups of the commands running in background, that do not receive signals of the terminal
+var processGroups = struct {
+	sync.Mutex
+	pids    map[int]bool
+	forward sync.Once
+}{pids: make(map[int]bool)}
+
+// ExecCmdContext runs the command in background, in its own process group, so the whole tree of processes it
+// started is terminated when the context is done. It is for commands running concurrently and not using the terminal.
+// SIGINT and SIGTERM received by dgr are forwarded to the group, which is also terminated if dgr dies.
+func ExecCmdContext(ctx context.Context, head string, parts ...string) error {
+	return execCmdContext(ctx, os.Stdout, os.Stderr, head, parts...)
+}
+
+// ExecCmdContextWithOutput is ExecCmdContext with stdout and stderr sent to out
+func ExecCmdContextWithOutput(ctx context.Context, out io.Writer, head string, parts ...string) error {
+	return execCmdContext(ctx, out, out, head, parts...)
+}
+
+func execCmdContext(ctx context.Context, stdout io.Writer, stderr io.Writer, head string, parts ...string) error {
+	if logs.IsDebugEnabled() {
+		logs.WithField("command", strings.Join([]string{head, " ", strings.Join(parts, " ")}, " ")).Debug("Running external command")
+	}
+	processGroups.forward.Do(forwardSignalsToProcessGroups)
+
+	cmd := exec.Command(head, parts...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGTERM}
+	processGroups.Lock()
+	if err := cmd.Start(); err != nil {
+		processGroups.Unlock()
+		return err
+	}
+	pid := cmd.Process.Pid
+	processGroups.pids[pid] = true
+	processGroups.Unlock()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-pid, syscall.SIGTERM)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	processGroups.Lock()
+	delete(processGroups.pids, pid)
+	processGroups.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// forwardSignalsToProcessGroups sends the first SIGINT or SIGTERM received to the running process groups,
+// then to dgr again with the default handling, to exit as without process groups
+func forwardSignalsToProcessGroups() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := (<-signals).(syscall.Signal)
+		processGroups.Lock() // kept, no other group is started while exiting
+		for pid := range processGroups.pids {
+			syscall.Kill(-pid, sig)
+		}
+		signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+		syscall.Kill(os.Getpid(), sig)
+	}()
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blablacar/dgr/bin-templater/template"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"gopkg.in/yaml.v2"
+)
+
+// PathInitTemplateYml describes an init template, it is not copied to the project
+const PathInitTemplateYml = "/template.yml"
+
+// files of an init template with this suffix are rendered with the init attributes, others are copied as is
+const ExtInitTemplate = ".init.tmpl"
+
+type InitTemplate struct {
+	Name        string `yaml:"-"`
+	Path        string `yaml:"-"`
+	Source      string `yaml:"-"`
+	Description string `yaml:"description,omitempty"`
+}
+
+func ReadInitTemplate(name string, path string, source string) (*InitTemplate, error) {
+	tmpl := &InitTemplate{Name: name, Path: path, Source: source}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Init template is not a directory")
+	}
+	content, err := ioutil.ReadFile(path + PathInitTemplateYml)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tmpl, nil
+		}
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to read init template description")
+	}
+	if err := yaml.Unmarshal(content, tmpl); err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to unmarshal init template description")
+	}
+	return tmpl, nil
+}
+
+// Render copies the template to the project directory, rendering files ending with ExtInitTemplate
+func (t *InitTemplate) Render(dst string, attributes map[string]interface{}) error {
+	fields := data.WithField("template", t.Name).WithField("path", t.Path)
+	return filepath.Walk(t.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(t.Path, path)
+		if rel == "." || "/"+rel == PathInitTemplateYml {
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(dst+"/"+rel, info.Mode())
+		}
+		if !strings.HasSuffix(rel, ExtInitTemplate) {
+			return CopyFile(path, dst+"/"+rel)
+		}
+
+		target := dst + "/" + strings.TrimSuffix(rel, ExtInitTemplate)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errs.WithEF(err, fields.WithField("file", rel), "Failed to read template file")
+		}
+		templating, err := template.NewTemplating(nil, path, string(content))
+		if err != nil {
+			return errs.WithEF(err, fields.WithField("file", rel), "Failed to load template file")
+		}
+		var b bytes.Buffer
+		if err := templating.Execute(&b, attributes); err != nil {
+			return errs.WithEF(err, fields.WithField("file", rel), "Failed to render template file")
+		}
+		b.WriteByte('\n') // removed by the templating cleanup
+		if bytes.Contains(b.Bytes(), []byte("<no value>")) {
+			return errs.WithF(fields.WithField("file", rel), "Rendering result have <no value>")
+		}
+		if err := ioutil.WriteFile(target, b.Bytes(), info.Mode()); err != nil {
+			return errs.WithEF(err, fields.WithField("file", target), "Failed to write rendered file")
+		}
+		return nil
+	})
+}
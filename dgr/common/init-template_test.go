@@ -0,0 +1,40 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestInitTemplateRender(t *testing.T) {
+	RegisterTestingT(t)
+
+	src, _ := ioutil.TempDir("", "dgr-init-template")
+	defer os.RemoveAll(src)
+	dst, _ := ioutil.TempDir("", "dgr-init")
+	defer os.RemoveAll(dst)
+
+	os.MkdirAll(src+"/templates/etc", 0755)
+	ioutil.WriteFile(src+PathInitTemplateYml, []byte("description: a service"), 0644)
+	ioutil.WriteFile(src+"/aci-manifest.yml"+ExtInitTemplate, []byte("name: {{ .domain }}/{{ .name }}:{{ .version }}"), 0644)
+	ioutil.WriteFile(src+"/templates/etc/app.conf.tmpl", []byte("port={{ .port }}"), 0644)
+
+	tmpl, err := ReadInitTemplate("service", src, "test")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(tmpl.Description).To(Equal("a service"))
+
+	err = tmpl.Render(dst, map[string]interface{}{"name": "aci-app", "domain": "example.com", "version": "1"})
+	Expect(err).NotTo(HaveOccurred())
+
+	manifest, _ := ioutil.ReadFile(dst + "/aci-manifest.yml")
+	Expect(string(manifest)).To(Equal("name: example.com/aci-app:1\n"))
+	runtimeTemplate, _ := ioutil.ReadFile(dst + "/templates/etc/app.conf.tmpl")
+	Expect(string(runtimeTemplate)).To(Equal("port={{ .port }}"))
+	_, err = os.Stat(dst + PathInitTemplateYml)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+
+	err = tmpl.Render(dst, map[string]interface{}{"name": "aci-app"})
+	Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const latestVersion = "latest"
+
+// LatestResolver finds the latest version of an image in a repository
+type LatestResolver interface {
+	LatestVersion(name ACFullname) (string, error)
+}
+
+// VersionPattern compiles a template, like PushArtifactTemplate, to a regexp matching the end of paths and capturing
+// {version}, starting with a digit. Other placeholders are rendered for the image.
+func VersionPattern(template string, name ACFullname, osName string, arch string, ext string) (*regexp.Regexp, error) {
+	if err := CheckVersionTemplate(template); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(template, "{version}")
+	replacer := strings.NewReplacer("{name}", name.Name(), "{os}", osName, "{arch}", arch, "{ext}", ext)
+	return regexp.Compile("(?:^|/)" + regexp.QuoteMeta(replacer.Replace(parts[0])) + "([0-9][^/]*)" +
+		regexp.QuoteMeta(replacer.Replace(parts[1])) + "/?$")
+}
+
+func CheckVersionTemplate(template string) error {
+	if strings.Count(template, "{version}") != 1 {
+		return errs.WithF(data.WithField("template", template), "Template must have {version} once")
+	}
+	return nil
+}
+
+// MatchVersions returns the versions of entries matching the pattern of VersionPattern
+func MatchVersions(pattern *regexp.Regexp, entries []string) []string {
+	versions := []string{}
+	for _, entry := range entries {
+		if match := pattern.FindStringSubmatch(entry); match != nil {
+			versions = append(versions, match[1])
+		}
+	}
+	return versions
+}
+
+// GreatestVersion returns the greatest of versions, 'latest' being ignored. It is empty without version.
+func GreatestVersion(versions []string) string {
+	greatest := ""
+	for _, version := range versions {
+		if version == "" || version == latestVersion {
+			continue
+		}
+		if greatest == "" || Version(greatest).LessThan(Version(version)) {
+			greatest = version
+		}
+	}
+	return greatest
+}
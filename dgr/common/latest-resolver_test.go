@@ -0,0 +1,58 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+type staticResolver string
+
+func (r staticResolver) LatestVersion(name ACFullname) (string, error) {
+	return string(r), nil
+}
+
+func TestVersionPattern(t *testing.T) {
+	RegisterTestingT(t)
+
+	name := *NewACFullName("aci.example.com/aci-dummy")
+	pattern, err := VersionPattern(PushArtifactTemplate, name, "linux", "amd64", ExtAci)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(MatchVersions(pattern, []string{
+		"aci.example.com/aci-dummy-1.2-linux-amd64.aci",
+		"aci.example.com/aci-dummy-1.10-3-linux-amd64.aci",
+		"aci.example.com/aci-dummy-1.10-3-linux-amd64.aci.asc",
+		"aci.example.com/aci-dummy-latest-linux-amd64.aci",
+		"aci.example.com/aci-dummy-other-1.3-linux-amd64.aci",
+		"aci.example.com/aci-dummy-1.4-linux-arm.aci",
+		"aci.example.com/aci-dummy/1.5-linux-amd64.aci",
+	})).To(Equal([]string{"1.2", "1.10-3"}))
+
+	pattern, err = VersionPattern("{version}", name, "linux", "amd64", ExtAci)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(MatchVersions(pattern, []string{"/aci/aci-dummy/1.0/", "/aci/aci-dummy/2.1", "/aci/", "/aci/aci-dummy/"})).
+		To(Equal([]string{"1.0", "2.1"}))
+
+	_, err = VersionPattern("{name}.{ext}", name, "linux", "amd64", ExtAci)
+	Expect(err).To(HaveOccurred())
+	Expect(CheckVersionTemplate("{version}/{version}")).NotTo(Succeed())
+}
+
+func TestGreatestVersion(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(GreatestVersion([]string{"1.2", "1.10", "latest", "1.9"})).To(Equal("1.10"))
+	Expect(GreatestVersion([]string{"latest"})).To(Equal(""))
+	Expect(GreatestVersion(nil)).To(Equal(""))
+}
+
+func TestFullyResolved(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(NewACFullName("aci.example.com/aci-dummy:1").FullyResolved(staticResolver("2"))).
+		To(Equal(NewACFullName("aci.example.com/aci-dummy:1")))
+	Expect(NewACFullName("aci.example.com/aci-dummy").FullyResolved(staticResolver("2"))).
+		To(Equal(NewACFullName("aci.example.com/aci-dummy:2")))
+	_, err := NewACFullName("aci.example.com/aci-dummy").FullyResolved(staticResolver(""))
+	Expect(err).To(HaveOccurred())
+}
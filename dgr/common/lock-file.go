@@ -0,0 +1,187 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/ghodss/yaml"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const lockFileHeader = "# Generated by dgr lock, do not edit\n"
+
+// LockedDependency pins a dependency, as written in the manifest, to a version and an image id
+type LockedDependency struct {
+	Name    ACFullname `json:"name"`
+	Version string     `json:"version"`
+	Id      string     `json:"id"` // sha512 image id
+}
+
+// LockFile records the resolved versions and image ids of the dependencies of a manifest
+type LockFile struct {
+	Dependencies []LockedDependency `json:"dependencies"`
+}
+
+// ReadLockFile reads a lock file, returning nil when it does not exist
+func ReadLockFile(file string) (*LockFile, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errs.WithEF(err, data.WithField("file", file), "Failed to read lock file")
+	}
+	lock := &LockFile{}
+	if err := yaml.Unmarshal(content, lock); err != nil {
+		return nil, errs.WithEF(err, data.WithField("file", file), "Failed to process lock file")
+	}
+	for _, dep := range lock.Dependencies {
+		if _, err := types.NewHash(dep.Id); err != nil || dep.Version == "" {
+			return nil, errs.WithF(data.WithField("file", file).WithField("dependency", dep.Name), "Invalid lock of dependency")
+		}
+	}
+	return lock, nil
+}
+
+func (l LockFile) Write(file string) error {
+	sort.Slice(l.Dependencies, func(i, j int) bool { return l.Dependencies[i].Name < l.Dependencies[j].Name })
+	content, err := yaml.Marshal(l)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("file", file), "Failed to marshal lock file")
+	}
+	if err := ioutil.WriteFile(file, append([]byte(lockFileHeader), content...), 0644); err != nil {
+		return errs.WithEF(err, data.WithField("file", file), "Failed to write lock file")
+	}
+	return nil
+}
+
+func (l LockFile) Get(dep ACFullname) (LockedDependency, bool) {
+	for _, locked := range l.Dependencies {
+		if locked.Name == dep {
+			return locked, true
+		}
+	}
+	return LockedDependency{}, false
+}
+
+// Stale tells why the lock does not match the dependencies of the manifest, nothing when it is up to date
+func (l LockFile) Stale(deps []ACFullname) []string {
+	reasons := []string{}
+	for _, dep := range deps {
+		if _, ok := l.Get(dep); !ok {
+			reasons = append(reasons, dep.String()+" is not locked")
+		}
+	}
+	for _, locked := range l.Dependencies {
+		if !containsFullname(deps, locked.Name) {
+			reasons = append(reasons, locked.Name.String()+" is not in manifest")
+		}
+	}
+	return reasons
+}
+
+// Resolve returns the locked version of the dependency, or the dependency itself when not locked
+func (l LockFile) Resolve(dep ACFullname) ACFullname {
+	if locked, ok := l.Get(dep); ok {
+		return ACFullname(dep.Name() + ":" + locked.Version)
+	}
+	return dep
+}
+
+func (l LockFile) ResolveAll(deps []ACFullname) []ACFullname {
+	resolved := make([]ACFullname, len(deps))
+	for i, dep := range deps {
+		resolved[i] = l.Resolve(dep)
+	}
+	return resolved
+}
+
+// Id returns the image id locked for a resolved name and version, empty when not locked
+func (l LockFile) Id(resolved ACFullname) string {
+	for _, locked := range l.Dependencies {
+		if locked.Name.Name() == resolved.Name() && locked.Version == resolved.Version() {
+			return locked.Id
+		}
+	}
+	return ""
+}
+
+// Apply resolves the dependencies and builder images of the manifest to their locked versions, their image ids being
+// set when the manifest is written
+func (l LockFile) Apply(m *AciManifest) {
+	m.Aci.Dependencies = l.ResolveAll(m.Aci.Dependencies)
+	m.Builder.Dependencies = l.ResolveAll(m.Builder.Dependencies)
+	m.Tester.Builder.Dependencies = l.ResolveAll(m.Tester.Builder.Dependencies)
+	m.Tester.Aci.Dependencies = l.ResolveAll(m.Tester.Aci.Dependencies)
+	if m.Builder.Image != "" {
+		m.Builder.Image = l.Resolve(m.Builder.Image)
+	}
+	if m.Tester.Builder.Image != "" {
+		m.Tester.Builder.Image = l.Resolve(m.Tester.Builder.Image)
+	}
+	m.Lock = &l
+}
+
+// Pin sets the locked image id of appc dependencies, matched by name and version label
+func (l LockFile) Pin(deps types.Dependencies) error {
+	for i, dep := range deps {
+		version, _ := dep.Labels.Get("version")
+		id := l.Id(ACFullname(dep.ImageName.String() + ":" + version))
+		if id == "" || version == "" {
+			continue
+		}
+		hash, err := types.NewHash(id)
+		if err != nil {
+			return errs.WithEF(err, data.WithField("dependency", dep.ImageName.String()).WithField("id", id), "Invalid locked image id")
+		}
+		deps[i].ImageID = hash
+	}
+	return nil
+}
+
+// LockableDependencies returns the dependencies and builder images set in the manifest, once each
+func (m AciManifest) LockableDependencies() []ACFullname {
+	deps := []ACFullname{}
+	for _, list := range [][]ACFullname{
+		{m.Builder.Image, m.Tester.Builder.Image},
+		m.Aci.Dependencies,
+		m.Builder.Dependencies,
+		m.Tester.Builder.Dependencies,
+		m.Tester.Aci.Dependencies,
+	} {
+		for _, dep := range list {
+			if dep != "" && !containsFullname(deps, dep) {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps
+}
+
+// LockableDependencies returns the dependencies of the pod's apps, once each
+func (m PodManifest) LockableDependencies() []ACFullname {
+	deps := []ACFullname{}
+	if m.Pod == nil {
+		return deps
+	}
+	for _, app := range m.Pod.Apps {
+		for _, dep := range app.Dependencies {
+			if !containsFullname(deps, dep) {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps
+}
+
+func containsFullname(list []ACFullname, name ACFullname) bool {
+	for _, item := range list {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const lockTestId = "sha512-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestLockFileApply(t *testing.T) {
+	RegisterTestingT(t)
+
+	manifest, err := ProcessManifestTemplate(`name: aci.example.com/aci-app:1
+builder:
+  image: aci.example.com/aci-builder
+aci:
+  dependencies:
+    - aci.example.com/aci-base
+    - aci.example.com/aci-tools:2
+`, nil, false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(manifest.LockableDependencies()).To(Equal([]ACFullname{
+		"aci.example.com/aci-builder", "aci.example.com/aci-base", "aci.example.com/aci-tools:2"}))
+
+	lock := LockFile{Dependencies: []LockedDependency{
+		{Name: "aci.example.com/aci-base", Version: "1.3", Id: lockTestId},
+		{Name: "aci.example.com/aci-builder", Version: "4", Id: lockTestId},
+	}}
+	Expect(lock.Stale(manifest.LockableDependencies())).To(Equal([]string{"aci.example.com/aci-tools:2 is not locked"}))
+
+	lock.Apply(manifest)
+	Expect(manifest.Builder.Image).To(Equal(ACFullname("aci.example.com/aci-builder:4")))
+	Expect(manifest.Aci.Dependencies).To(Equal([]ACFullname{"aci.example.com/aci-base:1.3", "aci.example.com/aci-tools:2"}))
+
+	deps, err := ToAppcDependencies(manifest.Aci.Dependencies)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(manifest.Lock.Pin(deps)).To(Succeed())
+	Expect(deps[0].ImageID.String()).To(Equal(lockTestId))
+	Expect(deps[1].ImageID).To(BeNil())
+}
+
+func TestLockFileStale(t *testing.T) {
+	RegisterTestingT(t)
+
+	lock := LockFile{Dependencies: []LockedDependency{{Name: "aci.example.com/aci-base:1", Version: "1", Id: lockTestId}}}
+	Expect(lock.Stale([]ACFullname{"aci.example.com/aci-base:1"})).To(BeEmpty())
+	Expect(lock.Stale([]ACFullname{"aci.example.com/aci-base:2"})).To(Equal([]string{
+		"aci.example.com/aci-base:2 is not locked",
+		"aci.example.com/aci-base:1 is not in manifest",
+	}))
+}
+
+func TestLockFileReadWrite(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "lock")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	missing, err := ReadLockFile(dir + PathAciManifestLock)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(missing).To(BeNil())
+
+	lock := LockFile{Dependencies: []LockedDependency{
+		{Name: "aci.example.com/aci-tools", Version: "2", Id: lockTestId},
+		{Name: "aci.example.com/aci-base", Version: "1.3", Id: lockTestId},
+	}}
+	Expect(lock.Write(dir + PathAciManifestLock)).To(Succeed())
+	read, err := ReadLockFile(dir + PathAciManifestLock)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(read.Dependencies[0].Name).To(Equal(ACFullname("aci.example.com/aci-base")))
+	Expect(read.Dependencies).To(HaveLen(2))
+
+	Expect(ioutil.WriteFile(dir+PathAciManifestLock, []byte("dependencies:\n- name: aci.example.com/aci-base\n  version: \"1\"\n  id: md5-42\n"), 0644)).To(Succeed())
+	_, err = ReadLockFile(dir + PathAciManifestLock)
+	Expect(err).To(HaveOccurred())
+}
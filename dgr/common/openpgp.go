@@ -0,0 +1,226 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const SignBackendOpenpgp = "openpgp"
+const SignBackendGpg = "gpg"
+
+const passphraseFilePrefix = "file:"
+const passphraseEnvPrefix = "env:"
+const PassphraseAgent = "agent"
+
+// PassphraseFunc returns the passphrase of an encrypted private key
+type PassphraseFunc func(entity *openpgp.Entity) ([]byte, error)
+
+// ReadKeyring reads armored or binary keys
+func ReadKeyring(content []byte) (openpgp.EntityList, error) {
+	if bytes.Contains(content, []byte("-----BEGIN PGP")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(content))
+}
+
+func ReadKeyringFile(path string) (openpgp.EntityList, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to read keyring")
+	}
+	keys, err := ReadKeyring(content)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to read keys of keyring")
+	}
+	return keys, nil
+}
+
+// KeyFingerprint is the fingerprint of the primary key, in uppercase hexadecimal
+func KeyFingerprint(entity *openpgp.Entity) string {
+	return fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+}
+
+// KeyIdentity is the first identity of the key, or its fingerprint when it has none
+func KeyIdentity(entity *openpgp.Entity) string {
+	for id := range entity.Identities {
+		return id
+	}
+	return KeyFingerprint(entity)
+}
+
+// MatchKeyId tells if the key id, long key id or fingerprint in hexadecimal is the one of the key or of a sub-key
+func MatchKeyId(entity *openpgp.Entity, keyId string) bool {
+	keyId = strings.ToUpper(strings.TrimPrefix(strings.Replace(keyId, " ", "", -1), "0x"))
+	if keyId == "" {
+		return false
+	}
+	if strings.HasSuffix(KeyFingerprint(entity), keyId) {
+		return true
+	}
+	for _, subkey := range entity.Subkeys {
+		if strings.HasSuffix(fmt.Sprintf("%X", subkey.PublicKey.Fingerprint), keyId) {
+			return true
+		}
+	}
+	return false
+}
+
+// SigningKey returns the first key of the keyring having its private key, or the one of the key id if set,
+// decrypted with the passphrase if needed
+func SigningKey(keyring openpgp.EntityList, keyId string, passphrase PassphraseFunc) (*openpgp.Entity, error) {
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil || (keyId != "" && !MatchKeyId(entity, keyId)) {
+			continue
+		}
+		if err := decryptKey(entity, passphrase); err != nil {
+			return nil, err
+		}
+		return entity, nil
+	}
+	if keyId != "" {
+		return nil, errs.WithF(data.WithField("keyId", keyId), "No private key found in keyring for key id")
+	}
+	return nil, errs.With("No private key found in keyring")
+}
+
+func decryptKey(entity *openpgp.Entity, passphrase PassphraseFunc) error {
+	keys := []*packet.PrivateKey{entity.PrivateKey}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil {
+			keys = append(keys, subkey.PrivateKey)
+		}
+	}
+
+	var pass []byte
+	for _, key := range keys {
+		if !key.Encrypted {
+			continue
+		}
+		if pass == nil {
+			if passphrase == nil {
+				return errs.WithF(data.WithField("key", KeyIdentity(entity)), "Private key is encrypted and no passphrase is configured")
+			}
+			var err error
+			if pass, err = passphrase(entity); err != nil {
+				return errs.WithEF(err, data.WithField("key", KeyIdentity(entity)), "Failed to get passphrase")
+			}
+		}
+		if err := key.Decrypt(pass); err != nil {
+			return errs.WithEF(err, data.WithField("key", KeyIdentity(entity)), "Failed to decrypt private key")
+		}
+	}
+	return nil
+}
+
+// SignFile writes the armored detached signature of the file
+func SignFile(signer *openpgp.Entity, file string, output string) error {
+	fields := data.WithField("file", file)
+	in, err := os.Open(file)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to open file to sign")
+	}
+	defer in.Close()
+
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, signer, in, nil); err != nil {
+		return errs.WithEF(err, fields, "Failed to sign file")
+	}
+	if err := ioutil.WriteFile(output, signature.Bytes(), 0644); err != nil {
+		return errs.WithEF(err, fields.WithField("output", output), "Failed to write signature")
+	}
+	return nil
+}
+
+// VerifyFile checks the armored detached signature of the file and returns the key that made it
+func VerifyFile(keyring openpgp.EntityList, file string, signature string) (*openpgp.Entity, error) {
+	fields := data.WithField("file", file)
+	in, err := os.Open(file)
+	if err != nil {
+		return nil, errs.WithEF(err, fields, "Failed to open signed file")
+	}
+	defer in.Close()
+	asc, err := os.Open(signature)
+	if err != nil {
+		return nil, errs.WithEF(err, fields.WithField("signature", signature), "Failed to open signature")
+	}
+	defer asc.Close()
+	return CheckSignature(keyring, in, asc)
+}
+
+// NewPassphraseFunc reads the passphrase from 'file:<path>', 'env:<name>' or 'agent' for the gpg-agent.
+// An empty source is only valid for keys that are not encrypted.
+func NewPassphraseFunc(source string) (PassphraseFunc, error) {
+	switch {
+	case source == "":
+		return nil, nil
+	case strings.HasPrefix(source, passphraseFilePrefix):
+		path := strings.TrimPrefix(source, passphraseFilePrefix)
+		return func(*openpgp.Entity) ([]byte, error) {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, errs.WithEF(err, data.WithField("path", path), "Failed to read passphrase file")
+			}
+			return bytes.TrimRight(content, "\r\n"), nil
+		}, nil
+	case strings.HasPrefix(source, passphraseEnvPrefix):
+		name := strings.TrimPrefix(source, passphraseEnvPrefix)
+		return func(*openpgp.Entity) ([]byte, error) {
+			pass, ok := os.LookupEnv(name)
+			if !ok {
+				return nil, errs.WithF(data.WithField("env", name), "Passphrase environment variable is not set")
+			}
+			return []byte(pass), nil
+		}, nil
+	case source == PassphraseAgent:
+		return agentPassphrase, nil
+	}
+	return nil, errs.WithF(data.WithField("passphrase", source), "Unknown passphrase source, use file:<path>, env:<name> or agent")
+}
+
+// agentPassphrase asks the gpg-agent, that prompts the user when the passphrase is not cached
+func agentPassphrase(entity *openpgp.Entity) ([]byte, error) {
+	desc := strings.Replace("Passphrase of "+KeyIdentity(entity)+" to sign with dgr", " ", "+", -1)
+	out, err := ExecCmdGetOutput("gpg-connect-agent", "GET_PASSPHRASE --data dgr:"+KeyFingerprint(entity)+" X X "+desc, "/bye")
+	if err != nil {
+		return nil, errs.WithE(err, "Failed to get passphrase from gpg-agent")
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "D ") {
+			return assuanUnescape(strings.TrimPrefix(line, "D "))
+		}
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, errs.WithF(data.WithField("error", line), "gpg-agent refused to give passphrase")
+		}
+	}
+	return nil, errs.With("No passphrase in gpg-agent response")
+}
+
+// assuanUnescape decodes the %XX escaping of assuan data lines
+func assuanUnescape(s string) ([]byte, error) {
+	res := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			res = append(res, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return nil, errs.With("Invalid escaping in gpg-agent response")
+		}
+		b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return nil, errs.WithE(err, "Invalid escaping in gpg-agent response")
+		}
+		res = append(res, byte(b))
+		i += 2
+	}
+	return res, nil
+}
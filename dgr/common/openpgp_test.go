@@ -0,0 +1,116 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestSignAndVerifyFile(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "dgr-openpgp")
+	defer os.RemoveAll(dir)
+
+	entity, err := openpgp.NewEntity("dgr", "test", "dgr@example.com", nil)
+	Expect(err).NotTo(HaveOccurred())
+	var secret bytes.Buffer
+	w, _ := armor.Encode(&secret, openpgp.PrivateKeyType, nil)
+	Expect(entity.SerializePrivate(w, nil)).To(Succeed())
+	w.Close()
+	ioutil.WriteFile(dir+"/secring.asc", secret.Bytes(), 0600)
+	ioutil.WriteFile(dir+"/image.aci", []byte("aci"), 0644)
+
+	keyring, err := ReadKeyringFile(dir + "/secring.asc")
+	Expect(err).NotTo(HaveOccurred())
+	signer, err := SigningKey(keyring, "", nil)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(KeyIdentity(signer)).To(Equal("dgr (test) <dgr@example.com>"))
+	Expect(SignFile(signer, dir+"/image.aci", dir+"/image.aci.asc")).To(Succeed())
+
+	verifier, err := VerifyFile(keyring, dir+"/image.aci", dir+"/image.aci.asc")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(KeyFingerprint(verifier)).To(Equal(KeyFingerprint(signer)))
+
+	ioutil.WriteFile(dir+"/image.aci", []byte("tampered"), 0644)
+	_, err = VerifyFile(keyring, dir+"/image.aci", dir+"/image.aci.asc")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestSigningKeyWithoutPrivateKey(t *testing.T) {
+	RegisterTestingT(t)
+
+	entity, _ := openpgp.NewEntity("dgr", "test", "dgr@example.com", nil)
+	entity.SerializePrivate(ioutil.Discard, nil)
+	var public bytes.Buffer
+	entity.Serialize(&public)
+
+	keyring, err := ReadKeyring(public.Bytes())
+	Expect(err).NotTo(HaveOccurred())
+	Expect(keyring).To(HaveLen(1))
+	_, err = SigningKey(keyring, "", nil)
+	Expect(err).To(HaveOccurred())
+}
+
+func TestSigningKeyWithKeyId(t *testing.T) {
+	RegisterTestingT(t)
+
+	first, _ := openpgp.NewEntity("first", "", "first@example.com", nil)
+	second, _ := openpgp.NewEntity("second", "", "second@example.com", nil)
+	keyring := openpgp.EntityList{first, second}
+	fingerprint := KeyFingerprint(second)
+
+	for _, keyId := range []string{fingerprint, fingerprint[24:], "0x" + strings.ToLower(fingerprint[32:])} {
+		signer, err := SigningKey(keyring, keyId, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer).To(Equal(second))
+	}
+	signer, _ := SigningKey(keyring, "", nil)
+	Expect(signer).To(Equal(first))
+
+	_, err := SigningKey(keyring, "DEADBEEF", nil)
+	Expect(err).To(HaveOccurred())
+}
+
+func TestPassphraseFunc(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "dgr-openpgp")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/pass", []byte("secret\n"), 0600)
+
+	none, err := NewPassphraseFunc("")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(none).To(BeNil())
+
+	file, err := NewPassphraseFunc("file:" + dir + "/pass")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(file(nil)).To(Equal([]byte("secret")))
+
+	os.Setenv("DGR_TEST_PASSPHRASE", "from env")
+	defer os.Unsetenv("DGR_TEST_PASSPHRASE")
+	env, err := NewPassphraseFunc("env:DGR_TEST_PASSPHRASE")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env(nil)).To(Equal([]byte("from env")))
+
+	unset, _ := NewPassphraseFunc("env:DGR_TEST_UNSET")
+	_, err = unset(nil)
+	Expect(err).To(HaveOccurred())
+
+	_, err = NewPassphraseFunc("vault:secret")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestAssuanUnescape(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(assuanUnescape("a%25b%0Ac+d")).To(Equal([]byte("a%b\nc+d")))
+	_, err := assuanUnescape("a%2")
+	Expect(err).To(HaveOccurred())
+}
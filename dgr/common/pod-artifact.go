@@ -0,0 +1,43 @@
+package common
+
+import (
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// A pod artifact is the pod-manifest.json of a built pod and its detached signature. It is pushed and
+// discovered like an aci, with the ext label telling them apart.
+const PodArtifactExt = "pod"
+const PodArtifactOs = "linux"
+const PodArtifactArch = "amd64"
+
+const AnnotationPodName = "blablacar.github.io/dgr/pod/name"
+const AnnotationPodVersion = "blablacar.github.io/dgr/pod/version"
+
+// PodArtifactLabels are the discovery labels of pod artifacts, version excluded
+func PodArtifactLabels() map[types.ACIdentifier]string {
+	return map[types.ACIdentifier]string{
+		"os":   PodArtifactOs,
+		"arch": PodArtifactArch,
+		"ext":  PodArtifactExt,
+	}
+}
+
+func SetPodArtifactName(manifest *schema.PodManifest, name ACFullname) {
+	manifest.Annotations.Set(AnnotationPodName, name.Name())
+	manifest.Annotations.Set(AnnotationPodVersion, name.Version())
+}
+
+func PodArtifactName(manifest *schema.PodManifest) (*ACFullname, error) {
+	name, ok := manifest.Annotations.Get(AnnotationPodName)
+	if !ok {
+		return nil, errs.WithF(data.WithField("annotation", AnnotationPodName), "Pod manifest has no name annotation")
+	}
+	version, ok := manifest.Annotations.Get(AnnotationPodVersion)
+	if !ok || version == "" {
+		return NewACFullName(name), nil
+	}
+	return NewACFullName(name + ":" + version), nil
+}
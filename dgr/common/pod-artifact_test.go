@@ -0,0 +1,25 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/appc/spec/schema"
+	. "github.com/onsi/gomega"
+)
+
+func TestPodArtifactName(t *testing.T) {
+	RegisterTestingT(t)
+
+	manifest := schema.BlankPodManifest()
+	_, err := PodArtifactName(manifest)
+	Expect(err).To(HaveOccurred())
+
+	SetPodArtifactName(manifest, *NewACFullName("example.com/pod-app:1.2"))
+	name, err := PodArtifactName(manifest)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(name.String()).To(Equal("example.com/pod-app:1.2"))
+
+	SetPodArtifactName(manifest, *NewACFullName("example.com/pod-app"))
+	name, _ = PodArtifactName(manifest)
+	Expect(name.String()).To(Equal("example.com/pod-app"))
+}
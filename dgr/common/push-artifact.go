@@ -0,0 +1,41 @@
+package common
+
+import (
+	"os"
+	"strings"
+)
+
+const ExtAci = "aci"
+const ExtAsc = ".asc"
+
+// PushArtifactTemplate lays out artifacts like the usual appc discovery template
+const PushArtifactTemplate = "{name}-{version}-{os}-{arch}.{ext}"
+
+// PushArtifact is a file pushed to an image repository, aci or pod manifest, with its detached signature
+type PushArtifact struct {
+	Name ACFullname
+	File string
+	Asc  string // empty when the artifact is not signed
+	Os   string
+	Arch string
+	Ext  string
+}
+
+func NewPushArtifact(name ACFullname, file string, ext string, osName string, arch string) PushArtifact {
+	artifact := PushArtifact{Name: name, File: file, Os: osName, Arch: arch, Ext: ext}
+	if _, err := os.Stat(file + ExtAsc); err == nil {
+		artifact.Asc = file + ExtAsc
+	}
+	return artifact
+}
+
+// Render replaces {name}, {version}, {os}, {arch} and {ext} in a template, ext being given to render the signature path
+func (a PushArtifact) Render(tmpl string, ext string) string {
+	return strings.NewReplacer(
+		"{name}", a.Name.Name(),
+		"{version}", a.Name.Version(),
+		"{os}", a.Os,
+		"{arch}", a.Arch,
+		"{ext}", ext,
+	).Replace(tmpl)
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPushArtifact(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "dgr-push")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/image.aci", []byte("aci"), 0644)
+
+	artifact := NewPushArtifact(*NewACFullName("example.com/dgr/aci-app:1.2"), dir+"/image.aci", ExtAci, "linux", "amd64")
+	Expect(artifact.Asc).To(BeEmpty())
+	Expect(artifact.Render(PushArtifactTemplate, artifact.Ext)).To(Equal("example.com/dgr/aci-app-1.2-linux-amd64.aci"))
+	Expect(artifact.Render("https://repo/{name}/{version}/file.{ext}", artifact.Ext+ExtAsc)).To(Equal("https://repo/example.com/dgr/aci-app/1.2/file.aci.asc"))
+
+	ioutil.WriteFile(dir+"/image.aci"+ExtAsc, []byte("asc"), 0644)
+	artifact = NewPushArtifact(*NewACFullName("example.com/dgr/aci-app:1.2"), dir+"/image.aci", ExtAci, "linux", "amd64")
+	Expect(artifact.Asc).To(Equal(dir + "/image.aci.asc"))
+}
@@ -2,7 +2,12 @@ package common
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/appc/spec/discovery"
@@ -51,11 +56,16 @@ type RktConfig struct {
 
 type RktClient struct {
 	config     RktConfig
+	auth       Auths
 	globalArgs []string
 	fields     data.Fields
+
+	// FetchHosts returns the hosts the image is downloaded from, as found by discovery, given the credentials of dgr
+	// like the domain of the image
+	FetchHosts func(image string) []string
 }
 
-func NewRktClient(config RktConfig) (*RktClient, error) {
+func NewRktClient(config RktConfig, auth Auths) (*RktClient, error) {
 	if len(config.InsecureOptions) == 0 {
 		config.InsecureOptions = []string{"ondisk", "image"}
 	}
@@ -63,6 +73,7 @@ func NewRktClient(config RktConfig) (*RktClient, error) {
 	rkt := &RktClient{
 		fields:     data.WithField("config", config),
 		config:     config,
+		auth:       auth,
 		globalArgs: config.prepareGlobalArgs(config.InsecureOptions),
 	}
 
@@ -151,11 +162,7 @@ func (rkt *RktClient) Version() (Version, error) {
 }
 
 func (rkt *RktClient) Fetch(image string) (string, error) {
-	hash, err := ExecCmdGetOutput(rkt.globalArgs[0], rkt.argsStore([]string{"fetch"}, rkt.globalArgs, "--full", image)...)
-	if err != nil {
-		return "", errs.WithEF(err, rkt.fields.WithField("image", image), "Failed to fetch image")
-	}
-	return hash, err
+	return rkt.fetch(rkt.globalArgs, image)
 }
 
 func (rkt *RktClient) FetchInsecure(image string) (string, error) {
@@ -163,13 +170,136 @@ func (rkt *RktClient) FetchInsecure(image string) (string, error) {
 	if !rkt.config.InsecureOptions.HasImage() {
 		globalArgs = rkt.config.prepareGlobalArgs(append(rkt.config.InsecureOptions, "image"))
 	}
-	hash, err := ExecCmdGetOutput(rkt.globalArgs[0], rkt.argsStore([]string{"fetch"}, globalArgs, "--full", image)...)
+	return rkt.fetch(globalArgs, image)
+}
+
+func (rkt *RktClient) fetch(globalArgs []string, image string) (string, error) {
+	fields := rkt.fields.WithField("image", image)
+	userConfig, err := rkt.authUserConfig(image)
+	if err != nil {
+		return "", errs.WithEF(err, fields, "Failed to prepare fetch credentials")
+	}
+	if userConfig != "" {
+		defer os.RemoveAll(userConfig)
+		globalArgs = append(withoutArg(globalArgs, "--user-config="), "--user-config="+userConfig)
+	}
+
+	hash, err := ExecCmdGetOutput(globalArgs[0], rkt.argsStore([]string{"fetch"}, globalArgs, "--full", image)...)
 	if err != nil {
-		return "", errs.WithEF(err, rkt.fields.WithField("image", image), "Failed to fetch image")
+		if rkt.config.StoreOnly {
+			return "", errs.WithEF(err, fields, "Failed to fetch image from rkt store only")
+		}
+		return "", errs.WithEF(err, fields, "Failed to fetch image")
 	}
 	return hash, err
 }
 
+// authUserConfig prepares a rkt user configuration with the credentials of dgr for the domain of the image and the
+// hosts it is fetched from, linking the content of the configured one or of the default one. It returns an empty path
+// when dgr has no credentials for them.
+func (rkt *RktClient) authUserConfig(image string) (string, error) {
+	if len(rkt.auth) == 0 || strings.HasPrefix(image, "/") || strings.HasPrefix(image, ".") || strings.Contains(image, "://") ||
+		strings.HasPrefix(image, "sha512-") {
+		return "", nil
+	}
+	hosts := []string{}
+	candidates := []string{NewACFullName(image).DomainName()}
+	if rkt.FetchHosts != nil {
+		candidates = append(candidates, rkt.FetchHosts(image)...)
+	}
+	for _, host := range candidates {
+		if rkt.auth.Match(host) != nil && !containsString(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		return "", nil
+	}
+
+	dir, err := ioutil.TempDir("", "dgr-rkt-config")
+	if err != nil {
+		return "", errs.WithE(err, "Failed to create rkt user configuration")
+	}
+	userConfig := rkt.config.UserConfig
+	if userConfig == "" {
+		userConfig = defaultRktUserConfig()
+	}
+	if err := linkRktConfig(userConfig, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	written := []string{}
+	for _, host := range hosts {
+		ok, err := rkt.auth.WriteRktAuth(filepath.Join(dir, "auth.d"), host)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		if ok {
+			written = append(written, host)
+		}
+	}
+	if len(written) == 0 {
+		os.RemoveAll(dir)
+		return "", nil
+	}
+	logs.WithField("hosts", written).Debug("Fetching with dgr credentials")
+	return dir, nil
+}
+
+// defaultRktUserConfig is the user configuration read by rkt without --user-config
+func defaultRktUserConfig() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "rkt")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "rkt")
+}
+
+// linkRktConfig links configuration files of source in dir, auth.d being merged with the one of dgr
+func linkRktConfig(source string, dir string) error {
+	entries, err := ioutil.ReadDir(source)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errs.WithEF(err, data.WithField("path", source), "Failed to read rkt user configuration")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errs.WithEF(err, data.WithField("path", dir), "Failed to create rkt user configuration")
+	}
+	for _, entry := range entries {
+		if entry.Name() != "auth.d" || !entry.IsDir() {
+			if err := os.Symlink(filepath.Join(source, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+				return errs.WithEF(err, data.WithField("path", source), "Failed to link rkt user configuration")
+			}
+			continue
+		}
+		if err := linkRktConfig(filepath.Join(source, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutArg(args []string, prefix string) []string {
+	res := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, prefix) {
+			res = append(res, arg)
+		}
+	}
+	return res
+}
+
 func (rkt *RktClient) CatManifest(image string) (string, error) {
 	content, err := ExecCmdGetOutput(rkt.globalArgs[0], append(rkt.globalArgs[1:], "image", "cat-manifest", image)...)
 	if err != nil {
@@ -212,3 +342,32 @@ func (rkt *RktClient) Run(args []string) error {
 	}
 	return nil
 }
+
+func (rkt *RktClient) RunInteractive(args []string) error {
+	if err := ExecCmdInteractive(rkt.globalArgs[0], append(append(rkt.globalArgs[1:], "run"), args...)...); err != nil {
+		return errs.WithEF(err, rkt.fields, "Run failed")
+	}
+	return nil
+}
+
+func (rkt *RktClient) RunWithOutput(out io.Writer, args []string) error {
+	if err := ExecCmdWithOutput(out, rkt.globalArgs[0], append(append(rkt.globalArgs[1:], "run"), args...)...); err != nil {
+		return errs.WithEF(err, rkt.fields, "Run failed")
+	}
+	return nil
+}
+
+// RunContext is a cancelable Run, in background for concurrent builds. The pod is killed when the context is done
+func (rkt *RktClient) RunContext(ctx context.Context, args []string) error {
+	if err := ExecCmdContext(ctx, rkt.globalArgs[0], append(append(rkt.globalArgs[1:], "run"), args...)...); err != nil {
+		return errs.WithEF(err, rkt.fields, "Run failed")
+	}
+	return nil
+}
+
+func (rkt *RktClient) RunContextWithOutput(ctx context.Context, out io.Writer, args []string) error {
+	if err := ExecCmdContextWithOutput(ctx, out, rkt.globalArgs[0], append(append(rkt.globalArgs[1:], "run"), args...)...); err != nil {
+		return errs.WithEF(err, rkt.fields, "Run failed")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRktAuthUserConfig(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "rkt-config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	Expect(os.MkdirAll(dir+"/rkt/paths.d", 0755)).To(Succeed())
+	Expect(os.MkdirAll(dir+"/rkt/auth.d", 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(dir+"/rkt/auth.d/other.json", []byte("{}"), 0644)).To(Succeed())
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", dir)
+
+	rkt := &RktClient{
+		auth: Auths{
+			{Hosts: []string{"aci.example.com"}, Type: AuthTypeBearer, Token: "token"},
+			{Hosts: []string{"nexus.example.com"}, Type: AuthTypeBasic, User: "user", Password: "pass"},
+		},
+		FetchHosts: func(image string) []string { return []string{"nexus.example.com", "cdn.example.org"} },
+	}
+
+	userConfig, err := rkt.authUserConfig("aci.example.com/app:1")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(userConfig)
+	Expect(userConfig).NotTo(BeEmpty())
+	link, err := os.Readlink(userConfig + "/paths.d")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(link).To(Equal(dir + "/rkt/paths.d"))
+	files, err := filepath.Glob(userConfig + "/auth.d/*")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(files).To(Equal([]string{
+		userConfig + "/auth.d/dgr-aci.example.com.json",
+		userConfig + "/auth.d/dgr-nexus.example.com.json",
+		userConfig + "/auth.d/other.json",
+	}))
+
+	none, err := rkt.authUserConfig("/tmp/image.aci")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(none).To(BeEmpty())
+	rkt.FetchHosts = func(image string) []string { return []string{"cdn.example.org"} }
+	none, err = rkt.authUserConfig("aci.example.org/app:1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(none).To(BeEmpty())
+}
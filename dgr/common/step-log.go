@@ -0,0 +1,171 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const PathLogs = "/logs"
+
+// EnvStepMarker is set in the builder when steps are logged, scripts then print the marker followed by the step name
+// on its own line to switch to the log file of this step
+const EnvStepMarker = "DGR_STEP_MARKER"
+const StepMarker = "##dgr-step## "
+
+const StepStage1 = "stage1"
+const StepManifest = "manifest"
+const StepTar = "tar"
+const StepTest = "test"
+
+const stepTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// StepLogWriter streams output to the terminal while writing it, timestamped, to the log file of the current step.
+// Lines starting with StepMarker switch the current step and are not displayed.
+type StepLogWriter struct {
+	mutex   sync.Mutex
+	dir     string
+	out     io.Writer
+	file    *os.File
+	step    string
+	pending []byte
+}
+
+func NewStepLogWriter(dir string, step string, out io.Writer) (*StepLogWriter, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", dir), "Failed to create logs directory")
+	}
+	w := &StepLogWriter{dir: dir, out: out}
+	if err := w.Step(step); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func StepLogPath(dir string, step string) string {
+	return dir + "/" + stepFilename(step) + ".log"
+}
+
+func stepFilename(step string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' || r == '\t' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(step))
+}
+
+// Step closes the current step log and appends the next output to the log of the given step
+func (w *StepLogWriter) Step(step string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.switchStep(step)
+}
+
+func (w *StepLogWriter) switchStep(step string) error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	path := StepLogPath(w.dir, step)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("file", path), "Failed to open step log file")
+	}
+	w.file = file
+	w.step = step
+	return nil
+}
+
+func (w *StepLogWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(w.pending[:i+1]); err != nil {
+			return len(p), err
+		}
+		w.pending = w.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close flushes an unterminated last line and closes the current step log
+func (w *StepLogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.pending) > 0 {
+		w.writeLine(append(w.pending, '\n'))
+		w.pending = nil
+	}
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *StepLogWriter) writeLine(line []byte) error {
+	if bytes.HasPrefix(line, []byte(StepMarker)) {
+		return w.switchStep(string(bytes.TrimSpace(line[len(StepMarker):])))
+	}
+	if _, err := w.out.Write(line); err != nil {
+		return err
+	}
+	if _, err := w.file.WriteString(time.Now().Format(stepTimeFormat) + " "); err != nil {
+		return err
+	}
+	_, err := w.file.Write(line)
+	return err
+}
+
+// LastStepLog returns the most recently written log of the directory, which is the one of the failing step
+func LastStepLog(dir string) (string, error) {
+	files, err := filepath.Glob(dir + "/*.log")
+	if err != nil {
+		return "", errs.WithEF(err, data.WithField("path", dir), "Failed to list step logs")
+	}
+	if len(files) == 0 {
+		return "", errs.WithF(data.WithField("path", dir), "No step log found")
+	}
+	last := ""
+	var lastTime time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if last == "" || !info.ModTime().Before(lastTime) {
+			last = file
+			lastTime = info.ModTime()
+		}
+	}
+	return last, nil
+}
+
+func TailFile(path string, lines int) ([]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("file", path), "Failed to read file")
+	}
+	all := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return all, nil
+}
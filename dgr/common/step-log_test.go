@@ -0,0 +1,32 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestStepLogWriter(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "dgr-logs")
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	w, err := NewStepLogWriter(dir, StepStage1, &out)
+	Expect(err).NotTo(HaveOccurred())
+	w.Write([]byte("prepare\n" + StepMarker + "build-10.install.sh\ninst"))
+	w.Write([]byte("all\n"))
+	w.Step(StepTar)
+	w.Write([]byte("unterminated"))
+	Expect(w.Close()).To(Succeed())
+
+	Expect(out.String()).To(Equal("prepare\ninstall\nunterminated\n"))
+	Expect(TailFile(StepLogPath(dir, "build-10.install.sh"), 5)).To(HaveLen(1))
+	lines, _ := TailFile(StepLogPath(dir, StepStage1), 5)
+	Expect(lines[0]).To(HaveSuffix(" prepare"))
+	Expect(LastStepLog(dir)).To(Equal(StepLogPath(dir, StepTar)))
+}
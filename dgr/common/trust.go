@@ -0,0 +1,61 @@
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"golang.org/x/crypto/openpgp"
+)
+
+const pathTrustedKeys = "/trustedkeys"
+
+// TrustedKeyring reads the keys trusted by rkt for a name, from the prefix.d directories of the name and its parents
+// and from root.d, in each of the rkt configuration directories
+func TrustedKeyring(configDirs []string, name string) (openpgp.EntityList, error) {
+	dirs := []string{}
+	for _, configDir := range configDirs {
+		for prefix := name; prefix != "." && prefix != "/" && prefix != ""; prefix = filepath.Dir(prefix) {
+			dirs = append(dirs, configDir+pathTrustedKeys+"/prefix.d/"+prefix)
+		}
+		dirs = append(dirs, configDir+pathTrustedKeys+"/root.d")
+	}
+
+	keyring := openpgp.EntityList{}
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errs.WithEF(err, data.WithField("path", dir), "Failed to read trusted keys directory")
+		}
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+				continue
+			}
+			keys, err := ReadKeyringFile(dir + "/" + f.Name())
+			if err != nil {
+				return nil, err
+			}
+			keyring = append(keyring, keys...)
+		}
+	}
+	return keyring, nil
+}
+
+// CheckSignature verifies an armored detached signature and returns the key that made it
+func CheckSignature(keyring openpgp.EntityList, signed io.Reader, signature io.Reader) (*openpgp.Entity, error) {
+	if len(keyring) == 0 {
+		return nil, errs.With("No trusted key to check signature")
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, signed, signature)
+	if err != nil {
+		return nil, errs.WithE(err, "Signature check failed")
+	}
+	return signer, nil
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestCheckSignatureWithTrustedKeyring(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, _ := ioutil.TempDir("", "dgr-trust")
+	defer os.RemoveAll(dir)
+
+	entity, err := openpgp.NewEntity("dgr", "test", "dgr@example.com", nil)
+	Expect(err).NotTo(HaveOccurred())
+	entity.SerializePrivate(ioutil.Discard, nil) // self-signs identities
+	var pub bytes.Buffer
+	w, _ := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	entity.Serialize(w)
+	w.Close()
+	os.MkdirAll(dir+"/trustedkeys/prefix.d/example.com", 0755)
+	ioutil.WriteFile(dir+"/trustedkeys/prefix.d/example.com/key", pub.Bytes(), 0644)
+
+	content := []byte("{\"acKind\":\"PodManifest\"}")
+	var signature bytes.Buffer
+	Expect(openpgp.ArmoredDetachSign(&signature, entity, bytes.NewReader(content), nil)).To(Succeed())
+
+	keyring, err := TrustedKeyring([]string{dir}, "example.com/pod-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(keyring).To(HaveLen(1))
+	_, err = CheckSignature(keyring, bytes.NewReader(content), bytes.NewReader(signature.Bytes()))
+	Expect(err).NotTo(HaveOccurred())
+
+	_, err = CheckSignature(keyring, bytes.NewReader([]byte("tampered")), bytes.NewReader(signature.Bytes()))
+	Expect(err).To(HaveOccurred())
+
+	other, _ := TrustedKeyring([]string{dir}, "other.com/pod-app")
+	Expect(other).To(BeEmpty())
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const defaultUploadRetries = 3
+const defaultUploadRetryDelay = time.Second
+const maxUploadRetryDelay = time.Minute
+const defaultUploadChunkSize = 64 * 1024 * 1024
+
+// UploadConfig tunes uploads of the appc push protocol
+type UploadConfig struct {
+	Retries    *int   `yaml:"retries,omitempty"`    // per request, 0 to disable
+	RetryDelay string `yaml:"retryDelay,omitempty"` // before first retry, doubled on each retry up to 1 minute
+	ChunkSize  string `yaml:"chunkSize,omitempty"`  // used when the server supports multipart, as bytes or with K, M or G unit
+}
+
+func (c UploadConfig) Validate() error {
+	if c.Retries != nil && *c.Retries < 0 {
+		return errs.WithF(data.WithField("retries", *c.Retries), "Upload retries cannot be negative")
+	}
+	if _, err := c.retryDelay(); err != nil {
+		return err
+	}
+	_, err := c.ChunkBytes()
+	return err
+}
+
+func (c UploadConfig) MaxRetries() int {
+	if c.Retries == nil {
+		return defaultUploadRetries
+	}
+	return *c.Retries
+}
+
+// Backoff is the delay before the retry following the given failed attempt, starting at 0.
+// Doubling stops at the max delay, which does not shorten a longer configured delay.
+func (c UploadConfig) Backoff(attempt int) time.Duration {
+	delay, err := c.retryDelay()
+	if err != nil {
+		delay = defaultUploadRetryDelay
+	}
+	for i := 0; i < attempt && delay > 0 && delay < maxUploadRetryDelay; i++ {
+		delay *= 2
+		if delay > maxUploadRetryDelay {
+			delay = maxUploadRetryDelay
+		}
+	}
+	return delay
+}
+
+func (c UploadConfig) retryDelay() (time.Duration, error) {
+	if c.RetryDelay == "" {
+		return defaultUploadRetryDelay, nil
+	}
+	delay, err := time.ParseDuration(c.RetryDelay)
+	if err != nil || delay < 0 {
+		return 0, errs.WithEF(err, data.WithField("retryDelay", c.RetryDelay), "Invalid upload retry delay")
+	}
+	return delay, nil
+}
+
+func (c UploadConfig) ChunkBytes() (int64, error) {
+	if c.ChunkSize == "" {
+		return defaultUploadChunkSize, nil
+	}
+	size := strings.ToUpper(c.ChunkSize)
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(size, "K"):
+		unit = 1024
+	case strings.HasSuffix(size, "M"):
+		unit = 1024 * 1024
+	case strings.HasSuffix(size, "G"):
+		unit = 1024 * 1024 * 1024
+	}
+	if unit != 1 {
+		size = size[:len(size)-1]
+	}
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, errs.WithEF(err, data.WithField("chunkSize", c.ChunkSize), "Invalid upload chunk size")
+	}
+	return value * unit, nil
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUploadConfigDefaults(t *testing.T) {
+	RegisterTestingT(t)
+
+	config := UploadConfig{}
+	Expect(config.Validate()).To(Succeed())
+	Expect(config.MaxRetries()).To(Equal(3))
+	Expect(config.Backoff(0)).To(Equal(time.Second))
+	Expect(config.Backoff(2)).To(Equal(4 * time.Second))
+	Expect(config.Backoff(6)).To(Equal(time.Minute))
+	Expect(config.Backoff(1000)).To(Equal(time.Minute))
+	Expect(config.ChunkBytes()).To(Equal(int64(64 * 1024 * 1024)))
+}
+
+func TestUploadConfig(t *testing.T) {
+	RegisterTestingT(t)
+
+	retries := 0
+	config := UploadConfig{Retries: &retries, RetryDelay: "500ms", ChunkSize: "8k"}
+	Expect(config.Validate()).To(Succeed())
+	Expect(config.MaxRetries()).To(Equal(0))
+	Expect(config.Backoff(1)).To(Equal(time.Second))
+	Expect(config.ChunkBytes()).To(Equal(int64(8192)))
+
+	Expect(UploadConfig{ChunkSize: "1024"}.ChunkBytes()).To(Equal(int64(1024)))
+	Expect(UploadConfig{ChunkSize: "10X"}.Validate()).NotTo(Succeed())
+	Expect(UploadConfig{ChunkSize: "0M"}.Validate()).NotTo(Succeed())
+	Expect(UploadConfig{RetryDelay: "2m"}.Backoff(3)).To(Equal(2 * time.Minute))
+	Expect(UploadConfig{RetryDelay: "soon"}.Validate()).NotTo(Succeed())
+	retries = -1
+	Expect(UploadConfig{Retries: &retries}.Validate()).NotTo(Succeed())
+}
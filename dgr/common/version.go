@@ -61,3 +61,11 @@ func (v Version) GreaterThanOrEqualTo(other Version) bool {
 func (v Version) Equal(other Version) bool {
 	return v.compareTo(other) == 0
 }
+
+// Major returns the first number of the version, like 1 for 1.10-3
+func (v Version) Major() string {
+	if i := strings.IndexAny(string(v), ".-"); i >= 0 {
+		return string(v[:i])
+	}
+	return string(v)
+}
@@ -26,3 +26,11 @@ func TestCompareVersion(t *testing.T) {
 	assertVersion(t, "1", "1", 0)
 
 }
+
+func TestMajorVersion(t *testing.T) {
+	for version, major := range map[string]string{"1.12": "1", "10-3": "10", "2": "2", "": ""} {
+		if r := Version(version).Major(); r != major {
+			t.Fatalf("Unexpected major version of %s. Found %s, expected %s", version, r, major)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+	"gopkg.in/yaml.v2"
+)
+
+const pathSystemConfig = "/etc/dgr/config.yml"
+const pathProjectConfig = "/.dgr.yml"
+const envConfigPrefix = "DGR_CONFIG_"
+
+const configScopeSystem = "system"
+const configScopeUser = "user"
+const configScopeProject = "project"
+
+// configLayer is a source of configuration, layers being merged from the system file to the flags
+type configLayer struct {
+	origin  string
+	file    string // empty for env and flags
+	content yaml.MapSlice
+}
+
+// loadConfigLayers reads the system file, the user file of the home, the .dgr.yml of the project found
+// walking up from the work path, DGR_CONFIG_* environment variables and configuration flags
+func loadConfigLayers(homePath string) ([]configLayer, error) {
+	layers := []configLayer{}
+
+	userFile := homePath + "/config.yml"
+	if _, err := os.Stat(userFile); os.IsNotExist(err) {
+		if legacy := DefaultHomeFolder("cnt") + "/config.yml"; fileExists(legacy) {
+			logs.WithField("old", legacy).WithField("new", DefaultHomeFolder("")).Warn("You are using old home folder")
+			userFile = legacy
+		}
+	}
+	for _, file := range []string{pathSystemConfig, userFile, findProjectConfig()} {
+		if file == "" {
+			continue
+		}
+		layer, err := readConfigLayer(file)
+		if err != nil {
+			return nil, err
+		}
+		if layer != nil {
+			layers = append(layers, *layer)
+		}
+	}
+
+	env, err := envConfigLayer()
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, env, flagsConfigLayer()), nil
+}
+
+func readConfigLayer(file string) (*configLayer, error) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errs.WithEF(err, data.WithField("path", file), "Failed to read configuration file")
+	}
+	var content yaml.MapSlice
+	if err := yaml.Unmarshal(source, &content); err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", file), "Failed to process configuration file")
+	}
+	return &configLayer{origin: file, file: file, content: content}, nil
+}
+
+// findProjectConfig returns the nearest .dgr.yml from the work path to the root
+func findProjectConfig() string {
+	dir, err := filepath.Abs(workPath)
+	if err != nil {
+		return ""
+	}
+	for {
+		if fileExists(dir + pathProjectConfig) {
+			return dir + pathProjectConfig
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// envConfigLayer reads DGR_CONFIG_<KEY>_<SUBKEY>=value, keys being case insensitive
+func envConfigLayer() (configLayer, error) {
+	layer := configLayer{origin: "env"}
+	env := os.Environ()
+	sort.Strings(env)
+	for _, entry := range env {
+		if !strings.HasPrefix(entry, envConfigPrefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(entry, envConfigPrefix), "=", 2)
+		path, valueType, err := configKeyPath(strings.Split(parts[0], "_"))
+		if err != nil {
+			logs.WithEF(err, data.WithField("env", envConfigPrefix+parts[0])).Warn("Ignoring unknown configuration environment variable")
+			continue
+		}
+		value, err := parseConfigValue(parts[1], valueType)
+		if err != nil {
+			return layer, errs.WithEF(err, data.WithField("env", envConfigPrefix+parts[0]), "Invalid configuration environment variable")
+		}
+		layer.content = common.YamlMapSet(layer.content, value, path...)
+	}
+	return layer, nil
+}
+
+func flagsConfigLayer() configLayer {
+	layer := configLayer{origin: "flags"}
+	if Args.NoStore {
+		layer.content = common.YamlMapSet(layer.content, true, "rkt", "noStore")
+	}
+	if Args.StoreOnly {
+		layer.content = common.YamlMapSet(layer.content, true, "rkt", "storeOnly")
+	}
+	if Args.Offline {
+		layer.content = common.YamlMapSet(layer.content, true, "discovery", "offline")
+	}
+	if Args.TargetsRootPath != "" {
+		layer.content = common.YamlMapSet(layer.content, Args.TargetsRootPath, "targetWorkDir")
+	}
+	return layer
+}
+
+// mergeConfigLayers returns the effective configuration and the origin of each of its values
+func mergeConfigLayers(layers []configLayer) (yaml.MapSlice, map[string]string) {
+	merged := yaml.MapSlice{}
+	origins := make(map[string]string)
+	for _, layer := range layers {
+		origin := layer.origin
+		merged = common.YamlMapMerge(merged, layer.content, func(path []string) {
+			origins[strings.Join(path, ".")] = origin
+		})
+	}
+	return merged, origins
+}
+
+// configKeyPath resolves case insensitive keys to the yaml names of the configuration, with the type of the value
+func configKeyPath(keys []string) ([]string, reflect.Type, error) {
+	path := []string{}
+	current := reflect.TypeOf(Config{})
+	for i, key := range keys {
+		for current.Kind() == reflect.Ptr {
+			current = current.Elem()
+		}
+		if current.Kind() != reflect.Struct {
+			return nil, nil, errs.WithF(data.WithField("key", strings.Join(keys, ".")), "Configuration key cannot have sub keys")
+		}
+
+		found := false
+		for f := 0; f < current.NumField(); f++ {
+			field := current.Field(f)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			if strings.EqualFold(name, key) {
+				path = append(path, name)
+				current = field.Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, errs.WithF(data.WithField("key", strings.Join(keys[:i+1], ".")), "Unknown configuration key")
+		}
+	}
+	return path, current, nil
+}
+
+// parseConfigValue reads the value as yaml, except for strings. Lists can also be given comma separated, like http,image
+func parseConfigValue(value string, valueType reflect.Type) (interface{}, error) {
+	if valueType.Kind() == reflect.String {
+		return value, nil
+	}
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, errs.WithEF(err, data.WithField("value", value), "Invalid yaml value")
+	}
+	if _, ok := parsed.(string); ok && valueType.Kind() == reflect.Slice {
+		list := []interface{}{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	}
+	return parsed, nil
+}
+
+// configFile is the file of a scope, the project one being created in the work path when not found
+func configFile(scope string) (string, error) {
+	switch scope {
+	case configScopeSystem:
+		return pathSystemConfig, nil
+	case configScopeUser, "":
+		return Home.path + "/config.yml", nil
+	case configScopeProject:
+		if file := findProjectConfig(); file != "" {
+			return file, nil
+		}
+		dir, err := filepath.Abs(workPath)
+		if err != nil {
+			return "", errs.WithEF(err, data.WithField("path", workPath), "Cannot get fullpath")
+		}
+		return dir + pathProjectConfig, nil
+	}
+	return "", errs.WithF(data.WithField("scope", scope), "Unknown configuration scope, use system, user or project")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+	"gopkg.in/yaml.v2"
+)
+
+var configSecretKeys = map[string]bool{"password": true, "token": true, "secretAccessKey": true}
+
+// configSet writes the value of a key in the file of the scope. The value is read as yaml for non string keys.
+func configSet(key string, value string, scope string) error {
+	path, valueType, err := configKeyPath(strings.Split(key, "."))
+	if err != nil {
+		return err
+	}
+	parsed, err := parseConfigValue(value, valueType)
+	if err != nil {
+		return err
+	}
+	file, err := configFile(scope)
+	if err != nil {
+		return err
+	}
+
+	if err := updateConfigFile(file, func(config yaml.MapSlice) (yaml.MapSlice, error) {
+		config = common.YamlMapSet(config, parsed, path...)
+		if configErrors := validateConfigContent(config); len(configErrors) > 0 {
+			return nil, configErrors[0]
+		}
+		return config, nil
+	}); err != nil {
+		return err
+	}
+	logs.WithField("key", strings.Join(path, ".")).WithField("file", file).Info("Configuration set")
+	return nil
+}
+
+func configUnset(key string, scope string) error {
+	path, _, err := configKeyPath(strings.Split(key, "."))
+	if err != nil {
+		return err
+	}
+	file, err := configFile(scope)
+	if err != nil {
+		return err
+	}
+
+	fields := data.WithField("key", strings.Join(path, ".")).WithField("file", file)
+	if err := updateConfigFile(file, func(config yaml.MapSlice) (yaml.MapSlice, error) {
+		if _, ok := common.YamlMapGet(config, path...); !ok {
+			return nil, errs.WithF(fields, "Key is not set in configuration file")
+		}
+		return common.YamlMapUnset(config, path...), nil
+	}); err != nil {
+		return err
+	}
+	logs.WithF(fields).Info("Configuration unset")
+	return nil
+}
+
+// configShow prints the effective configuration, or each value with the file, env or flags that set it
+func configShow(withOrigin bool) error {
+	merged, origins := mergeConfigLayers(Home.layers)
+	merged = redactConfigSecrets(merged).(yaml.MapSlice)
+	if !withOrigin {
+		content, err := yaml.Marshal(merged)
+		if err != nil {
+			return errs.WithE(err, "Failed to marshal configuration")
+		}
+		fmt.Print(string(content))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tORIGIN")
+	common.YamlMapLeaves(merged, func(path []string, value interface{}) {
+		key := strings.Join(path, ".")
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key, formatConfigValue(value), origins[key])
+	})
+	return w.Flush()
+}
+
+// formatConfigValue writes lists and maps on one line, as yaml flow
+func formatConfigValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "~"
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			items = append(items, formatConfigValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case yaml.MapSlice:
+		entries := []string{}
+		for _, entry := range v {
+			entries = append(entries, fmt.Sprintf("%v: %s", entry.Key, formatConfigValue(entry.Value)))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// redactConfigSecrets replaces passwords and tokens of credentials, to be displayed
+func redactConfigSecrets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		redacted := yaml.MapSlice{}
+		for _, item := range v {
+			if key, ok := item.Key.(string); ok && configSecretKeys[key] && item.Value != nil {
+				redacted = append(redacted, yaml.MapItem{Key: item.Key, Value: "<redacted>"})
+				continue
+			}
+			redacted = append(redacted, yaml.MapItem{Key: item.Key, Value: redactConfigSecrets(item.Value)})
+		}
+		return redacted
+	case []interface{}:
+		redacted := []interface{}{}
+		for _, item := range v {
+			redacted = append(redacted, redactConfigSecrets(item))
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// configValidate checks each layer for unknown keys and invalid values, then the effective configuration
+func configValidate() error {
+	layers, err := loadConfigLayers(Home.path)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, layer := range layers {
+		if len(layer.content) == 0 && layer.file == "" {
+			continue
+		}
+		configErrors := validateConfigContent(layer.content)
+		common.YamlMapLeaves(layer.content, func(path []string, value interface{}) {
+			if _, _, err := configKeyPath(path); err != nil {
+				configErrors = append(configErrors, err)
+			}
+		})
+		for _, err := range configErrors {
+			logs.WithEF(err, data.WithField("origin", layer.origin)).Error("Invalid configuration")
+			failed = true
+		}
+		if len(configErrors) == 0 {
+			logs.WithField("origin", layer.origin).Info("Configuration valid")
+		}
+	}
+
+	merged, _ := mergeConfigLayers(layers)
+	for _, err := range validateConfigContent(merged) {
+		logs.WithEF(err, data.WithField("origin", "merged")).Error("Invalid configuration")
+		failed = true
+	}
+	if failed {
+		return errs.With("Configuration is not valid")
+	}
+	return nil
+}
+
+// validateConfigContent checks types of values and what is validated when loading the home
+func validateConfigContent(content yaml.MapSlice) []error {
+	source, err := yaml.Marshal(content)
+	if err != nil {
+		return []error{errs.WithE(err, "Failed to marshal configuration")}
+	}
+	var config Config
+	if err := yaml.Unmarshal(source, &config); err != nil {
+		return []error{errs.WithE(err, "Invalid configuration value")}
+	}
+
+	configErrors := []error{}
+	if err := config.Upload.Validate(); err != nil {
+		configErrors = append(configErrors, err)
+	}
+	if err := config.Auths.Validate(); err != nil {
+		configErrors = append(configErrors, err)
+	}
+	if err := config.Discovery.Validate(); err != nil {
+		configErrors = append(configErrors, err)
+	}
+	if config.Signs != nil {
+		for _, sign := range *config.Signs {
+			if err := validateSign(sign); err != nil {
+				configErrors = append(configErrors, err)
+			}
+		}
+	}
+	for _, resolver := range config.Resolvers {
+		if _, err := NewLatestResolver(resolver); err != nil {
+			configErrors = append(configErrors, err)
+		}
+	}
+	for _, push := range config.Pushes {
+		if _, err := NewPushBackend(push); err != nil {
+			configErrors = append(configErrors, err)
+		}
+	}
+	return configErrors
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/blablacar/dgr/dgr/discovery"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const pathDiscoveryCache = "/cache/discovery"
+
+// keyLocks serializes lookups of the same key, so parallel builds wait for the first one to cache the result
+// instead of looking it up each
+type keyLocks struct {
+	sync.Mutex
+	keys map[string]*sync.Mutex
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{keys: make(map[string]*sync.Mutex)}
+}
+
+// lock locks the key, returning the unlock function
+func (l *keyLocks) lock(key string) func() {
+	l.Lock()
+	mutex, ok := l.keys[key]
+	if !ok {
+		mutex = &sync.Mutex{}
+		l.keys[key] = mutex
+	}
+	l.Unlock()
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// discoverEndpoints discovers the endpoints of the app, or only its public keys, with the credentials of dgr.
+// Results are read from the cache while not expired. In offline mode, nothing is discovered and the cache
+// is used even expired.
+func discoverEndpoints(app discovery.App, publicKeys bool) (*discovery.Endpoints, []discovery.FailedAttempt, error) {
+	key := discoveryCacheKey(app, publicKeys)
+	fields := data.WithField("name", app.Name)
+	offline := Home.Config.Discovery.Offline
+	defer Home.lookups.lock(key)()
+
+	endpoints := &discovery.Endpoints{}
+	found, err := Home.cache.Get(key, endpoints, offline)
+	if err != nil {
+		return nil, nil, err
+	}
+	if found {
+		logs.WithF(fields).Debug("Discovery read from cache")
+		return endpoints, nil, nil
+	}
+	if offline {
+		return nil, nil, errs.WithF(fields, "Offline mode and discovery is not in cache")
+	}
+
+	headers, err := discoveryHeaders(app)
+	if err != nil {
+		return nil, nil, err
+	}
+	insecure := Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption()
+	var attempts []discovery.FailedAttempt
+	if publicKeys {
+		endpoints, attempts, err = discovery.DiscoverPublicKeys(app, headers, insecure)
+	} else {
+		endpoints, attempts, err = discovery.DiscoverEndpoints(app, headers, insecure)
+	}
+	if err != nil {
+		return nil, attempts, err
+	}
+	if len(endpoints.ACIEndpoints) != 0 || len(endpoints.Keys) != 0 || len(endpoints.ACIPushEndpoints) != 0 {
+		if err := Home.cache.Set(key, endpoints); err != nil {
+			logs.WithEF(err, fields).Warn("Failed to cache discovery")
+		}
+	}
+	return endpoints, attempts, nil
+}
+
+// latestVersion returns the latest version of the image with the resolver of its domain.
+// Except for local directories, it is read from the cache like discovery.
+func latestVersion(name common.ACFullname) (string, error) {
+	key := "latest:" + name.Name()
+	fields := data.WithField("name", name.Name())
+	offline := Home.Config.Discovery.Offline
+
+	config := Home.Config.GetResolverConfig(name.DomainName())
+	resolver, err := NewLatestResolver(config)
+	if err != nil {
+		return "", err
+	}
+	if config.Type == resolverTypeDirectory {
+		return resolver.LatestVersion(name)
+	}
+
+	defer Home.lookups.lock(key)()
+	var version string
+	found, err := Home.cache.Get(key, &version, offline)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return version, nil
+	}
+	if offline {
+		return "", errs.WithF(fields, "Offline mode and latest version is not in cache")
+	}
+
+	version, err = resolver.LatestVersion(name)
+	if err != nil {
+		return "", err
+	}
+	if err := Home.cache.Set(key, version); err != nil {
+		logs.WithEF(err, fields).Warn("Failed to cache latest version")
+	}
+	return version, nil
+}
+
+// checkOnline fails in offline mode, for what has no cache
+func checkOnline(fields data.Fields, action string) error {
+	if Home.Config.Discovery.Offline {
+		return errs.WithF(fields, "Offline mode, cannot "+action)
+	}
+	return nil
+}
+
+func discoveryCacheKey(app discovery.App, publicKeys bool) string {
+	kind := "endpoints"
+	if publicKeys {
+		kind = "keys"
+	}
+	labels := []string{}
+	for name, value := range app.Labels {
+		labels = append(labels, name.String()+"="+value)
+	}
+	sort.Strings(labels)
+	return kind + ":" + app.Name.String() + "," + strings.Join(labels, ",")
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"regexp"
 	"strings"
 
@@ -51,6 +52,7 @@ func (e *Endpoints) Append(ep Endpoints) {
 
 const (
 	defaultVersion = "latest"
+	defaultExt     = "aci"
 )
 
 var (
@@ -126,13 +128,13 @@ func createTemplateVars(app App) []string {
 	return tplVars
 }
 
-func doDiscover(pre string, app App, insecure discovery.InsecureOption) (*Endpoints, error) {
+func doDiscover(pre string, app App, hostHeaders map[string]http.Header, insecure discovery.InsecureOption) (*Endpoints, error) {
 	app = *app.Copy()
 	if app.Labels["version"] == "" {
 		app.Labels["version"] = defaultVersion
 	}
 
-	_, body, err := httpsOrHTTP(pre, nil, insecure)
+	_, body, err := httpsOrHTTP(pre, hostHeaders, insecure)
 	if err != nil {
 		return nil, err
 	}
@@ -142,6 +144,15 @@ func doDiscover(pre string, app App, insecure discovery.InsecureOption) (*Endpoi
 
 	tplVars := createTemplateVars(app)
 
+	// the ext label selects the artifact to discover (pod manifests are not acis), its signature being ext.asc
+	ext := defaultExt
+	artifactApp := app.Copy()
+	if e := artifactApp.Labels["ext"]; e != "" {
+		ext = e
+		delete(artifactApp.Labels, "ext")
+	}
+	artifactTplVars := createTemplateVars(*artifactApp)
+
 	de := &Endpoints{}
 
 	for _, m := range meta {
@@ -152,12 +163,12 @@ func doDiscover(pre string, app App, insecure discovery.InsecureOption) (*Endpoi
 		switch m.name {
 		case "ac-discovery":
 			// Ignore not handled variables as {ext} isn't already rendered.
-			uri, _ := renderTemplate(m.uri, tplVars...)
-			asc, ok := renderTemplate(uri, "{ext}", "aci.asc")
+			uri, _ := renderTemplate(m.uri, artifactTplVars...)
+			asc, ok := renderTemplate(uri, "{ext}", ext+".asc")
 			if !ok {
 				continue
 			}
-			aci, ok := renderTemplate(uri, "{ext}", "aci")
+			aci, ok := renderTemplate(uri, "{ext}", ext)
 			if !ok {
 				continue
 			}
@@ -176,8 +187,9 @@ func doDiscover(pre string, app App, insecure discovery.InsecureOption) (*Endpoi
 
 // DiscoverWalk will make HTTPS requests to find discovery meta tags and
 // optionally will use HTTP if insecure is set. Based on the response of the
-// discoverFn it will continue to recurse up the tree.
-func DiscoverWalk(app App, insecure discovery.InsecureOption, discoverFn DiscoverWalkFunc) (err error) {
+// discoverFn it will continue to recurse up the tree. hostHeaders are sent to
+// their host, to discover on servers requiring authentication.
+func DiscoverWalk(app App, hostHeaders map[string]http.Header, insecure discovery.InsecureOption, discoverFn DiscoverWalkFunc) (err error) {
 	var (
 		eps *Endpoints
 	)
@@ -187,7 +199,7 @@ func DiscoverWalk(app App, insecure discovery.InsecureOption, discoverFn Discove
 		end := len(parts) - i
 		pre := strings.Join(parts[:end], "/")
 
-		eps, err = doDiscover(pre, app, insecure)
+		eps, err = doDiscover(pre, app, hostHeaders, insecure)
 		if derr := discoverFn(pre, eps, err); derr != nil {
 			return derr
 		}
@@ -223,7 +235,7 @@ func walker(out *Endpoints, attempts *[]FailedAttempt, testFn DiscoverWalkFunc)
 // DiscoverEndpoints will make HTTPS requests to find the ac-discovery meta
 // tags and optionally will use HTTP if insecure is set. It will not give up
 // until it has exhausted the path or found an image discovery.
-func DiscoverEndpoints(app App, insecure discovery.InsecureOption) (out *Endpoints, attempts []FailedAttempt, err error) {
+func DiscoverEndpoints(app App, hostHeaders map[string]http.Header, insecure discovery.InsecureOption) (out *Endpoints, attempts []FailedAttempt, err error) {
 	out = &Endpoints{}
 	testFn := func(pre string, eps *Endpoints, err error) error {
 		if len(out.ACIEndpoints) != 0 || len(out.Keys) != 0 || len(out.ACIPushEndpoints) != 0 {
@@ -232,7 +244,7 @@ func DiscoverEndpoints(app App, insecure discovery.InsecureOption) (out *Endpoin
 		return nil
 	}
 
-	err = DiscoverWalk(app, insecure, walker(out, &attempts, testFn))
+	err = DiscoverWalk(app, hostHeaders, insecure, walker(out, &attempts, testFn))
 	if err != nil && err != errEnough {
 		return nil, attempts, err
 	}
@@ -243,7 +255,7 @@ func DiscoverEndpoints(app App, insecure discovery.InsecureOption) (out *Endpoin
 // DiscoverPublicKey will make HTTPS requests to find the ac-public-keys meta
 // tags and optionally will use HTTP if insecure is set. It will not give up
 // until it has exhausted the path or found an public key.
-func DiscoverPublicKeys(app App, insecure discovery.InsecureOption) (out *Endpoints, attempts []FailedAttempt, err error) {
+func DiscoverPublicKeys(app App, hostHeaders map[string]http.Header, insecure discovery.InsecureOption) (out *Endpoints, attempts []FailedAttempt, err error) {
 	out = &Endpoints{}
 	testFn := func(pre string, eps *Endpoints, err error) error {
 		if len(out.Keys) != 0 {
@@ -252,7 +264,7 @@ func DiscoverPublicKeys(app App, insecure discovery.InsecureOption) (out *Endpoi
 		return nil
 	}
 
-	err = DiscoverWalk(app, insecure, walker(out, &attempts, testFn))
+	err = DiscoverWalk(app, hostHeaders, insecure, walker(out, &attempts, testFn))
 	if err != nil && err != errEnough {
 		return nil, attempts, err
 	}
@@ -3,6 +3,8 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/blablacar/dgr/dgr/common"
 	"github.com/n0rad/go-erlog/data"
@@ -14,85 +16,211 @@ import (
 var Home HomeStruct
 
 type Sign struct {
-	Domains  []string `yaml:"domains"`
-	Keyring  string   `yaml:"keyring"`
-	Disabled bool     `yaml:"disabled"`
+	Domains    []string `yaml:"domains"`
+	Keyring    string   `yaml:"keyring"`
+	Disabled   bool     `yaml:"disabled"`
+	Backend    string   `yaml:"backend,omitempty"`    // gpg (default) or openpgp
+	Passphrase string   `yaml:"passphrase,omitempty"` // file:<path>, env:<name> or agent
+	KeyId      string   `yaml:"keyId,omitempty"`      // key id or fingerprint, first private key of keyring otherwise
+	Files      string   `yaml:"files,omitempty"`      // aci, gz or both, default signs the file used by the command
+	Required   bool     `yaml:"required,omitempty"`   // fail when the image cannot be signed
+}
+
+type PushConfig struct {
+	Domains    []string `yaml:"domains,omitempty"`
+	Type       string   `yaml:"type,omitempty"`
+	Url        string   `yaml:"url,omitempty"`
+	Username   string   `yaml:"username,omitempty"`
+	Password   string   `yaml:"password,omitempty"`
+	GroupId    string   `yaml:"groupId,omitempty"`
+	Repository string   `yaml:"repository,omitempty"`
+	Path       string   `yaml:"path,omitempty"`
+	Template   string   `yaml:"template,omitempty"`
+
+	Bucket          string `yaml:"bucket,omitempty"`
+	Prefix          string `yaml:"prefix,omitempty"`
+	Endpoint        string `yaml:"endpoint,omitempty"`
+	Region          string `yaml:"region,omitempty"`
+	AccessKeyId     string `yaml:"accessKeyId,omitempty"`
+	SecretAccessKey string `yaml:"secretAccessKey,omitempty"`
 }
 
 type Config struct {
-	Path  string
-	Signs *[]Sign `yaml:"sign,omitempty"`
-	Push  struct {
-		Type     string `yaml:"type,omitempty"`
-		Url      string `yaml:"url,omitempty"`
-		Username string `yaml:"username,omitempty"`
-		Password string `yaml:"password,omitempty"`
-	} `yaml:"push,omitempty"`
-	Rkt           common.RktConfig `yaml:"rkt"`
-	TargetWorkDir string           `yaml:"targetWorkDir,omitempty"`
+	Path      string
+	Signs     *[]Sign                `yaml:"sign,omitempty"`
+	Push      PushConfig             `yaml:"push,omitempty"` // deprecated, use pushes
+	Pushes    []PushConfig           `yaml:"pushes,omitempty"`
+	Upload    common.UploadConfig    `yaml:"upload,omitempty"`
+	Auths     common.Auths           `yaml:"auth,omitempty"`
+	Discovery common.DiscoveryConfig `yaml:"discovery,omitempty"`
+	Resolvers []ResolverConfig       `yaml:"resolvers,omitempty"`
+	Rkt       common.RktConfig       `yaml:"rkt"`
+	Builder   struct {
+		Resources common.BuilderResources `yaml:"resources,omitempty"`
+	} `yaml:"builder,omitempty"`
+	TargetWorkDir string `yaml:"targetWorkDir,omitempty"`
 }
 
+// HomeStruct is set once before commands run and only read afterwards, by the parallel builds of a pod's acis too.
+// Its discovery cache is written under the lock of the key looked up.
 type HomeStruct struct {
-	path   string
-	Config Config
-	Rkt    *common.RktClient
+	path    string
+	Config  Config
+	Rkt     *common.RktClient
+	layers  []configLayer
+	cache   common.DiscoveryCache
+	lookups *keyLocks
 }
 
 func (cfg *Config) GetSignKeyring(domain string) (*Sign, error) {
-	var keyring *Sign
-	for _, sign := range *cfg.Signs {
+	sign, _, err := cfg.MatchSignRule(domain)
+	return sign, err
+}
+
+// MatchSignRule returns the sign entry of the most specific domain pattern matching the domain, with the pattern.
+// An entry without domains applies to domains not matched by any other.
+func (cfg *Config) MatchSignRule(domain string) (*Sign, string, error) {
+	var match *Sign
+	matchPattern := ""
+	matchScore := 0
+	var fallback *Sign
+	for i, sign := range *cfg.Signs {
 		if len(sign.Domains) == 0 {
-			keyring = &sign
-		} else {
-			for _, signDomain := range sign.Domains {
-				if signDomain == domain {
-					return &sign, nil
-				}
+			fallback = &(*cfg.Signs)[i]
+			continue
+		}
+		for _, pattern := range sign.Domains {
+			if score := common.MatchDomain(pattern, domain); score > matchScore {
+				match, matchPattern, matchScore = &(*cfg.Signs)[i], pattern, score
 			}
 		}
 	}
-	if keyring == nil {
-		return nil, errs.WithF(data.WithField("domain", domain), "Cannot found keyring for this domain on dgr configuration")
+	if match != nil {
+		return match, matchPattern, nil
+	}
+	if fallback != nil {
+		return fallback, "", nil
+	}
+	return nil, "", errs.WithF(data.WithField("domain", domain), "Cannot found keyring for this domain on dgr configuration")
+}
+
+// Redacted returns a copy of the configuration without passwords, tokens and secret keys, to be displayed
+func (cfg Config) Redacted() Config {
+	cfg.Push = cfg.Push.Redacted()
+	pushes := make([]PushConfig, len(cfg.Pushes))
+	for i, push := range cfg.Pushes {
+		pushes[i] = push.Redacted()
+	}
+	cfg.Pushes = pushes
+	auths := make(common.Auths, len(cfg.Auths))
+	for i, auth := range cfg.Auths {
+		auths[i] = auth.Redacted()
+	}
+	cfg.Auths = auths
+	return cfg
+}
+
+func (p PushConfig) Redacted() PushConfig {
+	if p.Password != "" {
+		p.Password = "<redacted>"
 	}
-	return keyring, nil
+	if p.SecretAccessKey != "" {
+		p.SecretAccessKey = "<redacted>"
+	}
+	return p
+}
+
+// GetPushConfig returns the push configuration of the domain, or the one without domains.
+// Images are pushed with the appc push protocol when none match.
+func (cfg *Config) GetPushConfig(domain string) PushConfig {
+	var fallback *PushConfig
+	for i, push := range cfg.Pushes {
+		if len(push.Domains) == 0 {
+			if fallback == nil {
+				fallback = &cfg.Pushes[i]
+			}
+			continue
+		}
+		for _, pushDomain := range push.Domains {
+			if pushDomain == domain {
+				return push
+			}
+		}
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	return PushConfig{Type: pushTypeAppc}
 }
 
 func NewHome(path string) HomeStruct {
 	logs.WithField("path", path).Debug("Loading home")
 
+	layers, err := loadConfigLayers(path)
+	if err != nil {
+		logs.WithE(err).Fatal("Failed to load configuration")
+	}
+	merged, _ := mergeConfigLayers(layers)
+	content, err := yaml.Marshal(merged)
+	if err != nil {
+		logs.WithE(err).Fatal("Failed to marshal configuration")
+	}
 	var config Config
-	if source, err := ioutil.ReadFile(path + "/config.yml"); err == nil {
-		err = yaml.Unmarshal([]byte(source), &config)
-		if err != nil {
-			logs.WithEF(err, data.WithField("path", path+"/config.yml")).Fatal("Failed to process configuration file")
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		logs.WithE(err).Fatal("Failed to process configuration")
+	}
+
+	if config.Push.Type == pushTypeMaven {
+		if len(config.Push.Domains) == 0 || config.Push.GroupId == "" {
+			logs.Fatal("push in configuration is deprecated and requires domains and groupId, move it to pushes " +
+				"with the domains of the images it was used for and their groupId")
 		}
-	} else if source, err := ioutil.ReadFile(DefaultHomeFolder("cnt") + "/config.yml"); err == nil {
-		logs.WithField("old", DefaultHomeFolder("cnt")+"/config.yml").WithField("new", DefaultHomeFolder("")).Warn("You are using old home folder")
-		err = yaml.Unmarshal([]byte(source), &config)
-		if err != nil {
-			logs.WithEF(err, data.WithField("path", path+"/config.yml")).Fatal("Failed to process configuration file")
+		logs.Warn("push in configuration is deprecated, use pushes")
+		config.Pushes = append(config.Pushes, config.Push)
+	}
+	if err := config.Upload.Validate(); err != nil {
+		logs.WithE(err).Fatal("Invalid upload configuration")
+	}
+	if err := config.Auths.Validate(); err != nil {
+		logs.WithE(err).Fatal("Invalid auth configuration")
+	}
+	for _, resolver := range config.Resolvers {
+		if _, err := NewLatestResolver(resolver); err != nil {
+			logs.WithE(err).Fatal("Invalid resolver configuration")
 		}
 	}
-
-	if Args.NoStore {
-		config.Rkt.NoStore = true
+	ttl, err := config.Discovery.Ttl()
+	if err != nil {
+		logs.WithE(err).Fatal("Invalid discovery configuration")
 	}
-	if Args.StoreOnly {
+	if config.Discovery.Offline {
+		if config.Rkt.NoStore {
+			logs.Fatal("Offline mode requires the rkt store, remove no-store")
+		}
 		config.Rkt.StoreOnly = true
 	}
 	if config.Signs == nil {
 		config.Signs = &[]Sign{{Disabled: true}}
 	}
+	for _, sign := range *config.Signs {
+		if err := validateSign(sign); err != nil {
+			logs.WithE(err).Fatal("Invalid sign configuration")
+		}
+	}
 
-	rkt, err := common.NewRktClient(config.Rkt)
+	rkt, err := common.NewRktClient(config.Rkt, config.Auths)
 	if err != nil {
 		logs.WithEF(err, data.WithField("config", config.Rkt)).Fatal("Rkt access failed")
 	}
+	rkt.FetchHosts = fetchHosts
 
 	return HomeStruct{
-		path:   path,
-		Config: config,
-		Rkt:    rkt,
+		path:    path,
+		Config:  config,
+		Rkt:     rkt,
+		layers:  layers,
+		cache:   common.NewDiscoveryCache(path+pathDiscoveryCache, ttl),
+		lookups: newKeyLocks(),
 	}
 }
 
@@ -111,3 +239,57 @@ func DefaultHomeFolder(programName string) string {
 	}
 	return path
 }
+
+// UpdateConfig rewrites config.yml of the home with the update of its content, without its comments
+func (h HomeStruct) UpdateConfig(update func(config yaml.MapSlice) (yaml.MapSlice, error)) error {
+	return updateConfigFile(h.path+"/config.yml", update)
+}
+
+// updateConfigFile rewrites a configuration file with the update of its content, keeping a backup of the
+// previous file. Comments are not kept, with a warning when the file had some.
+func updateConfigFile(path string, update func(config yaml.MapSlice) (yaml.MapSlice, error)) error {
+	fields := data.WithField("path", path)
+
+	var config yaml.MapSlice
+	source, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errs.WithEF(err, fields, "Failed to read configuration file")
+	}
+	if err := yaml.Unmarshal(source, &config); err != nil {
+		return errs.WithEF(err, fields, "Failed to process configuration file")
+	}
+
+	config, err = update(config)
+	if err != nil {
+		return err
+	}
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to marshal configuration")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errs.WithEF(err, fields, "Failed to create configuration directory")
+	}
+	if source != nil {
+		if err := ioutil.WriteFile(path+".bak", source, 0600); err != nil {
+			return errs.WithEF(err, fields, "Failed to backup configuration file")
+		}
+	}
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return errs.WithEF(err, fields, "Failed to write configuration file")
+	}
+	if hasYamlComments(string(source)) {
+		logs.WithF(fields.WithField("backup", path+".bak")).Warn("Comments of configuration file are not kept")
+	}
+	return nil
+}
+
+func hasYamlComments(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") || strings.Contains(line, " #") {
+			return true
+		}
+	}
+	return false
+}
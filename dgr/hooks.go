@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const pathHooks = "/hooks"
+
+const envHook = "DGR_HOOK"
+const envHookName = "ACI_NAME"
+const envHookVersion = "ACI_VERSION"
+const envHookFullname = "ACI_FULLNAME"
+const envHookImage = "ACI_IMAGE"
+
+type Hook string
+
+const (
+	HookPreBuild    Hook = "pre-build"
+	HookPostBuild   Hook = "post-build"
+	HookPreTest     Hook = "pre-test"
+	HookPostTest    Hook = "post-test"
+	HookPreInstall  Hook = "pre-install"
+	HookPostInstall Hook = "post-install"
+	HookPrePush     Hook = "pre-push"
+	HookPostPush    Hook = "post-push"
+)
+
+type HookEnv struct {
+	Path     string
+	Target   string
+	Fullname common.ACFullname
+	Image    string
+}
+
+func (e HookEnv) toEnv(hook Hook) []string {
+	return []string{
+		envHook + "=" + string(hook),
+		common.EnvAciPath + "=" + e.Path,
+		common.EnvAciTarget + "=" + e.Target,
+		envHookName + "=" + e.Fullname.Name(),
+		envHookVersion + "=" + e.Fullname.Version(),
+		envHookFullname + "=" + e.Fullname.String(),
+		envHookImage + "=" + e.Image,
+	}
+}
+
+// runHooks executes on the host, in name order, every file found in the hook directory of the project.
+// The first failing file stops the execution and its error is returned.
+func runHooks(hook Hook, env HookEnv, fields data.Fields) error {
+	dir := env.Path + pathHooks + "/" + string(hook)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errs.WithEF(err, fields.WithField("path", dir), "Cannot read hook directory")
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		file := dir + "/" + f.Name()
+		hookFields := fields.WithField("hook", hook).WithField("file", file)
+
+		logs.WithF(hookFields).Info("Running hook")
+		cmd := exec.Command(file)
+		if f.Mode()&0111 == 0 { // source files are not modified, not executable ones are shell scripts
+			cmd = exec.Command("/bin/sh", file)
+		}
+		cmd.Dir = env.Path
+		cmd.Env = append(os.Environ(), env.toEnv(hook)...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return errs.WithEF(err, hookFields, "Hook failed")
+		}
+	}
+	return nil
+}
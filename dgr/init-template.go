@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/blablacar/dgr/dist"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+	"gopkg.in/yaml.v2"
+)
+
+const pathInitTemplates = "/templates"
+const assetInitTemplates = "init-templates"
+
+const initTemplateSourceBuiltin = "builtin"
+const initTemplateSourceHome = "home"
+
+var gitUrlPrefixes = []string{"git@", "git://", "ssh://", "http://", "https://"}
+
+func initTemplateAttributes(path string, overrides envMap) (map[string]interface{}, error) {
+	fullPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Cannot get fullpath")
+	}
+	attributes := map[string]interface{}{
+		"name":    filepath.Base(fullPath),
+		"domain":  "aci.example.com",
+		"version": "1",
+	}
+	for k, v := range overrides.mapping {
+		attributes[k] = v
+	}
+	return attributes, nil
+}
+
+// listInitTemplates returns templates of the home first, they hide builtin ones with the same name
+func listInitTemplates() ([]*common.InitTemplate, error) {
+	templates := []*common.InitTemplate{}
+	names := make(map[string]bool)
+
+	homeDir := Home.path + pathInitTemplates
+	if files, err := ioutil.ReadDir(homeDir); err == nil {
+		for _, f := range files {
+			if !f.IsDir() {
+				continue
+			}
+			tmpl, err := common.ReadInitTemplate(f.Name(), homeDir+"/"+f.Name(), initTemplateSourceHome)
+			if err != nil {
+				return nil, err
+			}
+			templates = append(templates, tmpl)
+			names[f.Name()] = true
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errs.WithEF(err, data.WithField("path", homeDir), "Failed to read init templates directory")
+	}
+
+	builtins, _ := dist.AssetDir(assetInitTemplates)
+	sort.Strings(builtins)
+	for _, name := range builtins {
+		if names[name] {
+			continue
+		}
+		tmpl := &common.InitTemplate{Name: name, Source: initTemplateSourceBuiltin}
+		if content, err := dist.Asset(assetInitTemplates + "/" + name + common.PathInitTemplateYml); err == nil {
+			if err := yaml.Unmarshal(content, tmpl); err != nil {
+				return nil, errs.WithEF(err, data.WithField("template", name), "Failed to unmarshal init template description")
+			}
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, nil
+}
+
+// findInitTemplate resolves a template name, a directory or a git repository with an optional
+// sub-directory as 'url//dir'. The returned function removes what was extracted or cloned.
+func findInitTemplate(ref string) (*common.InitTemplate, func(), error) {
+	noop := func() {}
+	fields := data.WithField("template", ref)
+
+	if isGitUrl(ref) {
+		return cloneInitTemplate(ref)
+	}
+	if strings.Contains(ref, "/") || strings.HasPrefix(ref, ".") {
+		tmpl, err := common.ReadInitTemplate(filepath.Base(ref), ref, ref)
+		return tmpl, noop, err
+	}
+
+	templates, err := listInitTemplates()
+	if err != nil {
+		return nil, noop, err
+	}
+	for _, tmpl := range templates {
+		if tmpl.Name != ref {
+			continue
+		}
+		if tmpl.Source != initTemplateSourceBuiltin {
+			return tmpl, noop, nil
+		}
+
+		dir, err := ioutil.TempDir("", "dgr-init-template")
+		if err != nil {
+			return nil, noop, errs.WithEF(err, fields, "Failed to create temporary directory")
+		}
+		cleanup := func() { os.RemoveAll(dir) }
+		if err := dist.RestoreAssets(dir, assetInitTemplates+"/"+ref); err != nil {
+			cleanup()
+			return nil, noop, errs.WithEF(err, fields, "Failed to extract builtin init template")
+		}
+		tmpl.Path = dir + "/" + assetInitTemplates + "/" + ref
+		return tmpl, cleanup, nil
+	}
+	return nil, noop, errs.WithF(fields, "Init template not found, use --list-templates to see available ones")
+}
+
+func isGitUrl(ref string) bool {
+	if strings.HasSuffix(ref, ".git") || strings.Contains(ref, ".git//") {
+		return true
+	}
+	for _, prefix := range gitUrlPrefixes {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneInitTemplate(ref string) (*common.InitTemplate, func(), error) {
+	noop := func() {}
+	url, subDir := ref, ""
+	schemeEnd := 0
+	if i := strings.Index(ref, "://"); i != -1 {
+		schemeEnd = i + 3
+	}
+	if i := strings.Index(ref[schemeEnd:], "//"); i != -1 {
+		url, subDir = ref[:schemeEnd+i], ref[schemeEnd+i+2:]
+	}
+	fields := data.WithField("url", url).WithField("dir", subDir)
+
+	dir, err := ioutil.TempDir("", "dgr-init-template")
+	if err != nil {
+		return nil, noop, errs.WithEF(err, fields, "Failed to create temporary directory")
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	logs.WithF(fields).Info("Cloning init template")
+	if err := common.ExecCmd("git", "clone", "--depth", "1", url, dir); err != nil {
+		cleanup()
+		return nil, noop, errs.WithEF(err, fields, "Failed to clone init template")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(url), ".git")
+	if subDir != "" {
+		name = filepath.Base(subDir)
+	}
+	tmpl, err := common.ReadInitTemplate(name, dir+"/"+subDir, ref)
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	return tmpl, cleanup, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"gopkg.in/yaml.v2"
+)
+
+const pathKeys = "/keys"
+
+// generateKey writes an armored private key in the home and sets it as keyring of the domain.
+// The key is not encrypted, the file being only readable by its owner.
+func generateKey(domain string, name string, email string, force bool) error {
+	fields := data.WithField("domain", domain)
+	if email == "" {
+		email = "dgr@" + domain
+	}
+	keyring := Home.path + pathKeys + "/" + domain + ".asc"
+	if _, err := os.Stat(keyring); err == nil && !force {
+		return errs.WithF(fields.WithField("keyring", keyring), "Key already exists for domain, use --force to replace it")
+	}
+
+	logs.WithF(fields).Info("Generating key")
+	entity, err := openpgp.NewEntity(name, domain, email, nil)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to generate key")
+	}
+	var secret bytes.Buffer
+	w, err := armor.Encode(&secret, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to armor key")
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil { // also self-signs identities
+		return errs.WithEF(err, fields, "Failed to serialize key")
+	}
+	w.Close()
+
+	if err := os.MkdirAll(Home.path+pathKeys, 0700); err != nil {
+		return errs.WithEF(err, fields, "Failed to create keys directory")
+	}
+	if err := ioutil.WriteFile(keyring, secret.Bytes(), 0600); err != nil {
+		return errs.WithEF(err, fields.WithField("keyring", keyring), "Failed to write key")
+	}
+
+	if err := Home.UpdateConfig(func(config yaml.MapSlice) (yaml.MapSlice, error) {
+		return setSignKeyring(config, domain, keyring), nil
+	}); err != nil {
+		return err
+	}
+	logs.WithF(fields.WithField("keyring", keyring).WithField("fingerprint", common.KeyFingerprint(entity))).Info("Key generated")
+	return nil
+}
+
+// setSignKeyring replaces the domain in sign entries by an entry with the keyring. Signing is disabled for
+// other domains when there was no sign configuration, as it was.
+func setSignKeyring(config yaml.MapSlice, domain string, keyring string) yaml.MapSlice {
+	entries := []interface{}{yaml.MapSlice{{Key: "domains", Value: []interface{}{domain}}, {Key: "keyring", Value: keyring},
+		{Key: "backend", Value: common.SignBackendOpenpgp}}}
+
+	current, exists := common.YamlMapGet(config, "sign")
+	list, _ := current.([]interface{})
+	if !exists || current == nil {
+		entries = append(entries, yaml.MapSlice{{Key: "disabled", Value: true}})
+	}
+	for _, e := range list {
+		entry, ok := e.(yaml.MapSlice)
+		if !ok {
+			entries = append(entries, e)
+			continue
+		}
+		value, _ := common.YamlMapGet(entry, "domains")
+		domains, _ := value.([]interface{})
+		if len(domains) == 0 {
+			entries = append(entries, entry)
+			continue
+		}
+		remaining := []interface{}{}
+		for _, d := range domains {
+			if d != domain {
+				remaining = append(remaining, d)
+			}
+		}
+		if len(remaining) > 0 {
+			entries = append(entries, common.YamlMapSet(entry, remaining, "domains"))
+		}
+	}
+	return common.YamlMapSet(config, entries, "sign")
+}
+
+func listKeys() error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAINS\tBACKEND\tFINGERPRINT\tIDENTITY\tKEYRING")
+	for _, sign := range *Home.Config.Signs {
+		domains := strings.Join(sign.Domains, ",")
+		if domains == "" {
+			domains = "*"
+		}
+		if sign.Disabled {
+			fmt.Fprintf(w, "%s\t-\t-\tsign disabled\t-\n", domains)
+			continue
+		}
+		if sign.backend() == common.SignBackendGpg {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t%s\n", domains, common.SignBackendGpg, sign.Keyring)
+			continue
+		}
+
+		keyring, err := common.ReadKeyringFile(sign.Keyring)
+		if err != nil {
+			logs.WithE(err).Warn("Cannot read keyring")
+			fmt.Fprintf(w, "%s\t%s\t-\tunreadable keyring\t%s\n", domains, common.SignBackendOpenpgp, sign.Keyring)
+			continue
+		}
+		for _, key := range keyring {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", domains, common.SignBackendOpenpgp, common.KeyFingerprint(key), common.KeyIdentity(key), sign.Keyring)
+		}
+	}
+	return w.Flush()
+}
+
+// exportPublicKeys returns the armored public keys of the keyring of the domain
+func exportPublicKeys(domain string) ([]byte, error) {
+	fields := data.WithField("domain", domain)
+	sign, err := Home.Config.GetSignKeyring(domain)
+	if err != nil {
+		return nil, err
+	}
+	if sign.Disabled {
+		return nil, errs.WithF(fields, "Sign is disabled for domain")
+	}
+
+	if sign.backend() == common.SignBackendGpg {
+		out, err := common.ExecCmdGetOutput("gpg", "--no-default-keyring", "--keyring", sign.Keyring, "--armor", "--export")
+		if err != nil {
+			return nil, errs.WithEF(err, fields, "Failed to export keys with gpg")
+		}
+		return []byte(out + "\n"), nil
+	}
+
+	keyring, err := common.ReadKeyringFile(sign.Keyring)
+	if err != nil {
+		return nil, err
+	}
+	var public bytes.Buffer
+	w, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, errs.WithEF(err, fields, "Failed to armor keys")
+	}
+	for _, key := range keyring {
+		if err := key.Serialize(w); err != nil {
+			return nil, errs.WithEF(err, fields.WithField("key", common.KeyIdentity(key)), "Failed to serialize public key")
+		}
+	}
+	w.Close()
+	public.WriteByte('\n')
+	return public.Bytes(), nil
+}
+
+func exportKey(domain string, output string) error {
+	public, err := exportPublicKeys(domain)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err := os.Stdout.Write(public)
+		return err
+	}
+	if err := ioutil.WriteFile(output, public, 0644); err != nil {
+		return errs.WithEF(err, data.WithField("file", output), "Failed to write public key")
+	}
+	return nil
+}
+
+// trustKey writes the public keys in the local rkt configuration, named by fingerprint as rkt trust does
+func trustKey(domain string, prefix string, root bool) error {
+	public, err := exportPublicKeys(domain)
+	if err != nil {
+		return err
+	}
+	keys, err := common.ReadKeyring(public)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("domain", domain), "Failed to read exported keys")
+	}
+
+	if prefix == "" {
+		prefix = domain
+	}
+	_, localConf := rktConfigDirs()
+	dir := localConf + "/trustedkeys/prefix.d/" + prefix
+	if root {
+		dir = localConf + "/trustedkeys/root.d"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errs.WithEF(err, data.WithField("path", dir), "Failed to create trusted keys directory")
+	}
+
+	for _, key := range keys {
+		var armored bytes.Buffer
+		w, _ := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+		if err := key.Serialize(w); err != nil {
+			return errs.WithEF(err, data.WithField("key", common.KeyIdentity(key)), "Failed to serialize public key")
+		}
+		w.Close()
+		path := dir + "/" + strings.ToLower(common.KeyFingerprint(key))
+		if err := ioutil.WriteFile(path, armored.Bytes(), 0644); err != nil {
+			return errs.WithEF(err, data.WithField("path", path), "Failed to write trusted key")
+		}
+		logs.WithField("key", common.KeyIdentity(key)).WithField("path", path).Info("Key trusted")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// directoryLatestResolver finds the greatest version in a local repository, as written by the directory push backend
+type directoryLatestResolver struct {
+	config ResolverConfig
+}
+
+func (r directoryLatestResolver) LatestVersion(name common.ACFullname) (string, error) {
+	tmpl := r.config.Template
+	if tmpl == "" {
+		tmpl = common.PushArtifactTemplate
+	}
+	fields := data.WithField("name", name.Name()).WithField("path", r.config.Path)
+
+	pattern, err := common.VersionPattern(tmpl, name, resolverOs, resolverArch, common.ExtAci)
+	if err != nil {
+		return "", err
+	}
+	files := []string{}
+	if err := filepath.Walk(r.config.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(r.config.Path, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	}); err != nil {
+		return "", errs.WithEF(err, fields, "Failed to list repository directory")
+	}
+
+	version := common.GreatestVersion(common.MatchVersions(pattern, files))
+	if version == "" {
+		return "", errs.WithF(fields.WithField("template", tmpl), "No version found in repository directory")
+	}
+	return version, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const defaultIndexTemplate = "{version}"
+
+// indexLatestResolver lists the links of a directory index page, like the ones of nginx or apache autoindex,
+// the latest version being the greatest of links whose path ends with the template
+type indexLatestResolver struct {
+	config ResolverConfig
+}
+
+func (r indexLatestResolver) LatestVersion(name common.ACFullname) (string, error) {
+	tmpl := r.config.Template
+	if tmpl == "" {
+		tmpl = defaultIndexTemplate
+	}
+	indexUrl := resolverTemplate(r.config.Url, name)
+	fields := data.WithField("name", name.Name()).WithField("url", indexUrl)
+
+	pattern, err := common.VersionPattern(tmpl, name, resolverOs, resolverArch, common.ExtAci)
+	if err != nil {
+		return "", err
+	}
+	content, err := httpGet(indexUrl, Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption())
+	if err != nil {
+		return "", errs.WithEF(err, fields, "Failed to get index")
+	}
+
+	entries, err := indexEntries(indexUrl, content)
+	if err != nil {
+		return "", errs.WithEF(err, fields, "Invalid index url")
+	}
+	version := common.GreatestVersion(common.MatchVersions(pattern, entries))
+	if version == "" {
+		return "", errs.WithF(fields.WithField("template", tmpl), "No version found in index")
+	}
+	return version, nil
+}
+
+// indexEntries returns the paths of links of the page, resolved against its url
+func indexEntries(indexUrl string, content []byte) ([]string, error) {
+	base, err := url.Parse(indexUrl)
+	if err != nil {
+		return nil, err
+	}
+	entries := []string{}
+	z := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return entries, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.DataAtom != atom.A {
+				continue
+			}
+			for _, attr := range tok.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				if link, err := base.Parse(attr.Val); err == nil {
+					entries = append(entries, link.Path)
+				}
+			}
+		}
+	}
+}
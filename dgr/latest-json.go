@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// jsonVersionsIndex is the content of a versions.json, or a list of versions
+type jsonVersionsIndex struct {
+	Latest   string   `json:"latest"`
+	Versions []string `json:"versions"`
+}
+
+// jsonLatestResolver reads a versions.json file, its latest version or else the greatest of its versions
+type jsonLatestResolver struct {
+	config ResolverConfig
+}
+
+func (r jsonLatestResolver) LatestVersion(name common.ACFullname) (string, error) {
+	indexUrl := resolverTemplate(r.config.Url, name)
+	fields := data.WithField("name", name.Name()).WithField("url", indexUrl)
+
+	content, err := httpGet(indexUrl, Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption())
+	if err != nil {
+		return "", errs.WithEF(err, fields, "Failed to get versions index")
+	}
+
+	index := jsonVersionsIndex{}
+	if err := json.Unmarshal(content, &index.Versions); err != nil {
+		if err := json.Unmarshal(content, &index); err != nil {
+			return "", errs.WithEF(err, fields, "Invalid versions index")
+		}
+	}
+	version := index.Latest
+	if version == "" {
+		version = common.GreatestVersion(index.Versions)
+	}
+	if version == "" {
+		return "", errs.WithF(fields, "No version found in versions index")
+	}
+	return version, nil
+}
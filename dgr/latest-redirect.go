@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	appcdiscovery "github.com/appc/spec/discovery"
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/blablacar/dgr/dgr/discovery"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+// a version as a path segment, for repositories redirecting to another layout, like nexus
+var redirectVersionSegment = regexp.MustCompile(`^\d+(.\d+){0,2}(-[\.\-\dA-Za-z]+){0,1}$`)
+
+// redirectLatestResolver discovers the aci of version latest, and reads the version in the url it redirects to
+type redirectLatestResolver struct{}
+
+func (r redirectLatestResolver) LatestVersion(name common.ACFullname) (string, error) {
+	fields := data.WithField("name", name.Name())
+	app, err := discovery.NewAppFromString(name.Name() + ":latest")
+	if err != nil {
+		return "", errs.WithEF(err, fields, "Invalid image name")
+	}
+	if app.Labels["os"] == "" {
+		app.Labels["os"] = resolverOs
+	}
+	if app.Labels["arch"] == "" {
+		app.Labels["arch"] = resolverArch
+	}
+
+	endpoints, _, err := discoverEndpoints(*app, false)
+	if err != nil {
+		return "", errs.WithEF(err, fields, "Latest discovery failed")
+	}
+	if len(endpoints.ACIEndpoints) == 0 {
+		return "", errs.WithF(fields, "Discovery does not give an endpoint to check latest version")
+	}
+
+	aci := endpoints.ACIEndpoints[0].ACI
+	location, err := redirectLocation(aci)
+	if err != nil {
+		return "", errs.WithEF(err, fields.WithField("url", aci), "Failed to get latest redirect")
+	}
+	logs.WithF(fields.WithField("url", location)).Debug("Latest version url")
+
+	if version := versionInRedirect(aci, location); version != "" {
+		return version, nil
+	}
+	return "", errs.WithF(fields.WithField("url", location), "No latest version found in redirect")
+}
+
+// versionInRedirect reads the version replacing 'latest' in the url, or else a path segment looking like a version
+func versionInRedirect(latestUrl string, location string) string {
+	from, err := url.Parse(latestUrl)
+	if err != nil {
+		return ""
+	}
+	to, err := url.Parse(location)
+	if err != nil {
+		return ""
+	}
+
+	if i := strings.Index(from.Path, "latest"); i >= 0 {
+		prefix, suffix := from.Path[:i], from.Path[i+len("latest"):]
+		if strings.HasPrefix(to.Path, prefix) && strings.HasSuffix(to.Path, suffix) && len(to.Path) > len(prefix)+len(suffix) {
+			if version := to.Path[len(prefix) : len(to.Path)-len(suffix)]; !strings.Contains(version, "/") {
+				return version
+			}
+		}
+	}
+
+	for _, part := range strings.Split(to.Path, "/") {
+		if redirectVersionSegment.MatchString(part) {
+			return part
+		}
+	}
+	return ""
+}
+
+// redirectLocation returns where the url redirects to, without following it
+func redirectLocation(target string) (string, error) {
+	fields := data.WithField("url", target)
+	if err := checkOnline(fields, "check latest version"); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return "", errs.WithEF(err, fields, "Failed to prepare request")
+	}
+	if _, err := Home.Config.Auths.SetHeader(req); err != nil {
+		return "", err
+	}
+
+	transport := appcdiscovery.Client.Transport
+	if Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption()&appcdiscovery.InsecureTLS != 0 {
+		transport = appcdiscovery.ClientInsecureTLS.Transport
+	}
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", errs.WithEF(err, fields, "Latest request failed")
+	}
+	res.Body.Close()
+	location, err := res.Location()
+	if err != nil {
+		return "", errs.WithEF(err, fields.WithField("status", res.StatusCode), "Latest version url does not redirect")
+	}
+	return location.String(), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const (
+	resolverTypeRedirect  = "redirect"
+	resolverTypeIndex     = "index"
+	resolverTypeJson      = "json"
+	resolverTypeDirectory = "directory"
+)
+
+const resolverOs = "linux"
+const resolverArch = "amd64"
+
+// ResolverConfig tells how to find the latest version of the images of its domains
+type ResolverConfig struct {
+	Domains  []string `yaml:"domains,omitempty"`
+	Type     string   `yaml:"type"`
+	Url      string   `yaml:"url,omitempty"`      // index and json, with {name}, {os} and {arch}
+	Path     string   `yaml:"path,omitempty"`     // directory
+	Template string   `yaml:"template,omitempty"` // entries of index and files of directory, with {version}
+}
+
+// GetResolverConfig returns the resolver of the most specific domain pattern matching the domain, like sign rules.
+// Latest versions are resolved with the redirect of the discovered aci when none match.
+func (cfg *Config) GetResolverConfig(domain string) ResolverConfig {
+	var match *ResolverConfig
+	matchScore := 0
+	var fallback *ResolverConfig
+	for i, resolver := range cfg.Resolvers {
+		if len(resolver.Domains) == 0 {
+			if fallback == nil {
+				fallback = &cfg.Resolvers[i]
+			}
+			continue
+		}
+		for _, pattern := range resolver.Domains {
+			if score := common.MatchDomain(pattern, domain); score > matchScore {
+				match, matchScore = &cfg.Resolvers[i], score
+			}
+		}
+	}
+	if match != nil {
+		return *match
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	return ResolverConfig{Type: resolverTypeRedirect}
+}
+
+func NewLatestResolver(config ResolverConfig) (common.LatestResolver, error) {
+	fields := data.WithField("type", config.Type)
+	switch config.Type {
+	case resolverTypeRedirect, "":
+		return redirectLatestResolver{}, nil
+	case resolverTypeIndex:
+		if config.Url == "" {
+			return nil, errs.WithF(fields, "Index resolver requires url")
+		}
+		if config.Template != "" {
+			if err := common.CheckVersionTemplate(config.Template); err != nil {
+				return nil, err
+			}
+		}
+		return indexLatestResolver{config: config}, nil
+	case resolverTypeJson:
+		if config.Url == "" {
+			return nil, errs.WithF(fields, "Json resolver requires url")
+		}
+		return jsonLatestResolver{config: config}, nil
+	case resolverTypeDirectory:
+		if config.Path == "" {
+			return nil, errs.WithF(fields, "Directory resolver requires path")
+		}
+		if config.Template != "" {
+			if err := common.CheckVersionTemplate(config.Template); err != nil {
+				return nil, err
+			}
+		}
+		return directoryLatestResolver{config: config}, nil
+	default:
+		return nil, errs.WithF(fields, "Unknown resolver type")
+	}
+}
+
+// configLatestResolver resolves with the resolver configured for the domain of the image, through the discovery cache
+type configLatestResolver struct{}
+
+func (r configLatestResolver) LatestVersion(name common.ACFullname) (string, error) {
+	return latestVersion(name)
+}
+
+// resolverTemplate renders the placeholders of the image in an url or template, {version} being kept
+func resolverTemplate(tmpl string, name common.ACFullname) string {
+	artifact := common.PushArtifact{Name: *common.NewACFullName(name.Name() + ":{version}"), Os: resolverOs, Arch: resolverArch}
+	return artifact.Render(tmpl, common.ExtAci)
+}
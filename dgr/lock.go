@@ -0,0 +1,143 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const pathPodManifestLock = "/pod-manifest.lock"
+
+// lock writes the lock file of the aci or pod of the work path, or of the acis and pods of the workspace.
+// Dependencies already locked keep their pin unless update is set. When frozen, locks are only checked.
+func lock(update bool, frozen bool) error {
+	manifests, err := findManifests(workPath)
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		return errs.WithF(data.WithField("path", workPath), "No aci or pod manifest found")
+	}
+	for _, manifest := range manifests {
+		if err := lockManifest(filepath.Join(workPath, manifest), update, frozen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lockManifest(file string, update bool, frozen bool) error {
+	fields := data.WithField("manifest", file)
+	aci, pod, err := readProjectManifest(file)
+	if err != nil {
+		return err
+	}
+	var deps []common.ACFullname
+	if pod != nil {
+		deps = pod.LockableDependencies()
+	} else {
+		deps = aci.LockableDependencies()
+	}
+
+	if frozen {
+		if _, err := readProjectLock(lockFileOf(file), deps, true, fields); err != nil {
+			return err
+		}
+		logs.WithF(fields).Info("Lock file is up to date")
+		return nil
+	}
+
+	current, err := common.ReadLockFile(lockFileOf(file))
+	if err != nil {
+		return err
+	}
+	lock := common.LockFile{Dependencies: []common.LockedDependency{}}
+	for _, dep := range deps {
+		if current != nil && !update {
+			if locked, ok := current.Get(dep); ok {
+				lock.Dependencies = append(lock.Dependencies, locked)
+				continue
+			}
+		}
+		locked, err := resolveLock(dep)
+		if err != nil {
+			return errs.WithEF(err, fields, "Failed to lock dependency")
+		}
+		logs.WithF(fields.WithField("dependency", dep.String()).WithField("version", locked.Version).WithField("id", locked.Id)).
+			Info("Dependency locked")
+		lock.Dependencies = append(lock.Dependencies, locked)
+	}
+	if err := lock.Write(lockFileOf(file)); err != nil {
+		return err
+	}
+	logs.WithF(fields.WithField("file", lockFileOf(file))).Info("Lock file written")
+	return nil
+}
+
+// resolveLock resolves the version of a dependency, the latest one when not set, and fetches it for its image id
+func resolveLock(dep common.ACFullname) (common.LockedDependency, error) {
+	fields := data.WithField("dependency", dep.String())
+	resolved, err := dep.FullyResolved(configLatestResolver{})
+	if err != nil {
+		return common.LockedDependency{}, errs.WithEF(err, fields, "Failed to resolve version")
+	}
+	id, err := Home.Rkt.Fetch(resolved.String())
+	if err != nil {
+		return common.LockedDependency{}, errs.WithEF(err, fields, "Failed to fetch image")
+	}
+	return common.LockedDependency{Name: dep, Version: resolved.Version(), Id: id}, nil
+}
+
+// readProjectLock reads the lock file of a project for a build. A stale lock only pins the dependencies it still
+// matches, and fails when frozen, like a missing one.
+func readProjectLock(file string, deps []common.ACFullname, frozen bool, fields data.Fields) (*common.LockFile, error) {
+	lock, err := common.ReadLockFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		if frozen {
+			return nil, errs.WithF(fields.WithField("file", file), "No lock file, run dgr lock")
+		}
+		return &common.LockFile{}, nil
+	}
+	if reasons := lock.Stale(deps); len(reasons) > 0 {
+		if frozen {
+			return nil, errs.WithF(fields.WithField("file", file).WithField("reasons", reasons), "Lock file is stale, run dgr lock")
+		}
+		logs.WithF(fields.WithField("file", file).WithField("reasons", reasons)).Warn("Lock file is stale, run dgr lock")
+	}
+	return lock, nil
+}
+
+// verifyLock fetches the locked dependencies missing from the store, failing when the image of a locked version is not the locked one
+func verifyLock(lock common.LockFile, deps []common.ACFullname, fields data.Fields) error {
+	for _, dep := range deps {
+		locked, ok := lock.Get(dep)
+		if !ok {
+			continue
+		}
+		resolved := lock.Resolve(dep)
+		depFields := fields.WithField("dependency", resolved.String())
+		if _, err := Home.Rkt.CatManifest(locked.Id); err == nil {
+			continue
+		}
+		id, err := Home.Rkt.Fetch(resolved.String())
+		if err != nil {
+			return errs.WithEF(err, depFields, "Failed to fetch locked dependency")
+		}
+		if id != locked.Id {
+			return errs.WithF(depFields.WithField("locked", locked.Id).WithField("fetched", id),
+				"Image of locked dependency changed, run dgr lock --update")
+		}
+	}
+	return nil
+}
+
+func lockFileOf(manifestFile string) string {
+	return strings.TrimSuffix(manifestFile, filepath.Ext(manifestFile)) + ".lock"
+}
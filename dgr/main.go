@@ -25,16 +25,30 @@ var Args = BuildArgs{}
 var workPath string
 
 type BuildArgs struct {
-	NoStore       bool
-	StoreOnly     bool
-	Force         bool
-	Test          bool
-	NoTestFail    bool
-	KeepBuilder   bool
-	CatchOnError  bool
-	CatchOnStep   bool
-	ParallelBuild bool
-	SetEnv        envMap
+	NoStore         bool
+	StoreOnly       bool
+	Offline         bool
+	Frozen          bool
+	Force           bool
+	TargetsRootPath string
+	Test            bool
+	NoTestFail      bool
+	KeepBuilder     bool
+	Resume          bool
+	Checkpoint      bool
+	ShellStage      string
+	ShellRunlevel   string
+	RunAttributes   []string
+	RunEnv          envMap
+	RunVolumes      []string
+	RunPorts        []string
+	RunExec         string
+	CatchOnError    bool
+	CatchOnStep     bool
+	Jobs            int
+	FailFast        bool
+	SetEnv          envMap
+	BuilderNetwork  string
 }
 
 func main() {
@@ -54,8 +68,8 @@ func main() {
 
 func Execute() {
 	var version bool
+	var parallel bool
 	var homePath string
-	var targetRootPath string
 	var logLevel string
 
 	var rootCmd = &cobra.Command{
@@ -76,15 +90,19 @@ func Execute() {
 			}
 			logs.SetLevel(level)
 
-			Home = NewHome(homePath)
+			if parallel {
+				Args.Jobs = 0
+			}
 
-			if targetRootPath != "" {
-				Home.Config.TargetWorkDir = targetRootPath
+			if cmd == configValidateCmd {
+				Home = HomeStruct{path: homePath} // validation reports errors that would fail loading
+				return
 			}
+			Home = NewHome(homePath)
 		},
 	}
 	//rootCmd.PersistentFlags().BoolVarP(&Args.Clean, "clean", "c", false, "Clean before doing anything")
-	rootCmd.PersistentFlags().StringVarP(&targetRootPath, "targets-root-path", "p", "", "Set targets root path")
+	rootCmd.PersistentFlags().StringVarP(&Args.TargetsRootPath, "targets-root-path", "p", "", "Set targets root path")
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "loglevel", "L", "info", "Set log level")
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Set log level")
 	rootCmd.PersistentFlags().StringVarP(&homePath, "home-path", "H", DefaultHomeFolder(""), "Set home folder")
@@ -93,9 +111,15 @@ func Execute() {
 	rootCmd.PersistentFlags().Var(&Args.SetEnv, "set-env", "Env passed to builder scripts")
 	rootCmd.PersistentFlags().BoolVar(&Args.StoreOnly, "store-only", false, "Tell rkt to use the store only")
 	rootCmd.PersistentFlags().BoolVar(&Args.NoStore, "no-store", false, "Tell rkt to not use store")
-	rootCmd.PersistentFlags().BoolVarP(&Args.ParallelBuild, "parallel", "P", false, "Run build in parallel for pod")
-
-	rootCmd.AddCommand(buildCmd, cleanCmd, pushCmd, installCmd, testCmd, versionCmd, initCmd, graphCmd, tryCmd, signCmd, aciVersion, configCmd)
+	rootCmd.PersistentFlags().BoolVar(&Args.Offline, "offline", false, "Use only the discovery cache and the rkt store")
+	rootCmd.PersistentFlags().BoolVar(&Args.Frozen, "frozen", false, "Fail when the lock file is missing or stale")
+	rootCmd.PersistentFlags().IntVarP(&Args.Jobs, "jobs", "j", 1, "Number of pod's acis processed in parallel (0 for all at once)")
+	rootCmd.PersistentFlags().BoolVar(&Args.FailFast, "fail-fast", false, "Cancel running pod's acis builds on first failure")
+	rootCmd.PersistentFlags().BoolVarP(&parallel, "parallel", "P", false, "Run build in parallel for pod")
+	rootCmd.PersistentFlags().MarkDeprecated("parallel", "use --jobs=0 instead")
+	rootCmd.PersistentFlags().StringVar(&Args.BuilderNetwork, "builder-net", "", "Network of the builder: host, none or rkt network names (override manifest)")
+
+	rootCmd.AddCommand(buildCmd, cleanCmd, pushCmd, installCmd, testCmd, versionCmd, initCmd, graphCmd, tryCmd, signCmd, shellCmd, runCmd, podCmd, verifyCmd, keysCmd, serveCmd, aciVersion, configCmd, outdatedCmd, updateCmd, lockCmd)
 
 	readEnvironment()
 	rootCmd.Execute()
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const updateMinor = "minor"
+const updateMajor = "major"
+
+// dependencyVersion is a dependency of a manifest with its latest version
+type dependencyVersion struct {
+	Manifest string `json:"manifest"`
+	Section  string `json:"section"`
+	Name     string `json:"name"`
+	Current  string `json:"current"`
+	Latest   string `json:"latest,omitempty"`
+	Update   string `json:"update,omitempty"` // minor or major when outdated
+	Error    string `json:"error,omitempty"`
+	dep      common.ACFullname
+}
+
+func outdated(jsonOutput bool) error {
+	deps, err := projectDependencies(workPath)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput {
+		content, err := json.MarshalIndent(deps, "", "  ")
+		if err != nil {
+			return errs.WithE(err, "Failed to marshal dependencies")
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "MANIFEST\tSECTION\tDEPENDENCY\tCURRENT\tLATEST\tUPDATE")
+	for _, dep := range deps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", dep.Manifest, dep.Section, dep.Name,
+			orDash(dep.Current), orDash(dep.Latest), orDash(dep.Update))
+	}
+	return w.Flush()
+}
+
+// update rewrites the versions of outdated dependencies in the manifests, only the text of name:version being changed.
+// Major updates, changing the first number of the version, are done only when asked.
+func update(name string, major bool) error {
+	deps, err := projectDependencies(workPath)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	updates := make(map[string][]dependencyVersion)
+	manifests := []string{}
+	for _, dep := range deps {
+		if name != "" && dep.Name != name {
+			continue
+		}
+		found = true
+		fields := data.WithField("manifest", dep.Manifest).WithField("dependency", dep.dep.String())
+		if dep.Error != "" {
+			logs.WithF(fields.WithField("error", dep.Error)).Warn("Latest version not found, not updated")
+			continue
+		}
+		if dep.Update == "" {
+			continue
+		}
+		if dep.Update == updateMajor && !major {
+			logs.WithF(fields.WithField("latest", dep.Latest)).Warn("Major version available, use --major to update")
+			continue
+		}
+		if _, ok := updates[dep.Manifest]; !ok {
+			manifests = append(manifests, dep.Manifest)
+		}
+		updates[dep.Manifest] = append(updates[dep.Manifest], dep)
+	}
+	if name != "" && !found {
+		return errs.WithF(data.WithField("dependency", name), "Dependency not found in manifests")
+	}
+
+	for _, manifest := range manifests {
+		if err := updateManifest(manifest, updates[manifest]); err != nil {
+			return err
+		}
+	}
+	if len(manifests) == 0 {
+		logs.Info("Dependencies are up to date")
+	}
+	return nil
+}
+
+func updateManifest(manifest string, deps []dependencyVersion) error {
+	file := filepath.Join(workPath, manifest)
+	fields := data.WithField("manifest", manifest)
+	info, err := os.Stat(file)
+	if err != nil {
+		return errs.WithEF(err, fields, "Cannot read manifest")
+	}
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errs.WithEF(err, fields, "Cannot read manifest")
+	}
+
+	content := string(source)
+	done := make(map[common.ACFullname]bool)
+	for _, dep := range deps {
+		if done[dep.dep] { // same dependency in several sections
+			continue
+		}
+		done[dep.dep] = true
+		var count int
+		content, count = common.ReplaceDependencyVersion(content, dep.dep, dep.Latest)
+		depFields := fields.WithField("dependency", dep.dep.String()).WithField("version", dep.Latest)
+		if count == 0 {
+			logs.WithF(depFields).Warn("Dependency not found in manifest text, not updated")
+			continue
+		}
+		logs.WithF(depFields).Info("Dependency updated")
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), info.Mode()); err != nil {
+		return errs.WithEF(err, fields, "Failed to write manifest")
+	}
+	return nil
+}
+
+// projectDependencies lists the dependencies of the aci or pod of the path, or of all the acis and pods under it for
+// a workspace, with their latest version
+func projectDependencies(path string) ([]dependencyVersion, error) {
+	manifests, err := findManifests(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifests) == 0 {
+		return nil, errs.WithF(data.WithField("path", path), "No aci or pod manifest found")
+	}
+
+	latests := make(map[string]dependencyVersion)
+	deps := []dependencyVersion{}
+	for _, manifest := range manifests {
+		manifestDeps, err := manifestDependencies(path, manifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range manifestDeps {
+			latest, ok := latests[dep.dep.Name()]
+			if !ok {
+				latest = resolveLatest(dep.dep)
+				latests[dep.dep.Name()] = latest
+			}
+			dep.Latest = latest.Latest
+			dep.Error = latest.Error
+			dep.Update = updateKind(dep.Current, dep.Latest)
+			deps = append(deps, dep)
+		}
+	}
+	return deps, nil
+}
+
+func resolveLatest(dep common.ACFullname) dependencyVersion {
+	version, err := latestVersion(dep)
+	if err != nil {
+		logs.WithEF(err, data.WithField("dependency", dep.String())).Debug("Latest version not found")
+		return dependencyVersion{Error: err.Error()}
+	}
+	return dependencyVersion{Latest: version}
+}
+
+// updateKind tells if the current version is outdated. Dependencies without version always use the latest one.
+func updateKind(current string, latest string) string {
+	if current == "" || latest == "" || !common.Version(current).LessThan(common.Version(latest)) {
+		return ""
+	}
+	if common.Version(current).Major() != common.Version(latest).Major() {
+		return updateMajor
+	}
+	return updateMinor
+}
+
+// findManifests returns the manifest of the path, or the ones found in sub directories, relative to the path
+func findManifests(path string) ([]string, error) {
+	for _, file := range []string{common.PathAciManifest, pathPodManifestYml} {
+		if fileExists(path + file) {
+			return []string{strings.TrimPrefix(file, "/")}, nil
+		}
+	}
+
+	manifests := []string{}
+	err := filepath.Walk(path, func(current string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || current == path {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") || "/"+info.Name() == pathTarget {
+			return filepath.SkipDir
+		}
+		for _, file := range []string{common.PathAciManifest, pathPodManifestYml} {
+			if fileExists(current + file) {
+				rel, err := filepath.Rel(path, current+file)
+				if err != nil {
+					return err
+				}
+				manifests = append(manifests, rel)
+				return filepath.SkipDir // a pod's apps are part of it
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("path", path), "Failed to find manifests")
+	}
+	return manifests, nil
+}
+
+func manifestDependencies(path string, manifest string) ([]dependencyVersion, error) {
+	file := filepath.Join(path, manifest)
+	deps := []dependencyVersion{}
+	add := func(section string, list []common.ACFullname) {
+		for _, dep := range list {
+			deps = append(deps, dependencyVersion{
+				Manifest: manifest,
+				Section:  section,
+				Name:     dep.Name(),
+				Current:  dep.Version(),
+				dep:      dep,
+			})
+		}
+	}
+
+	aci, pod, err := readProjectManifest(file)
+	if err != nil {
+		return nil, err
+	}
+	if pod != nil {
+		if pod.Pod != nil {
+			for _, app := range pod.Pod.Apps {
+				add("pod.apps."+app.Name, app.Dependencies)
+			}
+		}
+		return deps, nil
+	}
+	add("aci.dependencies", aci.Aci.Dependencies)
+	add("builder.dependencies", aci.Builder.Dependencies)
+	add("tester.builder.dependencies", aci.Tester.Builder.Dependencies)
+	add("tester.aci.dependencies", aci.Tester.Aci.Dependencies)
+	return deps, nil
+}
+
+// readProjectManifest reads an aci manifest, with its template processed without attributes, or a pod manifest
+func readProjectManifest(file string) (*common.AciManifest, *common.PodManifest, error) {
+	if "/"+filepath.Base(file) == pathPodManifestYml {
+		pod, err := readPodManifest(file)
+		if err != nil {
+			return nil, nil, errs.WithEF(err, data.WithField("path", file), "Failed to read pod manifest")
+		}
+		return nil, pod, nil
+	}
+
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, errs.WithEF(err, data.WithField("path", file), "Cannot read manifest")
+	}
+	aci, err := common.ProcessManifestTemplate(string(source), nil, false)
+	if err != nil {
+		return nil, nil, errs.WithEF(err, data.WithField("path", file), "Failed to process manifest")
+	}
+	return aci, nil, nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
@@ -25,6 +29,13 @@ func (p *Pod) Build() error {
 	os.MkdirAll(p.target, 0777)
 
 	p.preparePodVersion()
+	if err := p.useLock(); err != nil {
+		return err
+	}
+	if err := p.runHooks(HookPreBuild); err != nil {
+		return err
+	}
+
 	apps, err := p.processAcis()
 	if err != nil {
 		return err
@@ -33,7 +44,7 @@ func (p *Pod) Build() error {
 	if err := p.writePodManifest(apps); err != nil {
 		return err
 	}
-	return nil
+	return p.runHooks(HookPostBuild)
 }
 
 func (p *Pod) CleanAndBuild() error {
@@ -47,44 +58,108 @@ func (p *Pod) preparePodVersion() {
 	}
 }
 
+type aciStatus string
+
+const (
+	aciStatusSuccess   aciStatus = "success"
+	aciStatusFailed    aciStatus = "failed"
+	aciStatusCancelled aciStatus = "cancelled"
+	aciStatusSkipped   aciStatus = "skipped"
+)
+
+type aciResult struct {
+	name     string
+	status   aciStatus
+	duration time.Duration
+	err      error
+}
+
+func (p *Pod) jobs() int {
+	if p.args.Jobs <= 0 || p.args.Jobs > len(p.manifest.Pod.Apps) {
+		return len(p.manifest.Pod.Apps)
+	}
+	return p.args.Jobs
+}
+
+// processAcis builds the pod's acis with at most p.jobs() of them at the same time.
+// With fail-fast, the first failure cancels running builds and skips the ones not started yet.
 func (p *Pod) processAcis() ([]schema.RuntimeApp, error) {
 	apps := make([]schema.RuntimeApp, len(p.manifest.Pod.Apps))
-	errors := make([]error, len(p.manifest.Pod.Apps))
+	results := make([]aciResult, len(p.manifest.Pod.Apps))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	indexes := make(chan int)
 	var wg sync.WaitGroup
-	for i, e := range p.manifest.Pod.Apps {
+	for w := 0; w < p.jobs(); w++ {
 		wg.Add(1)
-		f := func(i int, e common.RuntimeApp) {
+		go func() {
 			defer wg.Done()
-
-			app, err := p.processAci(e)
-			if app != nil {
-				apps[i] = *app
+			for i := range indexes {
+				e := p.manifest.Pod.Apps[i]
+				results[i] = aciResult{name: e.Name, status: aciStatusSkipped}
+				if ctx.Err() != nil {
+					continue
+				}
+
+				start := time.Now()
+				app, err := p.processAci(ctx, e)
+				results[i].duration = time.Since(start)
+				results[i].err = err
+				switch {
+				case err == nil:
+					apps[i] = *app
+					results[i].status = aciStatusSuccess
+				case ctx.Err() != nil:
+					results[i].status = aciStatusCancelled
+				default:
+					results[i].status = aciStatusFailed
+					if p.args.FailFast {
+						logs.WithEF(err, p.fields.WithField("aci", e.Name)).Error("Aci failed, cancelling others")
+						cancel()
+					}
+				}
 			}
-			errors[i] = err
-		}
-
-		if !p.args.ParallelBuild {
-			f(i, e)
-		} else {
-			go f(i, e)
-		}
+		}()
+	}
+	for i := range p.manifest.Pod.Apps {
+		indexes <- i
 	}
+	close(indexes)
 	wg.Wait()
 
-	failed := 0
-	for _, err := range errors {
-		if err != nil {
-			failed++
+	p.printSummary(results)
+
+	buildErrors := []error{}
+	for _, res := range results {
+		if res.status == aciStatusFailed {
+			buildErrors = append(buildErrors, res.err)
 		}
 	}
-	if failed > 0 {
-		return apps, errs.With("Acis process failed").WithErrs(errors...)
+	if len(buildErrors) > 0 {
+		return apps, errs.With("Acis process failed").WithErrs(buildErrors...)
 	}
 	return apps, nil
 }
 
-func (p *Pod) processAci(e common.RuntimeApp) (*schema.RuntimeApp, error) {
-	aci, err := p.buildAci(e)
+func (p *Pod) printSummary(results []aciResult) {
+	if len(results) < 2 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ACI\tSTATUS\tDURATION")
+	for _, res := range results {
+		duration := "-"
+		if res.status != aciStatusSkipped {
+			duration = res.duration.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", res.name, res.status, duration)
+	}
+	w.Flush()
+}
+
+func (p *Pod) processAci(ctx context.Context, e common.RuntimeApp) (*schema.RuntimeApp, error) {
+	aci, err := p.buildAci(ctx, e)
 	if err != nil {
 		return nil, err
 	}
@@ -184,7 +259,7 @@ func (p *Pod) fillRuntimeAppFromDependencies(e *common.RuntimeApp) error {
 	return nil
 }
 
-func (p *Pod) buildAci(e common.RuntimeApp) (*Aci, error) {
+func (p *Pod) buildAci(ctx context.Context, e common.RuntimeApp) (*Aci, error) {
 	if err := p.fillRuntimeAppFromDependencies(&e); err != nil {
 		return nil, err
 	}
@@ -193,6 +268,7 @@ func (p *Pod) buildAci(e common.RuntimeApp) (*Aci, error) {
 	if err != nil {
 		return nil, err
 	}
+	aci.ctx = ctx
 
 	aci.Clean()
 
@@ -222,8 +298,9 @@ func (p *Pod) writePodManifest(apps []schema.RuntimeApp) error {
 		Apps:        apps,
 		Volumes:     m.Volumes,
 		Isolators:   m.Isolators,
-		Annotations: m.Annotations,
+		Annotations: append(types.Annotations{}, m.Annotations...),
 		Ports:       m.Ports}
+	common.SetPodArtifactName(&manifest, p.manifest.Name)
 	return WritePodManifest(&manifest, p.target+pathPodManifestJson)
 }
 
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	appcdiscovery "github.com/appc/spec/discovery"
+	"github.com/appc/spec/schema"
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/blablacar/dgr/dgr/discovery"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+// fetchPod downloads a pod manifest pushed by dgr and fetches in rkt the images of its apps,
+// checking that they are the ones it was built with
+func fetchPod(ref string, output string) error {
+	name := common.NewACFullName(ref)
+	fields := data.WithField("pod", name.String())
+	insecure := Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption()
+
+	app, err := discovery.NewApp(name.Name(), common.PodArtifactLabels())
+	if err != nil {
+		return errs.WithEF(err, fields, "Invalid pod name")
+	}
+	if name.Version() != "" {
+		app.Labels["version"] = name.Version()
+	}
+
+	logs.WithF(fields).Info("Discovering pod")
+	endpoints, attempts, err := discoverEndpoints(*app, false)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to discover pod")
+	}
+	if len(endpoints.ACIEndpoints) == 0 {
+		for _, a := range attempts {
+			logs.WithEF(a.Error, fields.WithField("prefix", a.Prefix)).Debug("Discovery attempt failed")
+		}
+		return errs.WithF(fields, "No endpoint discovered for pod")
+	}
+	endpoint := endpoints.ACIEndpoints[0]
+
+	content, err := httpGet(endpoint.ACI, insecure)
+	if err != nil {
+		return errs.WithEF(err, fields.WithField("url", endpoint.ACI), "Failed to download pod manifest")
+	}
+	manifest := schema.BlankPodManifest()
+	if err := manifest.UnmarshalJSON(content); err != nil {
+		return errs.WithEF(err, fields.WithField("url", endpoint.ACI), "Invalid pod manifest")
+	}
+	fetched, err := common.PodArtifactName(manifest)
+	if err != nil {
+		return errs.WithEF(err, fields, "Downloaded file is not a pod manifest pushed by dgr")
+	}
+	if fetched.Name() != name.Name() || (name.Version() != "" && name.Version() != "latest" && fetched.Version() != name.Version()) {
+		return errs.WithF(fields.WithField("fetched", fetched), "Downloaded pod manifest is not the requested pod")
+	}
+	fields = data.WithField("pod", fetched.String())
+
+	if err := verifyPodManifest(*fetched, content, endpoint.ASC, insecure); err != nil {
+		return errs.WithEF(err, fields, "Pod manifest verification failed")
+	}
+
+	for _, app := range manifest.Apps {
+		if err := fetchPodApp(app); err != nil {
+			return errs.WithEF(err, fields, "Failed to fetch pod's app")
+		}
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("%s-%s.pod-manifest.json", fetched.TinyName(), fetched.Version())
+	}
+	if err := ioutil.WriteFile(output, content, 0644); err != nil {
+		return errs.WithEF(err, fields.WithField("file", output), "Failed to write pod manifest")
+	}
+	logs.WithF(fields.WithField("file", output)).Info("Pod fetched")
+	return nil
+}
+
+// verifyPodManifest checks the signature of the pod manifest against the keys trusted by rkt for the pod name.
+// A pod manifest without signature is refused, unless the insecure image option is set.
+func verifyPodManifest(name common.ACFullname, content []byte, ascUrl string, insecure appcdiscovery.InsecureOption) error {
+	fields := data.WithField("pod", name.String())
+	if Home.Config.Rkt.InsecureOptions.HasImage() {
+		logs.WithF(fields).Warn("Insecure image option is set, pod manifest signature is not verified")
+		return nil
+	}
+
+	signature, err := httpGet(ascUrl, insecure)
+	if err != nil {
+		return errs.WithEF(err, fields.WithField("url", ascUrl), "Failed to download pod manifest signature")
+	}
+
+	systemConf, localConf := rktConfigDirs()
+	keyring, err := common.TrustedKeyring([]string{systemConf, localConf}, name.Name())
+	if err != nil {
+		return err
+	}
+	signer, err := common.CheckSignature(keyring, bytes.NewReader(content), bytes.NewReader(signature))
+	if err != nil {
+		return err
+	}
+	for id := range signer.Identities {
+		logs.WithF(fields.WithField("key", id)).Info("Pod manifest signature verified")
+		break
+	}
+	return nil
+}
+
+func fetchPodApp(app schema.RuntimeApp) error {
+	image := app.Image.Name.String()
+	if version, ok := app.Image.Labels.Get("version"); ok {
+		image += ":" + version
+	}
+	fields := data.WithField("app", app.Name).WithField("image", image)
+
+	logs.WithF(fields).Info("Fetching app image")
+	hash, err := Home.Rkt.Fetch(image)
+	if err != nil {
+		return err
+	}
+	if hash != app.Image.ID.String() {
+		return errs.WithF(fields.WithField("expected", app.Image.ID.String()).WithField("fetched", hash),
+			"Fetched image is not the one the pod was built with")
+	}
+	return nil
+}
+
+// httpGet downloads with the credentials of dgr configuration for the host of the url
+func httpGet(url string, insecure appcdiscovery.InsecureOption) ([]byte, error) {
+	if err := checkOnline(data.WithField("url", url), "download"); err != nil {
+		return nil, err
+	}
+	client := appcdiscovery.Client
+	if insecure&appcdiscovery.InsecureTLS != 0 {
+		client = appcdiscovery.ClientInsecureTLS
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Home.Config.Auths.SetHeader(req); err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errs.WithF(data.WithField("url", url).WithField("status", res.StatusCode), "Bad HTTP status code")
+	}
+	return ioutil.ReadAll(res.Body)
+}
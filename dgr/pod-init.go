@@ -1,7 +1,59 @@
 package main
 
-import "github.com/n0rad/go-erlog/errs"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const initPodAttributesContent = `default:
+  pod:
+    greeting: Hello from the pod
+`
+
+const initPodTemplateContent = `{{ .pod.greeting }}
+`
+
+const initPodTestContent = `#!/dgr/bin/bats
+
+@test "Prestart should template with pod attributes" {
+  result="$(cat /etc/pod)"
+  [ "$result" == "Hello from the pod" ]
+}
+`
 
 func (p *Pod) Init() error {
-	return errs.With("Pod init is not implemented yet")
+	logs.WithF(p.fields).Info("Init")
+	defer giveBackUserRights(p.path)
+
+	files := map[string]string{
+		"/attributes/attributes.yml": initPodAttributesContent,
+	}
+	for _, e := range p.manifest.Pod.Apps {
+		if err := os.MkdirAll(p.path+"/"+e.Name, 0755); err != nil {
+			return errs.WithEF(err, p.fields.WithField("aci", e.Name), "Failed to create pod's aci directory")
+		}
+		aci, err := p.toPodAci(e)
+		if err != nil {
+			return err
+		}
+		if err := aci.Init(); err != nil {
+			return errs.WithEF(err, p.fields.WithField("aci", e.Name), "Init of pod's aci failed")
+		}
+		files["/"+e.Name+"/templates/etc/pod.tmpl"] = initPodTemplateContent
+		files["/"+e.Name+"/tests/pod.bats"] = initPodTestContent
+	}
+
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(p.path+path), 0755); err != nil {
+			return errs.WithEF(err, p.fields.WithField("path", path), "Failed to create directory")
+		}
+		if err := ioutil.WriteFile(p.path+path, []byte(content), 0644); err != nil {
+			return errs.WithEF(err, p.fields.WithField("path", path), "Failed to write file")
+		}
+	}
+	return nil
 }
@@ -11,6 +11,10 @@ func (p *Pod) Install() ([]string, error) {
 		return hashs, err
 	}
 
+	if err := p.runHooks(HookPreInstall); err != nil {
+		return hashs, err
+	}
+
 	for _, e := range p.manifest.Pod.Apps {
 		aci, err := p.toPodAci(e)
 		if err != nil {
@@ -23,5 +27,5 @@ func (p *Pod) Install() ([]string, error) {
 		}
 		hashs = append(hashs, hash...)
 	}
-	return hashs, nil
+	return hashs, p.runHooks(HookPostInstall)
 }
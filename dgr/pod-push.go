@@ -2,7 +2,6 @@ package main
 
 import (
 	"github.com/blablacar/dgr/dgr/common"
-	"github.com/n0rad/go-erlog/errs"
 	"github.com/n0rad/go-erlog/logs"
 )
 
@@ -13,6 +12,10 @@ func (p *Pod) Push() error {
 		return err
 	}
 
+	if err := p.runHooks(HookPrePush); err != nil {
+		return err
+	}
+
 	for _, e := range p.manifest.Pod.Apps {
 		aci, err := p.toPodAci(e)
 		if err != nil {
@@ -24,23 +27,22 @@ func (p *Pod) Push() error {
 		}
 	}
 
-	if Home.Config.Push.Type == "maven" && p.manifest.Name.DomainName() == "aci.blbl.cr" {
-		// TODO this definitely need to be removed
-		if err := common.ExecCmd("curl", "-i",
-			"-F", "r=releases",
-			"-F", "hasPom=false",
-			"-F", "e=pod",
-			"-F", "g=com.blablacar.aci.linux.amd64",
-			"-F", "p=pod",
-			"-F", "v="+p.manifest.Name.Version(),
-			"-F", "a="+p.manifest.Name.ShortName(),
-			"-F", "file=@"+p.target+"/pod-manifest.json",
-			"-u", Home.Config.Push.Username+":"+Home.Config.Push.Password,
-			Home.Config.Push.Url+"/service/local/artifact/maven/content"); err != nil {
-
-			return errs.WithEF(err, p.fields, "Failed to push pod")
-		}
+	if err := p.upload(); err != nil {
+		return err
 	}
 
-	return nil
+	return p.runHooks(HookPostPush)
+}
+
+// upload signs and pushes the pod manifest, once all the acis it references are pushed
+func (p *Pod) upload() error {
+	if err := p.signManifest(); err != nil {
+		return err
+	}
+	if err := p.verifyManifestSignature(); err != nil {
+		return err
+	}
+	artifact := common.NewPushArtifact(p.manifest.Name, p.target+pathPodManifestJson,
+		common.PodArtifactExt, common.PodArtifactOs, common.PodArtifactArch)
+	return pushArtifact(artifact, p.fields)
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const pathRunPodManifestJson = "/run-pod-manifest.json"
+
+func (p *Pod) Run() error {
+	if p.args.RunExec != "" {
+		return errs.WithF(p.fields, "Exec can only be overridden for an aci")
+	}
+	overrides, err := prepareRunOverrides(p.args)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(p.target + pathPodManifestJson); os.IsNotExist(err) {
+		if err := p.Build(); err != nil {
+			return err
+		}
+	}
+	if err := p.verifyManifestSignature(); err != nil {
+		return err
+	}
+	for _, e := range p.manifest.Pod.Apps {
+		aci, err := p.toPodAci(e)
+		if err != nil {
+			return err
+		}
+		if _, err := Home.Rkt.Fetch(aci.target + pathImageAci); err != nil {
+			return errs.WithEF(err, p.fields.WithField("app", e.Name), "Failed to import aci in rkt")
+		}
+	}
+
+	manifest, err := p.runPodManifest(overrides)
+	if err != nil {
+		return err
+	}
+	if err := WritePodManifest(manifest, p.target+pathRunPodManifestJson); err != nil {
+		return err
+	}
+
+	logs.WithF(p.fields).Info("Running")
+	if err := runInteractive([]string{"--pod-manifest=" + p.target + pathRunPodManifestJson}, p.target+pathRunUuid); err != nil {
+		return errs.WithEF(err, p.fields, "Run of pod failed")
+	}
+	return nil
+}
+
+// runPodManifest is the built pod manifest with the overrides applied to all apps
+func (p *Pod) runPodManifest(overrides *runOverrides) (*schema.PodManifest, error) {
+	content, err := ioutil.ReadFile(p.target + pathPodManifestJson)
+	if err != nil {
+		return nil, errs.WithEF(err, p.fields.WithField("file", p.target+pathPodManifestJson), "Failed to read pod manifest")
+	}
+	manifest := &schema.PodManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, errs.WithEF(err, data.WithField("content", string(content)), "Failed to unmarshal pod manifest")
+	}
+
+	for i := range manifest.Apps {
+		for _, env := range overrides.env {
+			manifest.Apps[i].App.Environment.Set(env.Name, env.Value)
+		}
+	}
+
+	for _, volume := range overrides.volumes {
+		found := false
+		for i := range manifest.Volumes {
+			if manifest.Volumes[i].Name.Equals(volume.name) {
+				manifest.Volumes[i].Kind = "host"
+				manifest.Volumes[i].Source = volume.path
+				found = true
+			}
+		}
+		if !found {
+			manifest.Volumes = append(manifest.Volumes, types.Volume{Name: volume.name, Kind: "host", Source: volume.path})
+		}
+	}
+
+	for _, port := range overrides.ports {
+		manifest.Ports = append(manifest.Ports, types.ExposedPort{Name: port.name, HostPort: port.hostPort})
+	}
+	return manifest, nil
+}
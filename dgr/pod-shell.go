@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/n0rad/go-erlog/errs"
+)
+
+func (p *Pod) Shell(app string) error {
+	if app == "" {
+		return errs.WithF(p.fields, "App name is required to open a shell in a pod")
+	}
+	for _, e := range p.manifest.Pod.Apps {
+		if e.Name != app {
+			continue
+		}
+		if err := p.fillRuntimeAppFromDependencies(&e); err != nil {
+			return err
+		}
+		aci, err := p.toPodAci(e)
+		if err != nil {
+			return err
+		}
+		return aci.Shell("")
+	}
+	return errs.WithF(p.fields.WithField("app", app), "App not found in pod")
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/n0rad/go-erlog/errs"
 	"github.com/n0rad/go-erlog/logs"
 )
@@ -18,5 +20,58 @@ func (p *Pod) Sign() error {
 			return errs.WithEF(err, aci.fields, "sign of pod's aci failed")
 		}
 	}
+
+	if _, err := os.Stat(p.target + pathPodManifestJson); os.IsNotExist(err) {
+		if err := p.Build(); err != nil {
+			return err
+		}
+	}
+	return p.signManifest()
+}
+
+// signManifest signs pod-manifest.json with the keyring of the pod's domain, as it defines what is run
+func (p *Pod) signManifest() error {
+	sign, err := Home.Config.GetSignKeyring(p.manifest.Name.DomainName())
+	if err != nil {
+		return errs.WithEF(err, p.fields, "Failed to sign pod manifest. Cannot found keyring")
+	}
+	enabled, err := signEnabled(sign)
+	if err != nil {
+		return errs.WithEF(err, p.fields, "Failed to sign pod manifest")
+	}
+	if !enabled {
+		logs.WithF(p.fields).WithField("domain", p.manifest.Name.DomainName()).Warn("Sign disabled for this pod's domain")
+		return nil
+	}
+
+	if err := signFile(sign, p.target+pathPodManifestJson); err != nil {
+		return errs.WithEF(err, p.fields, "Failed to sign pod manifest")
+	}
+	return nil
+}
+
+// verifyManifestSignature checks the signature of pod-manifest.json with the keyring of the pod's domain,
+// failing when the manifest is not signed unless signing is disabled for the domain
+func (p *Pod) verifyManifestSignature() error {
+	sign, err := Home.Config.GetSignKeyring(p.manifest.Name.DomainName())
+	if err != nil {
+		return errs.WithEF(err, p.fields, "Failed to verify pod manifest. Cannot found keyring")
+	}
+	enabled, err := signEnabled(sign)
+	if err != nil {
+		return errs.WithEF(err, p.fields, "Failed to verify pod manifest")
+	}
+	if !enabled {
+		logs.WithF(p.fields).Debug("Sign disabled for this pod's domain, signature is not verified")
+		return nil
+	}
+
+	if _, err := os.Stat(p.target + pathPodManifestJson + suffixAsc); os.IsNotExist(err) {
+		return errs.WithF(p.fields.WithField("file", p.target+pathPodManifestJson+suffixAsc),
+			"Pod manifest is not signed, sign it with dgr sign")
+	}
+	if err := verifyFile(sign, p.target+pathPodManifestJson); err != nil {
+		return errs.WithEF(err, p.fields, "Pod manifest signature verification failed")
+	}
 	return nil
 }
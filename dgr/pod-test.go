@@ -5,6 +5,10 @@ import "github.com/n0rad/go-erlog/logs"
 func (p *Pod) Test() error {
 	logs.WithF(p.fields).Info("Testing")
 
+	if err := p.runHooks(HookPreTest); err != nil {
+		return err
+	}
+
 	for _, e := range p.manifest.Pod.Apps {
 		aci, err := p.toPodAci(e)
 		if err != nil {
@@ -15,5 +19,5 @@ func (p *Pod) Test() error {
 			return err
 		}
 	}
-	return nil
+	return p.runHooks(HookPostTest)
 }
@@ -22,11 +22,13 @@ type Pod struct {
 	args     BuildArgs
 	target   string
 	manifest common.PodManifest
+	lock     *common.LockFile
 }
 
 func NewPod(path string, args BuildArgs, checkWg *sync.WaitGroup) (*Pod, error) {
-	if (args.CatchOnError || args.CatchOnStep) && args.ParallelBuild {
-		args.ParallelBuild = false
+	if (args.CatchOnError || args.CatchOnStep) && args.Jobs != 1 {
+		logs.Warn("Catch is interactive, processing pod's acis one at a time")
+		args.Jobs = 1
 	}
 
 	fullPath, err := filepath.Abs(path)
@@ -94,6 +96,10 @@ func (p *Pod) findAciDirectory(e common.RuntimeApp) (string, error) {
 }
 
 func (p *Pod) toPodAci(e common.RuntimeApp) (*Aci, error) {
+	if err := p.useLock(); err != nil {
+		return nil, err
+	}
+	e.Dependencies = p.lock.ResolveAll(e.Dependencies)
 	tmpl, err := p.toAciManifestTemplate(e)
 	if err != nil {
 		return nil, err
@@ -108,9 +114,29 @@ func (p *Pod) toPodAci(e common.RuntimeApp) (*Aci, error) {
 		return nil, errs.WithEF(err, p.fields.WithField("aci-dir", dir), "Failed to prepare aci")
 	}
 	aci.podName = &p.manifest.Name
+	aci.lock = p.lock
 	return aci, err
 }
 
+// useLock pins the dependencies of the apps to the lock file of the pod, once, before the acis are processed
+func (p *Pod) useLock() error {
+	if p.lock != nil {
+		return nil
+	}
+	lock, err := readProjectLock(p.path+pathPodManifestLock, p.manifest.LockableDependencies(), p.args.Frozen, p.fields)
+	if err != nil {
+		return err
+	}
+	if err := verifyLock(*lock, p.manifest.LockableDependencies(), p.fields); err != nil {
+		return err
+	}
+	for i, app := range p.manifest.Pod.Apps {
+		p.manifest.Pod.Apps[i].Dependencies = lock.ResolveAll(app.Dependencies)
+	}
+	p.lock = lock
+	return nil
+}
+
 func (p *Pod) toAciManifestTemplate(e common.RuntimeApp) (string, error) {
 	fullname := common.NewACFullName(p.manifest.Name.Name() + "_" + e.Name + ":" + p.manifest.Name.Version())
 	manifest := &common.AciManifest{
@@ -129,6 +155,15 @@ func (p *Pod) toAciManifestTemplate(e common.RuntimeApp) (string, error) {
 	return string(content), nil
 }
 
+func (p *Pod) runHooks(hook Hook) error {
+	return runHooks(hook, HookEnv{
+		Path:     p.path,
+		Target:   p.target,
+		Fullname: p.manifest.Name,
+		Image:    p.target + pathPodManifestJson,
+	}, p.fields)
+}
+
 func (p *Pod) giveBackUserRightsToTarget() {
 	giveBackUserRights(p.target)
 }
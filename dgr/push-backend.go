@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const (
+	pushTypeAppc      = "appc"
+	pushTypeMaven     = "maven"
+	pushTypeHttp      = "http"
+	pushTypeDirectory = "directory"
+	pushTypeS3        = "s3"
+)
+
+// PushBackend uploads acis and pod manifests with their signatures to an image repository
+type PushBackend interface {
+	Push(artifact common.PushArtifact) error
+}
+
+func NewPushBackend(config PushConfig) (PushBackend, error) {
+	switch config.Type {
+	case pushTypeAppc, "":
+		return appcPushBackend{}, nil
+	case pushTypeMaven:
+		if config.Url == "" || config.GroupId == "" {
+			return nil, errs.WithF(data.WithField("type", config.Type), "Maven push requires url and groupId")
+		}
+		return mavenPushBackend{config: config}, nil
+	case pushTypeHttp:
+		if config.Url == "" {
+			return nil, errs.WithF(data.WithField("type", config.Type), "Http push requires url")
+		}
+		return httpPushBackend{config: config}, nil
+	case pushTypeDirectory:
+		if config.Path == "" {
+			return nil, errs.WithF(data.WithField("type", config.Type), "Directory push requires path")
+		}
+		return directoryPushBackend{config: config}, nil
+	case pushTypeS3:
+		if config.Bucket == "" {
+			return nil, errs.WithF(data.WithField("type", config.Type), "S3 push requires bucket")
+		}
+		return s3PushBackend{config: config}, nil
+	default:
+		return nil, errs.WithF(data.WithField("type", config.Type), "Unknown push type")
+	}
+}
+
+// pushArtifact uploads the artifact with the push backend configured for its domain
+func pushArtifact(artifact common.PushArtifact, fields data.Fields) error {
+	config := Home.Config.GetPushConfig(artifact.Name.DomainName())
+	fields = fields.WithField("push", config.Type).WithField("file", artifact.File)
+	if err := checkOnline(fields, "push"); err != nil {
+		return err
+	}
+
+	backend, err := NewPushBackend(config)
+	if err != nil {
+		return errs.WithEF(err, fields, "Invalid push configuration")
+	}
+	logs.WithF(fields).Info("Uploading")
+	if err := backend.Push(artifact); err != nil {
+		return errs.WithEF(err, fields, "Failed to upload")
+	}
+	return nil
+}
+
+// appcPushBackend uploads to the endpoint found with appc push discovery
+type appcPushBackend struct{}
+
+func (b appcPushBackend) Push(artifact common.PushArtifact) error {
+	headers, err := authHeaders(data.WithField("name", artifact.Name))
+	if err != nil {
+		return err
+	}
+	upload := Uploader{
+		Acipath:        artifact.File,
+		Ascpath:        artifact.Asc,
+		Uri:            artifact.Name.String(),
+		Pod:            artifact.Ext == common.PodArtifactExt,
+		SetHTTPHeaders: headers,
+		Config:         Home.Config.Upload,
+	}
+	return upload.Upload()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// directoryPushBackend copies artifacts in a directory served by a static http server, with a discovery
+// template matching its template. A 'latest' link points to the last pushed version.
+type directoryPushBackend struct {
+	config PushConfig
+}
+
+func (b directoryPushBackend) Push(artifact common.PushArtifact) error {
+	tmpl := b.config.Template
+	if tmpl == "" {
+		tmpl = common.PushArtifactTemplate
+	}
+
+	files := map[string]string{artifact.Ext: artifact.File}
+	if artifact.Asc != "" {
+		files[artifact.Ext+common.ExtAsc] = artifact.Asc
+	}
+
+	latest := artifact
+	latest.Name = *common.NewACFullName(artifact.Name.Name() + ":latest")
+	for ext, file := range files {
+		target := b.config.Path + "/" + artifact.Render(tmpl, ext)
+		fields := data.WithField("file", file).WithField("target", target)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return errs.WithEF(err, fields, "Failed to create directory")
+		}
+		if err := common.CopyFile(file, target); err != nil {
+			return errs.WithEF(err, fields, "Failed to copy file")
+		}
+
+		link := b.config.Path + "/" + latest.Render(tmpl, ext)
+		if link == target {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.Dir(link), target)
+		if err != nil {
+			return errs.WithEF(err, fields, "Failed to find latest link target")
+		}
+		os.Remove(link)
+		if err := os.Symlink(rel, link); err != nil {
+			return errs.WithEF(err, fields.WithField("link", link), "Failed to link latest version")
+		}
+	}
+	return nil
+}
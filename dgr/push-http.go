@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	appcdiscovery "github.com/appc/spec/discovery"
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// httpPushBackend PUTs artifacts to an url template, the default layout being appended when it has no placeholder
+type httpPushBackend struct {
+	config PushConfig
+}
+
+func (b httpPushBackend) Push(artifact common.PushArtifact) error {
+	tmpl := b.config.Url
+	if !strings.Contains(tmpl, "{") {
+		tmpl = strings.TrimSuffix(tmpl, "/") + "/" + common.PushArtifactTemplate
+	}
+
+	if err := b.put(artifact.Render(tmpl, artifact.Ext), artifact.File); err != nil {
+		return err
+	}
+	if artifact.Asc != "" {
+		return b.put(artifact.Render(tmpl, artifact.Ext+common.ExtAsc), artifact.Asc)
+	}
+	return nil
+}
+
+func (b httpPushBackend) put(url string, path string) error {
+	fields := data.WithField("url", url).WithField("file", path)
+	file, err := os.Open(path)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to open file")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to stat file")
+	}
+
+	body, err := genProgressBar(file, info.Name())
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to prepare upload")
+	}
+	req, err := http.NewRequest("PUT", url, body)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to prepare request")
+	}
+	req.ContentLength = info.Size()
+	if b.config.Username != "" {
+		req.SetBasicAuth(b.config.Username, b.config.Password)
+	} else {
+		headers, err := authHeaders(fields)
+		if err != nil {
+			return err
+		}
+		headers(req)
+	}
+
+	client := appcdiscovery.Client
+	if Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption()&appcdiscovery.InsecureTLS != 0 {
+		client = appcdiscovery.ClientInsecureTLS
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return errs.WithEF(err, fields, "Upload request failed")
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errs.WithF(fields.WithField("status", fmt.Sprintf("%d", res.StatusCode)), "Bad HTTP status code")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+const defaultMavenRepository = "releases"
+
+// mavenPushBackend uploads to a Nexus repository, artifacts are identified by their short name and version
+type mavenPushBackend struct {
+	config PushConfig
+}
+
+func (b mavenPushBackend) Push(artifact common.PushArtifact) error {
+	if err := b.upload(artifact, artifact.File, artifact.Ext); err != nil {
+		return err
+	}
+	if artifact.Asc != "" {
+		return b.upload(artifact, artifact.Asc, artifact.Ext+common.ExtAsc)
+	}
+	return nil
+}
+
+func (b mavenPushBackend) upload(artifact common.PushArtifact, file string, ext string) error {
+	repository := b.config.Repository
+	if repository == "" {
+		repository = defaultMavenRepository
+	}
+	if err := common.ExecCmd("curl", "-f", "-i", "-L",
+		"-F", "r="+repository,
+		"-F", "hasPom=false",
+		"-F", "e="+ext,
+		"-F", "g="+b.config.GroupId,
+		"-F", "p="+artifact.Ext,
+		"-F", "v="+artifact.Name.Version(),
+		"-F", "a="+artifact.Name.ShortName(),
+		"-F", "file=@"+file,
+		"-u", b.config.Username+":"+b.config.Password,
+		b.config.Url+"/service/local/artifact/maven/content"); err != nil {
+		return errs.WithEF(err, data.WithField("file", file).WithField("url", b.config.Url), "Failed to upload to maven repository")
+	}
+	return nil
+}
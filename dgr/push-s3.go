@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const s3DefaultRegion = "us-east-1"
+const s3Service = "s3"
+
+// s3PushBackend puts objects in a bucket of an S3 compatible storage, laid out to be served statically with
+// a discovery template matching the key template. Objects of the pushed version are also copied as 'latest'.
+type s3PushBackend struct {
+	config PushConfig
+}
+
+func (b s3PushBackend) Push(artifact common.PushArtifact) error {
+	files := []struct {
+		ext  string
+		path string
+	}{{artifact.Ext, artifact.File}}
+	if artifact.Asc != "" {
+		files = append(files, struct {
+			ext  string
+			path string
+		}{artifact.Ext + common.ExtAsc, artifact.Asc})
+	}
+
+	latest := artifact
+	latest.Name = *common.NewACFullName(artifact.Name.Name() + ":latest")
+	for _, f := range files {
+		key := b.key(artifact, f.ext)
+		if err := b.put(key, f.path); err != nil {
+			return err
+		}
+		if latestKey := b.key(latest, f.ext); latestKey != key {
+			if err := b.copy(key, latestKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b s3PushBackend) key(artifact common.PushArtifact, ext string) string {
+	tmpl := b.config.Template
+	if tmpl == "" {
+		tmpl = common.PushArtifactTemplate
+	}
+	prefix := strings.Trim(b.config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return prefix + artifact.Render(tmpl, ext)
+}
+
+func (b s3PushBackend) region() string {
+	if b.config.Region != "" {
+		return b.config.Region
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return s3DefaultRegion
+}
+
+// objectUrl uses path style, supported by aws and by S3 compatible servers without dns configuration
+func (b s3PushBackend) objectUrl(key string) string {
+	endpoint := b.config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + b.region() + ".amazonaws.com"
+		if b.region() == s3DefaultRegion {
+			endpoint = "https://s3.amazonaws.com"
+		}
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/" + b.config.Bucket + "/" + key
+}
+
+// credentials are the ones of the configuration, or from aws environment variables and shared credentials file
+func (b s3PushBackend) credentials() *credentials.Credentials {
+	if b.config.AccessKeyId != "" {
+		return credentials.NewStaticCredentials(b.config.AccessKeyId, b.config.SecretAccessKey, "")
+	}
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvProvider{},
+		&credentials.SharedCredentialsProvider{},
+	})
+}
+
+func (b s3PushBackend) put(key string, path string) error {
+	fields := data.WithField("bucket", b.config.Bucket).WithField("key", key).WithField("file", path)
+	file, err := os.Open(path)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to open file")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to stat file")
+	}
+
+	req, err := http.NewRequest("PUT", b.objectUrl(key), nil)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to prepare request")
+	}
+	req.ContentLength = info.Size()
+	if err := b.sign(req, file); err != nil {
+		return errs.WithEF(err, fields, "Failed to sign request")
+	}
+
+	// signing hashes the body, it is read again from the start for the upload
+	if _, err := file.Seek(0, 0); err != nil {
+		return errs.WithEF(err, fields, "Failed to seek to beginning of file")
+	}
+	body, err := genProgressBar(file, info.Name())
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to prepare upload")
+	}
+	req.Body = ioutil.NopCloser(body)
+
+	logs.WithF(fields).Debug("Putting object")
+	return b.do(req, fields)
+}
+
+// copy is done by the server, without uploading the object again
+func (b s3PushBackend) copy(srcKey string, key string) error {
+	fields := data.WithField("bucket", b.config.Bucket).WithField("key", key).WithField("source", srcKey)
+	req, err := http.NewRequest("PUT", b.objectUrl(key), nil)
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to prepare request")
+	}
+	source := url.URL{Path: "/" + b.config.Bucket + "/" + srcKey}
+	req.Header.Set("X-Amz-Copy-Source", source.EscapedPath())
+	if err := b.sign(req, nil); err != nil {
+		return errs.WithEF(err, fields, "Failed to sign request")
+	}
+
+	logs.WithF(fields).Debug("Copying object")
+	return b.do(req, fields)
+}
+
+func (b s3PushBackend) sign(req *http.Request, body io.ReadSeeker) error {
+	signed := &request.Request{
+		ClientInfo: metadata.ClientInfo{
+			SigningRegion: b.region(),
+			SigningName:   s3Service,
+		},
+		Config: aws.Config{
+			Credentials: b.credentials(),
+		},
+		HTTPRequest: req,
+		Body:        body,
+		Time:        time.Now(),
+	}
+	v4.Sign(signed)
+	return signed.Error
+}
+
+func (b s3PushBackend) do(req *http.Request, fields data.Fields) error {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errs.WithEF(err, fields, "S3 request failed")
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		content, _ := ioutil.ReadAll(res.Body)
+		return errs.WithF(fields.WithField("status", fmt.Sprintf("%d", res.StatusCode)).WithField("response", string(content)), "Bad HTTP status code from S3")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+	"github.com/blablacar/dgr/dgr/common"
+	. "github.com/onsi/gomega"
+)
+
+type s3Request struct {
+	path   string
+	source string
+	body   string
+	valid  bool
+}
+
+// s3TestServer records the requests, checking their signature by signing them again with the secret
+func s3TestServer(secret string) (*httptest.Server, func() []s3Request) {
+	var mutex sync.Mutex
+	requests := []s3Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		date, _ := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+
+		resigned, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+		resigned.ContentLength = r.ContentLength
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			resigned.Header.Set("X-Amz-Copy-Source", source)
+		}
+		signed := &request.Request{
+			ClientInfo:  metadata.ClientInfo{SigningRegion: "eu-west-1", SigningName: s3Service},
+			Config:      aws.Config{Credentials: credentials.NewStaticCredentials("key", secret, "")},
+			HTTPRequest: resigned,
+			Body:        bytes.NewReader(body),
+			Time:        date,
+		}
+		v4.Sign(signed)
+
+		mutex.Lock()
+		requests = append(requests, s3Request{
+			path:   r.URL.EscapedPath(),
+			source: r.Header.Get("X-Amz-Copy-Source"),
+			body:   string(body),
+			valid:  signed.Error == nil && r.Header.Get("Authorization") == resigned.Header.Get("Authorization"),
+		})
+		mutex.Unlock()
+		if r.Method != "PUT" || strings.HasSuffix(r.URL.Path, "/failing.aci") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	return server, func() []s3Request {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return requests
+	}
+}
+
+func TestS3PushBackend(t *testing.T) {
+	RegisterTestingT(t)
+
+	server, requests := s3TestServer("secret")
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "push-s3")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	Expect(ioutil.WriteFile(dir+"/image.aci", []byte("aci content"), 0644)).To(Succeed())
+	Expect(ioutil.WriteFile(dir+"/image.aci.asc", []byte("signature"), 0644)).To(Succeed())
+
+	backend := s3PushBackend{config: PushConfig{Bucket: "acis", Prefix: "/linux/", Endpoint: server.URL + "/",
+		Region: "eu-west-1", AccessKeyId: "key", SecretAccessKey: "secret"}}
+	artifact := common.NewPushArtifact("aci.example.com/my app:1.0", dir+"/image.aci", "aci", "linux", "amd64")
+	Expect(backend.Push(artifact)).To(Succeed())
+
+	Expect(requests()).To(Equal([]s3Request{
+		{path: "/acis/linux/aci.example.com/my%20app-1.0-linux-amd64.aci", body: "aci content", valid: true},
+		{path: "/acis/linux/aci.example.com/my%20app-latest-linux-amd64.aci",
+			source: "/acis/linux/aci.example.com/my%20app-1.0-linux-amd64.aci", valid: true},
+		{path: "/acis/linux/aci.example.com/my%20app-1.0-linux-amd64.aci.asc", body: "signature", valid: true},
+		{path: "/acis/linux/aci.example.com/my%20app-latest-linux-amd64.aci.asc",
+			source: "/acis/linux/aci.example.com/my%20app-1.0-linux-amd64.aci.asc", valid: true},
+	}))
+}
+
+func TestS3PushBackendSignature(t *testing.T) {
+	RegisterTestingT(t)
+
+	server, requests := s3TestServer("other")
+	defer server.Close()
+	backend := s3PushBackend{config: PushConfig{Bucket: "acis", Endpoint: server.URL,
+		Region: "eu-west-1", AccessKeyId: "key", SecretAccessKey: "secret"}}
+	Expect(backend.copy("app-1.aci", "app-latest.aci")).To(Succeed())
+	Expect(requests()).To(HaveLen(1))
+	Expect(requests()[0].valid).To(BeFalse())
+	Expect(requests()[0].source).To(Equal("/acis/app-1.aci"))
+
+	Expect(backend.copy("app-1.aci", "failing.aci")).NotTo(Succeed())
+}
@@ -14,10 +14,12 @@ import (
 	"github.com/appc/spec/aci"
 	appcdiscovery "github.com/appc/spec/discovery"
 	"github.com/appc/spec/schema"
+	"github.com/blablacar/dgr/dgr/common"
 	"github.com/blablacar/dgr/dgr/discovery"
 	"github.com/coreos/ioprogress"
 	"github.com/n0rad/go-erlog/data"
 	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
 )
 
 const (
@@ -53,6 +55,12 @@ type Uploader struct {
 	Uri     string
 	Debug   bool
 
+	// Pod tells that Acipath is a pod manifest, that is uploaded as its own manifest
+	Pod bool
+
+	// Config sets retries of requests and chunks size of multipart uploads
+	Config common.UploadConfig
+
 	// SetHTTPHeaders is called on every request before being sent.
 	// This is exposed so that the user of acpush can set any headers
 	// necessary for authentication.
@@ -77,45 +85,19 @@ func (u Uploader) Upload() error {
 		defer ascfile.Close()
 	}
 
-	manifest, err := aci.ManifestFromImage(acifile)
-	if err != nil {
-		return errs.WithEF(err, data.WithField("file", u.Ascpath), "Failed to extract manifest from aci")
-	}
 	app, err := discovery.NewAppFromString(u.Uri)
 	if err != nil {
 		return errs.WithEF(err, data.WithField("uri", u.Uri), "Failed to prepare app")
 	}
 
-	if _, ok := app.Labels[archLabelName]; !ok {
-		arch, ok := manifest.Labels.Get(archLabelName)
-		if !ok {
-			return fmt.Errorf("manifest is missing label: %q", archLabelName)
-		}
-		app.Labels[archLabelName] = arch
-	}
-
-	if _, ok := app.Labels[osLabelName]; !ok {
-		os, ok := manifest.Labels.Get(osLabelName)
-		if !ok {
-			return fmt.Errorf("manifest is missing label: %q", osLabelName)
-		}
-		app.Labels[osLabelName] = os
-	}
-
-	if _, ok := app.Labels[extLabelName]; !ok {
-		app.Labels[extLabelName] = strings.Trim(schema.ACIExtension, ".")
-	}
-
-	// Just to make sure that we start reading from the front of the file in
-	// case aci.ManifestFromImage changed the cursor into the file.
-	_, err = acifile.Seek(0, 0)
-	if err != nil {
-		return errs.WithE(err, "Failed to seek to beginning of file")
+	var manblob []byte
+	if u.Pod {
+		manblob, err = u.podManifest(acifile, app)
+	} else {
+		manblob, err = u.aciManifest(acifile, app)
 	}
-
-	manblob, err := manifest.MarshalJSON()
 	if err != nil {
-		return errs.WithE(err, "Failed to marshall manifest")
+		return err
 	}
 
 	initurl, err := u.getInitiationURL(app)
@@ -128,22 +110,29 @@ func (u Uploader) Upload() error {
 		return errs.WithE(err, "Failed to initiate upload")
 	}
 
-	type partToUpload struct {
-		label string
-		url   string
-		r     io.Reader
-		draw  bool
+	imageLabel := "ACI"
+	if u.Pod {
+		imageLabel = "pod manifest"
+	}
+	imagePart, err := newUploadPart(imageLabel, initDeets.ACIURL, acifile, true)
+	if err != nil {
+		return errs.WithEF(err, data.WithField("file", u.Acipath), "Failed to prepare upload")
+	}
+	imagePart.multipart = initDeets.Multipart
+	parts := []uploadPart{
+		{label: "manifest", url: initDeets.ManifestURL, body: bytes.NewReader(manblob), size: int64(len(manblob))},
+		imagePart,
 	}
-
-	parts := []partToUpload{
-		{"manifest", initDeets.ManifestURL, bytes.NewReader(manblob), false},
-		{"ACI", initDeets.ACIURL, acifile, true}}
 	if ascfile != nil {
-		parts = append(parts, partToUpload{"signature", initDeets.SignatureURL, ascfile, true})
+		ascPart, err := newUploadPart("signature", initDeets.SignatureURL, ascfile, true)
+		if err != nil {
+			return errs.WithEF(err, data.WithField("file", u.Ascpath), "Failed to prepare upload")
+		}
+		parts = append(parts, ascPart)
 	}
 
 	for _, part := range parts {
-		err = u.uploadPart(part.url, part.r, part.draw, part.label)
+		err = u.uploadPart(part)
 		if err != nil {
 			reason := fmt.Errorf("error uploading %s: %v", part.label, err)
 			reportErr := u.reportFailure(initDeets.CompletedURL, reason.Error())
@@ -162,11 +151,71 @@ func (u Uploader) Upload() error {
 	return nil
 }
 
+func (u Uploader) aciManifest(acifile *os.File, app *discovery.App) ([]byte, error) {
+	manifest, err := aci.ManifestFromImage(acifile)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("file", u.Acipath), "Failed to extract manifest from aci")
+	}
+
+	if _, ok := app.Labels[archLabelName]; !ok {
+		arch, ok := manifest.Labels.Get(archLabelName)
+		if !ok {
+			return nil, fmt.Errorf("manifest is missing label: %q", archLabelName)
+		}
+		app.Labels[archLabelName] = arch
+	}
+
+	if _, ok := app.Labels[osLabelName]; !ok {
+		os, ok := manifest.Labels.Get(osLabelName)
+		if !ok {
+			return nil, fmt.Errorf("manifest is missing label: %q", osLabelName)
+		}
+		app.Labels[osLabelName] = os
+	}
+
+	if _, ok := app.Labels[extLabelName]; !ok {
+		app.Labels[extLabelName] = strings.Trim(schema.ACIExtension, ".")
+	}
+
+	// Just to make sure that we start reading from the front of the file in
+	// case aci.ManifestFromImage changed the cursor into the file.
+	if _, err = acifile.Seek(0, 0); err != nil {
+		return nil, errs.WithE(err, "Failed to seek to beginning of file")
+	}
+
+	manblob, err := manifest.MarshalJSON()
+	if err != nil {
+		return nil, errs.WithE(err, "Failed to marshall manifest")
+	}
+	return manblob, nil
+}
+
+func (u Uploader) podManifest(podfile *os.File, app *discovery.App) ([]byte, error) {
+	manblob, err := ioutil.ReadAll(podfile)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("file", u.Acipath), "Failed to read pod manifest")
+	}
+	manifest := schema.BlankPodManifest()
+	if err := manifest.UnmarshalJSON(manblob); err != nil {
+		return nil, errs.WithEF(err, data.WithField("file", u.Acipath), "Invalid pod manifest")
+	}
+	if _, err := podfile.Seek(0, 0); err != nil {
+		return nil, errs.WithE(err, "Failed to seek to beginning of file")
+	}
+
+	for k, v := range common.PodArtifactLabels() {
+		if _, ok := app.Labels[k]; !ok {
+			app.Labels[k] = v
+		}
+	}
+	return manblob, nil
+}
+
 func (u Uploader) getInitiationURL(app *discovery.App) (string, error) {
 	if u.Debug {
 		stderr("searching for push endpoint via meta discovery")
 	}
-	eps, attempts, err := discovery.DiscoverEndpoints(*app, Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption())
+	eps, attempts, err := discoverEndpoints(*app, false)
 	if u.Debug {
 		for _, a := range attempts {
 			stderr("meta tag 'ac-push-discovery' not found on %s: %v", a.Prefix, a.Error)
@@ -190,40 +239,149 @@ func (u Uploader) initiateUpload(initurl string) (*initiateDetails, error) {
 	if u.Debug {
 		stderr("initiating upload")
 	}
-	resp, err := u.performRequest("POST", initurl, nil, false, "")
-	if err != nil {
-		return nil, errs.WithE(err, "Failed To perform push request")
-	}
-	defer resp.Close()
+	deets := &initiateDetails{}
+	err := u.retry("initiate", func() error {
+		res, err := u.performRequest("POST", initurl, nil, 0, nil)
+		if err != nil {
+			return errs.WithE(err, "Failed To perform push request")
+		}
+		defer res.Body.Close()
 
-	respblob, err := ioutil.ReadAll(resp)
+		respblob, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return errs.WithE(err, "Failed To read response")
+		}
+		if err := json.Unmarshal(respblob, deets); err != nil {
+			return errs.WithE(err, "Failed to unmarshal response from upload")
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, errs.WithE(err, "Failed To read response")
+		return nil, err
 	}
 
-	deets := &initiateDetails{}
-	err = json.Unmarshal(respblob, deets)
-
 	if u.Debug {
 		stderr("upload initiated")
 		stderr(" - manifest endpoint: %s", deets.ManifestURL)
 		stderr(" - signature endpoint: %s", deets.SignatureURL)
 		stderr(" - aci endpoint: %s", deets.ACIURL)
+		stderr(" - multipart: %t", deets.Multipart)
 	}
+	return deets, nil
+}
 
+// uploadPart sends the part in one request, or in chunks when the server supports multipart
+func (u Uploader) uploadPart(part uploadPart) error {
+	chunkSize, err := u.Config.ChunkBytes()
 	if err != nil {
-		return nil, errs.WithE(err, "Failed to unmarshal response from upload")
+		return err
+	}
+	if part.multipart && part.size > chunkSize {
+		return u.uploadChunks(part, chunkSize)
 	}
 
-	return deets, err
+	return u.retry(part.label, func() error {
+		res, err := u.performRequest("PUT", part.url, part.reader(0, part.size), part.size, nil)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if err := checkUploadStatus(res); err != nil {
+			return err
+		}
+		return u.checkDigest(res.Header, part)
+	})
 }
 
-func (u Uploader) uploadPart(url string, body io.Reader, draw bool, label string) error {
-	resp, err := u.performRequest("PUT", url, body, draw, label)
+// uploadChunks sends ranges of the part. On failure, upload resumes from the size received by the server.
+// A chunk starting at 0 restarts the upload, as done when the digest of the complete upload does not match.
+func (u Uploader) uploadChunks(part uploadPart, chunkSize int64) error {
+	var offset int64
+	resume := false
+	for offset < part.size {
+		err := u.retry(part.label, func() error {
+			if resume {
+				received, header, err := u.receivedSize(part.url)
+				if err != nil {
+					return err
+				}
+				offset = received
+				if offset >= part.size {
+					offset = part.size
+					if err := u.checkDigest(header, part); err != nil {
+						offset, resume = 0, false // restarted from 0, the server truncating the part
+						return err
+					}
+					return nil
+				}
+			}
+			resume = true
+
+			length := chunkSize
+			if offset+length > part.size {
+				length = part.size - offset
+			}
+			headers := map[string]string{
+				"Content-Range": fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, part.size),
+			}
+			res, err := u.performRequest("PUT", part.url, part.reader(offset, length), length, headers)
+			if err != nil {
+				return err
+			}
+			defer res.Body.Close()
+			if err := checkUploadStatus(res); err != nil {
+				return err
+			}
+
+			resume = false
+			offset += length
+			if offset < part.size {
+				return nil
+			}
+			if err := u.checkDigest(res.Header, part); err != nil {
+				offset = 0
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receivedSize reads the 'Range: bytes=0-<last>' header returned by the server for the part
+func (u Uploader) receivedSize(url string) (int64, http.Header, error) {
+	res, err := u.performRequest("HEAD", url, nil, 0, nil)
 	if err != nil {
-		return err
+		return 0, nil, err
+	}
+	res.Body.Close()
+	if err := checkUploadStatus(res); err != nil {
+		return 0, nil, err
+	}
+
+	var first, last int64
+	rangeHeader := strings.TrimPrefix(res.Header.Get("Range"), "bytes=")
+	if _, err := fmt.Sscanf(rangeHeader, "%d-%d", &first, &last); err != nil || first != 0 {
+		return 0, res.Header, nil
+	}
+	return last + 1, res.Header, nil
+}
+
+func (u Uploader) checkDigest(headers http.Header, part uploadPart) error {
+	header := headers.Get(common.DigestHeader)
+	if header == "" {
+		return nil
+	}
+	checked, err := common.CheckDigest(header, io.NewSectionReader(part.body, 0, part.size))
+	if err != nil {
+		return errs.WithEF(err, data.WithField("part", part.label), "Uploaded content differs from local one")
+	}
+	if checked && u.Debug {
+		stderr("%s digest verified", part.label)
 	}
-	resp.Close()
 	return nil
 }
 
@@ -244,19 +402,20 @@ func (u Uploader) reportFailure(url string, reason string) error {
 }
 
 func (u Uploader) complete(url string, blob []byte) error {
-	resp, err := u.performRequest("POST", url, bytes.NewReader(blob), false, "")
-	if err != nil {
-		return err
-	}
-	defer resp.Close()
-
-	respblob, err := ioutil.ReadAll(resp)
-	if err != nil {
-		return err
-	}
-
 	reply := &completeMsg{}
-	err = json.Unmarshal(respblob, reply)
+	err := u.retry("completion", func() error {
+		res, err := u.performRequest("POST", url, bytes.NewReader(blob), int64(len(blob)), nil)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		respblob, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(respblob, reply)
+	})
 	if err != nil {
 		return err
 	}
@@ -268,19 +427,29 @@ func (u Uploader) complete(url string, blob []byte) error {
 	return nil
 }
 
-func (u Uploader) performRequest(reqType string, url string, body io.Reader, draw bool, label string) (io.ReadCloser, error) {
-	if fbody, ok := body.(*os.File); draw && ok {
-		var err error
-		body, err = genProgressBar(fbody, label)
-		if err != nil {
-			return nil, err
+// retry runs the request again on network errors, server errors and digest mismatches
+func (u Uploader) retry(label string, request func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := request()
+		if err == nil || attempt >= u.Config.MaxRetries() || !isRetryableUploadError(err) {
+			return err
 		}
+		delay := u.Config.Backoff(attempt)
+		logs.WithEF(err, data.WithField("part", label).WithField("retry", attempt+1).WithField("delay", delay)).
+			Warn("Upload request failed, retrying")
+		time.Sleep(delay)
 	}
+}
 
+func (u Uploader) performRequest(reqType string, url string, body io.Reader, length int64, headers map[string]string) (*http.Response, error) {
 	req, err := http.NewRequest(reqType, url, body)
 	if err != nil {
 		return nil, err
 	}
+	req.ContentLength = length
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 	client := appcdiscovery.Client
 	if Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption()&appcdiscovery.InsecureTLS != 0 {
 		client = appcdiscovery.ClientInsecureTLS
@@ -300,16 +469,79 @@ func (u Uploader) performRequest(reqType string, url string, body io.Reader, dra
 		return nil, err
 	}
 
-	switch res.StatusCode {
-	case http.StatusOK:
-		return res.Body, nil
-	case http.StatusBadRequest:
-		return res.Body, nil
-	default:
-		res.Body.Close()
-		return nil, fmt.Errorf("bad HTTP status code: %d", res.StatusCode)
+	if res.StatusCode/100 == 2 || res.StatusCode == http.StatusBadRequest {
+		return res, nil
+	}
+	res.Body.Close()
+	return nil, uploadStatusError{res.StatusCode}
+}
+
+type uploadStatusError struct {
+	code int
+}
+
+func (e uploadStatusError) Error() string {
+	return fmt.Sprintf("bad HTTP status code: %d", e.code)
+}
+
+// checkUploadStatus fails on the bad request status, which is only accepted for completion replies
+func checkUploadStatus(res *http.Response) error {
+	if res.StatusCode == http.StatusBadRequest {
+		return uploadStatusError{res.StatusCode}
+	}
+	return nil
+}
+
+func isRetryableUploadError(err error) bool {
+	if e, ok := err.(uploadStatusError); ok {
+		// a range not satisfiable is fixed by resuming from the size received by the server
+		return e.code >= 500 || e.code == http.StatusRequestTimeout || e.code == http.StatusTooManyRequests ||
+			e.code == http.StatusRequestedRangeNotSatisfiable
+	}
+	return true
+}
+
+type uploadReader interface {
+	io.Reader
+	io.ReaderAt
+}
+
+type uploadPart struct {
+	label     string
+	url       string
+	body      uploadReader
+	size      int64
+	draw      bool
+	multipart bool
+}
+
+func newUploadPart(label string, url string, file *os.File, draw bool) (uploadPart, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return uploadPart{}, err
+	}
+	return uploadPart{label: label, url: url, body: file, size: info.Size(), draw: draw}, nil
+}
+
+// reader is read from the start on each attempt, progress being drawn relatively to the whole part
+func (p uploadPart) reader(offset int64, length int64) io.Reader {
+	section := io.NewSectionReader(p.body, offset, length)
+	if !p.draw {
+		return section
 	}
+	return newProgressReader(section, offset, length, p.size, p.label)
+}
 
+func rktConfigDirs() (string, string) {
+	systemConf := Home.Config.Rkt.SystemConfig
+	if systemConf == "" {
+		systemConf = "/usr/lib/rkt"
+	}
+	localConf := Home.Config.Rkt.LocalConfig
+	if localConf == "" {
+		localConf = "/etc/rkt"
+	}
+	return systemConf, localConf
 }
 
 func genProgressBar(file *os.File, label string) (io.Reader, error) {
@@ -317,7 +549,11 @@ func genProgressBar(file *os.File, label string) (io.Reader, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newProgressReader(file, 0, finfo.Size(), finfo.Size(), label), nil
+}
 
+// newProgressReader draws the progress of reading length bytes, starting at offset of the total
+func newProgressReader(reader io.Reader, offset int64, length int64, total int64, label string) io.Reader {
 	var prefix string
 	if label != "" {
 		prefix = "Uploading " + label
@@ -327,9 +563,9 @@ func genProgressBar(file *os.File, label string) (io.Reader, error) {
 	fmtBytesSize := 18
 	barSize := int64(80 - len(prefix) - fmtBytesSize)
 	bar := ioprogress.DrawTextFormatBarForW(barSize, os.Stderr)
-	fmtfunc := func(progress, total int64) string {
+	fmtfunc := func(progress, size int64) string {
 		// Content-Length is set to -1 when unknown.
-		if total == -1 {
+		if size == -1 {
 			return fmt.Sprintf(
 				"%s: %v of an unknown total size",
 				prefix,
@@ -339,14 +575,14 @@ func genProgressBar(file *os.File, label string) (io.Reader, error) {
 		return fmt.Sprintf(
 			"%s: %s %s",
 			prefix,
-			bar(progress, total),
-			ioprogress.DrawTextFormatBytes(progress, total),
+			bar(offset+progress, total),
+			ioprogress.DrawTextFormatBytes(offset+progress, total),
 		)
 	}
 	return &ioprogress.Reader{
-		Reader:       file,
-		Size:         finfo.Size(),
+		Reader:       reader,
+		Size:         length,
 		DrawFunc:     ioprogress.DrawTerminalf(os.Stderr, fmtfunc),
 		DrawInterval: time.Second,
-	}, nil
+	}
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blablacar/dgr/dgr/common"
+	. "github.com/onsi/gomega"
+)
+
+const uploadContent = "0123456789"
+
+// uploadTestServer is the image server, failing the upload requests given by fail after serving them
+type uploadTestServer struct {
+	*httptest.Server
+	image     *ImageServer
+	mutex     sync.Mutex
+	requests  []string
+	fail      func(index int, r *http.Request) bool
+	afterFail func()
+}
+
+func newUploadTestServer(dir string, fail func(index int, r *http.Request) bool) *uploadTestServer {
+	image, err := NewImageServer(dir, "", time.Hour)
+	Expect(err).NotTo(HaveOccurred())
+	server := &uploadTestServer{image: image, fail: fail}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		index := len(server.requests)
+		server.requests = append(server.requests, r.Method+" "+r.Header.Get("Content-Range"))
+		server.mutex.Unlock()
+
+		if r.Method == "POST" || !server.fail(index, r) {
+			image.ServeHTTP(w, r)
+			return
+		}
+		image.ServeHTTP(httptest.NewRecorder(), r)
+		if server.afterFail != nil {
+			server.afterFail()
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	return server
+}
+
+// initiate returns the url of the aci and the file where it is written
+func (s *uploadTestServer) initiate() (string, string) {
+	res, err := http.Post(s.URL+servePathPush+"initiate?name=aci.example.com/app&version=1&os=linux&arch=amd64&ext=aci", "", nil)
+	Expect(err).NotTo(HaveOccurred())
+	defer res.Body.Close()
+	details := initiateDetails{}
+	Expect(json.NewDecoder(res.Body).Decode(&details)).To(Succeed())
+	s.requests = nil
+	for _, session := range s.image.sessions {
+		return details.ACIURL, session.artifact.File
+	}
+	return "", ""
+}
+
+func testUploader(retries int) Uploader {
+	return Uploader{
+		Config:         common.UploadConfig{Retries: &retries, RetryDelay: "1ms", ChunkSize: "4"},
+		SetHTTPHeaders: func(*http.Request) {},
+	}
+}
+
+func testUploadPart(url string, multipart bool) uploadPart {
+	return uploadPart{label: "aci", url: url, body: bytes.NewReader([]byte(uploadContent)), size: int64(len(uploadContent)),
+		multipart: multipart}
+}
+
+func TestUploaderRetry(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "upload")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	server := newUploadTestServer(dir, func(index int, r *http.Request) bool { return index < 2 })
+	defer server.Close()
+	url, file := server.initiate()
+	defer os.RemoveAll(filepath.Dir(file))
+
+	Expect(testUploader(1).uploadPart(testUploadPart(url, false))).NotTo(Succeed())
+	Expect(server.requests).To(Equal([]string{"PUT ", "PUT "}))
+
+	server.requests = nil
+	Expect(testUploader(2).uploadPart(testUploadPart(url, false))).To(Succeed())
+	Expect(server.requests).To(Equal([]string{"PUT ", "PUT ", "PUT "}))
+	Expect(ioutil.ReadFile(file)).To(Equal([]byte(uploadContent)))
+}
+
+func TestUploaderResume(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "upload")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	server := newUploadTestServer(dir, func(index int, r *http.Request) bool { return index == 1 })
+	defer server.Close()
+	url, file := server.initiate()
+	defer os.RemoveAll(filepath.Dir(file))
+
+	Expect(testUploader(1).uploadPart(testUploadPart(url, true))).To(Succeed())
+	Expect(server.requests).To(Equal([]string{
+		"PUT bytes 0-3/10",
+		"PUT bytes 4-7/10", // received by the server, but failed
+		"HEAD ",
+		"PUT bytes 8-9/10",
+	}))
+	Expect(ioutil.ReadFile(file)).To(Equal([]byte(uploadContent)))
+}
+
+func TestUploaderResumeDigestMismatch(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "upload")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	server := newUploadTestServer(dir, func(index int, r *http.Request) bool { return index == 2 })
+	defer server.Close()
+	url, file := server.initiate()
+	defer os.RemoveAll(filepath.Dir(file))
+	server.afterFail = func() { Expect(ioutil.WriteFile(file, []byte("corrupted!"), 0644)).To(Succeed()) }
+
+	Expect(testUploader(2).uploadPart(testUploadPart(url, true))).To(Succeed())
+	Expect(server.requests).To(Equal([]string{
+		"PUT bytes 0-3/10",
+		"PUT bytes 4-7/10",
+		"PUT bytes 8-9/10", // received by the server, but failed and corrupted
+		"HEAD ",
+		"PUT bytes 0-3/10",
+		"PUT bytes 4-7/10",
+		"PUT bytes 8-9/10",
+	}))
+	Expect(ioutil.ReadFile(file)).To(Equal([]byte(uploadContent)))
+}
@@ -14,22 +14,17 @@ import (
 
 var aciBuilder = common.NewACFullName("blitznote.com/aci/dgr-builder")
 var aciTester = common.NewACFullName("blablacar.github.io/dgr/aci-tester")
-var importMutex = sync.Mutex{}
-var builderImported = false
-var testerImported = false
+
+// pod's acis are built concurrently, each internal aci is imported only once and other builds wait for it
+var builderImport sync.Once
+var testerImport sync.Once
 
 func ImportInternalBuilderIfNeeded(manifest *common.AciManifest) {
 	if manifest.Builder.Image.String() == "" {
 		manifest.Builder.Image = *aciBuilder
-
-		importMutex.Lock()
-		defer importMutex.Unlock()
-		if builderImported {
-			return
-		}
-
-		importInternalAci("aci-builder.aci")
-		builderImported = true
+		builderImport.Do(func() {
+			importInternalAci("aci-builder.aci")
+		})
 	}
 }
 
@@ -37,15 +32,9 @@ func ImportInternalTesterIfNeeded(manifest *common.AciManifest) {
 	ImportInternalBuilderIfNeeded(manifest)
 	if manifest.Tester.Builder.Image.String() == "" {
 		manifest.Tester.Builder.Image = *aciTester
-
-		importMutex.Lock()
-		defer importMutex.Unlock()
-		if testerImported {
-			return
-		}
-
-		importInternalAci("aci-tester.aci")
-		testerImported = true
+		testerImport.Do(func() {
+			importInternalAci("aci-tester.aci")
+		})
 	}
 }
 
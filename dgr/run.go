@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/blablacar/dgr/bin-templater/merger"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const envTemplaterOverrideBase64 = "TEMPLATER_OVERRIDE_BASE64"
+const pathRunUuid = "/run.uuid"
+
+type runVolume struct {
+	name types.ACName
+	path string
+}
+
+type runPort struct {
+	name     types.ACName
+	hostPort uint
+}
+
+// runOverrides are the changes asked on the command line to the way apps are run
+type runOverrides struct {
+	env     []types.EnvironmentVariable
+	volumes []runVolume
+	ports   []runPort
+}
+
+func prepareRunOverrides(args BuildArgs) (*runOverrides, error) {
+	overrides := &runOverrides{}
+
+	for _, env := range args.RunEnv.Strings() {
+		pair := strings.SplitN(env, "=", 2)
+		overrides.env = append(overrides.env, types.EnvironmentVariable{Name: pair[0], Value: pair[1]})
+	}
+
+	if len(args.RunAttributes) > 0 {
+		attributes, err := mergeRunAttributes(args.RunAttributes)
+		if err != nil {
+			return nil, err
+		}
+		content, err := json.Marshal(attributes)
+		if err != nil {
+			return nil, errs.WithEF(err, data.WithField("attributes", attributes), "Failed to marshal attributes")
+		}
+		overrides.env = append(overrides.env, types.EnvironmentVariable{
+			Name:  envTemplaterOverrideBase64,
+			Value: "base64," + base64.StdEncoding.EncodeToString(content),
+		})
+	}
+
+	for _, volume := range args.RunVolumes {
+		pair := strings.SplitN(volume, "=", 2)
+		if len(pair) != 2 || pair[1] == "" {
+			return nil, errs.WithF(data.WithField("volume", volume), "Volume must be specified as name=/host/path")
+		}
+		name, err := types.NewACName(pair[0])
+		if err != nil {
+			return nil, errs.WithEF(err, data.WithField("volume", volume), "Invalid volume name")
+		}
+		overrides.volumes = append(overrides.volumes, runVolume{name: *name, path: pair[1]})
+	}
+
+	for _, port := range args.RunPorts {
+		parts := strings.SplitN(port, ":", 2)
+		if len(parts) != 2 {
+			return nil, errs.WithF(data.WithField("port", port), "Port must be specified as name:hostPort")
+		}
+		name, err := types.NewACName(parts[0])
+		if err != nil {
+			return nil, errs.WithEF(err, data.WithField("port", port), "Invalid port name")
+		}
+		hostPort, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil {
+			return nil, errs.WithEF(err, data.WithField("port", port), "Invalid host port")
+		}
+		overrides.ports = append(overrides.ports, runPort{name: *name, hostPort: uint(hostPort)})
+	}
+	return overrides, nil
+}
+
+// mergeRunAttributes merges attributes files, in the same format as project's ones, the last one winning
+func mergeRunAttributes(files []string) (attributes map[string]interface{}, err error) {
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			return nil, errs.WithEF(err, data.WithField("file", file), "Cannot read attributes file")
+		}
+	}
+	defer func() {
+		// the merger panics on invalid content
+		if r := recover(); r != nil {
+			err = errs.WithF(data.WithField("files", files).WithField("cause", r), "Failed to merge attributes files")
+		}
+	}()
+	return merger.MergeAttributesFiles(files), nil
+}
+
+// runInteractive runs rkt attached to the terminal. Interrupts are left to rkt so that the pod can be removed after.
+func runInteractive(args []string, uuidFile string) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	err := Home.Rkt.RunInteractive(append([]string{"--uuid-file-save=" + uuidFile}, args...))
+	if _, _, rmErr := Home.Rkt.RmFromFile(uuidFile); rmErr != nil {
+		logs.WithE(rmErr).Warn("Failed to remove run container")
+	}
+	os.Remove(uuidFile)
+	return err
+}
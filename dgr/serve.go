@@ -0,0 +1,431 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appc/spec/schema"
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const servePathPush = "/_push/"
+const servePathPubkeys = "/pubkeys.gpg"
+const serveLatest = "latest"
+
+var serveDiscoveryPage = template.Must(template.New("discovery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="ac-discovery" content="{{.Prefix}} {{.Base}}/` + common.PushArtifactTemplate + `">
+{{if .Pubkeys}}<meta name="ac-discovery-pubkeys" content="{{.Prefix}} {{.Base}}` + servePathPubkeys + `">
+{{end}}<meta name="ac-push-discovery" content="{{.Prefix}} {{.Base}}` + servePathPush + `initiate?name={name}&version={version}&os={os}&arch={arch}&ext={ext}">
+</head>
+</html>
+`))
+
+// ImageServer serves the layout of the directory push backend, answers appc discovery and implements the
+// server side of the push protocol, pushed images being written in the directory.
+type ImageServer struct {
+	dir            string
+	authorization  string // Authorization header required for pushes, none when empty
+	sessionTimeout time.Duration
+	sessions       map[string]*uploadSession
+	mutex          sync.Mutex
+}
+
+type uploadSession struct {
+	dir      string
+	artifact common.PushArtifact
+	lastUse  time.Time
+}
+
+// NewImageServer serves the directory. Pushes require the Authorization header of the auth configuration
+// for authHost when set, and upload sessions not used for sessionTimeout are removed.
+func NewImageServer(dir string, authHost string, sessionTimeout time.Duration) (*ImageServer, error) {
+	fullPath, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("dir", dir), "Cannot get fullpath")
+	}
+	if info, err := os.Stat(fullPath); err != nil || !info.IsDir() {
+		return nil, errs.WithEF(err, data.WithField("dir", fullPath), "Images directory not found")
+	}
+	if sessionTimeout <= 0 {
+		return nil, errs.WithF(data.WithField("timeout", sessionTimeout), "Session timeout must be positive")
+	}
+
+	server := &ImageServer{dir: fullPath, sessionTimeout: sessionTimeout, sessions: make(map[string]*uploadSession)}
+	if authHost != "" {
+		header, err := Home.Config.Auths.Header(authHost)
+		if err != nil {
+			return nil, errs.WithEF(err, data.WithField("host", authHost), "Failed to get push credentials")
+		}
+		if header == nil {
+			return nil, errs.WithF(data.WithField("host", authHost), "No auth configured for host")
+		}
+		server.authorization = header.Get("Authorization")
+	}
+	return server, nil
+}
+
+func (s *ImageServer) ListenAndServe(listen string, tlsCert string, tlsKey string) error {
+	fields := data.WithField("listen", listen).WithField("dir", s.dir)
+	logs.WithF(fields).Info("Serving images")
+	if s.authorization == "" {
+		logs.WithF(fields).Warn("Pushes are not authenticated")
+	}
+	go func() {
+		for now := range time.Tick(s.sessionTimeout / 4) {
+			s.expireSessions(now)
+		}
+	}()
+
+	var err error
+	if tlsCert != "" {
+		err = http.ListenAndServeTLS(listen, tlsCert, tlsKey, s)
+	} else {
+		err = http.ListenAndServe(listen, s)
+	}
+	return errs.WithEF(err, fields, "Server stopped")
+}
+
+// expireSessions removes the upload sessions not used since the session timeout, with their uploaded files
+func (s *ImageServer) expireSessions(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, session := range s.sessions {
+		if now.Sub(session.lastUse) > s.sessionTimeout {
+			logs.WithField("image", session.artifact.Name).WithField("ext", session.artifact.Ext).Warn("Upload expired")
+			os.RemoveAll(session.dir)
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func (s *ImageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logs.WithField("method", r.Method).WithField("url", r.URL.String()).Debug("Request")
+	switch {
+	case r.URL.Query().Get("ac-discovery") == "1":
+		s.serveDiscovery(w, r)
+	case strings.HasPrefix(r.URL.Path, servePathPush):
+		s.servePush(w, r)
+	case r.Method == "GET" || r.Method == "HEAD":
+		s.serveFile(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *ImageServer) baseUrl(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// serveDiscovery answers for all images of the host, without the port that cannot be in an image name
+func (s *ImageServer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	prefix, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		prefix = r.Host
+	}
+	_, err = os.Stat(s.dir + servePathPubkeys)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveDiscoveryPage.Execute(w, struct {
+		Prefix  string
+		Base    string
+		Pubkeys bool
+	}{prefix, s.baseUrl(r), err == nil})
+}
+
+// serveFile redirects a missing 'latest' version to the greatest version found
+func (s *ImageServer) serveFile(w http.ResponseWriter, r *http.Request) {
+	file := filepath.Join(s.dir, path.Clean("/"+r.URL.Path))
+	if _, err := os.Stat(file); err == nil || !strings.Contains(filepath.Base(file), "-"+serveLatest+"-") {
+		http.ServeFile(w, r, file)
+		return
+	}
+
+	target, err := s.resolveLatest(file)
+	if err != nil || target == "" {
+		http.NotFound(w, r)
+		return
+	}
+	rel, _ := filepath.Rel(s.dir, target)
+	http.Redirect(w, r, "/"+filepath.ToSlash(rel), http.StatusFound)
+}
+
+func (s *ImageServer) resolveLatest(file string) (string, error) {
+	i := strings.LastIndex(file, "-"+serveLatest+"-")
+	before, after := file[:i+1], file[i+len(serveLatest)+1:]
+	matches, err := filepath.Glob(before + "*" + after)
+	if err != nil {
+		return "", err
+	}
+	var latest string
+	var latestVersion common.Version
+	for _, match := range matches {
+		version := strings.TrimSuffix(strings.TrimPrefix(match, before), after)
+		if version == "" || version[0] < '0' || version[0] > '9' { // another image whose name starts the same
+			continue
+		}
+		if latest == "" || common.Version(version).GreaterThan(latestVersion) {
+			latest, latestVersion = match, common.Version(version)
+		}
+	}
+	return latest, nil
+}
+
+func (s *ImageServer) servePush(w http.ResponseWriter, r *http.Request) {
+	if s.authorization != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.authorization)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, servePathPush), "/")
+	if len(parts) == 1 && parts[0] == "initiate" && r.Method == "POST" {
+		s.initiateUpload(w, r)
+		return
+	}
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mutex.Lock()
+	session, ok := s.sessions[parts[0]]
+	if ok {
+		session.lastUse = time.Now()
+	}
+	s.mutex.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case parts[1] == "manifest" && r.Method == "PUT":
+		s.writePart(w, r, session.dir+"/manifest")
+	case parts[1] == "aci" && r.Method == "PUT":
+		s.writePart(w, r, session.artifact.File)
+	case parts[1] == "aci" && r.Method == "HEAD":
+		s.receivedPart(w, session.artifact.File)
+	case parts[1] == "signature" && r.Method == "PUT":
+		s.writePart(w, r, session.artifact.File+common.ExtAsc)
+	case parts[1] == "complete" && r.Method == "POST":
+		s.completeUpload(w, r, parts[0], session)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *ImageServer) initiateUpload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name, version := query.Get("name"), query.Get("version")
+	artifact := common.PushArtifact{
+		Name: *common.NewACFullName(name + ":" + version),
+		Os:   query.Get("os"),
+		Arch: query.Get("arch"),
+		Ext:  query.Get("ext"),
+	}
+	if name == "" || version == "" || version == serveLatest || artifact.Os == "" || artifact.Arch == "" || artifact.Ext == "" {
+		http.Error(w, "name, version, os, arch and ext are required", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(name, "..") || strings.ContainsAny(version+artifact.Os+artifact.Arch+artifact.Ext, "/") {
+		http.Error(w, "invalid image name", http.StatusBadRequest)
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dir, err := ioutil.TempDir("", "dgr-serve-upload")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	artifact.File = dir + "/artifact"
+	session := &uploadSession{dir: dir, artifact: artifact, lastUse: time.Now()}
+	sessionId := hex.EncodeToString(id)
+	s.mutex.Lock()
+	s.sessions[sessionId] = session
+	s.mutex.Unlock()
+
+	logs.WithField("image", artifact.Name).WithField("ext", artifact.Ext).Info("Upload initiated")
+	base := s.baseUrl(r) + servePathPush + sessionId + "/"
+	json.NewEncoder(w).Encode(initiateDetails{
+		ACIPushVersion: "0.0.1",
+		Multipart:      true,
+		ManifestURL:    base + "manifest",
+		SignatureURL:   base + "signature",
+		ACIURL:         base + "aci",
+		CompletedURL:   base + "complete",
+	})
+}
+
+// writePart writes the body, or the range of a multipart upload given by a Content-Range header.
+// The digest of the part is returned when it is complete.
+func (s *ImageServer) writePart(w http.ResponseWriter, r *http.Request, file string) {
+	var start, end, total int64 = 0, -1, -1
+	if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+		if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total); err != nil || start > end || end >= total {
+			http.Error(w, "invalid content range", http.StatusBadRequest)
+			return
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if start == 0 {
+		flags |= os.O_TRUNC
+	}
+	out, err := os.OpenFile(file, flags, 0644)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer out.Close()
+
+	info, err := out.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if info.Size() != start {
+		http.Error(w, "range does not start at received size", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if _, err := out.Seek(start, 0); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	written, err := io.Copy(out, r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if total == -1 || start+written == total {
+		if err := setDigestHeader(w, file); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// receivedPart tells the size of a multipart upload with a 'Range: bytes=0-<last>' header
+func (s *ImageServer) receivedPart(w http.ResponseWriter, file string) {
+	info, err := os.Stat(file)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", info.Size()-1))
+	if err := setDigestHeader(w, file); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func setDigestHeader(w http.ResponseWriter, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	digest, err := common.Digest(f)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(common.DigestHeader, digest)
+	return nil
+}
+
+// completeUpload moves the uploaded files in the directory, as the directory push backend does
+func (s *ImageServer) completeUpload(w http.ResponseWriter, r *http.Request, id string, session *uploadSession) {
+	s.mutex.Lock()
+	delete(s.sessions, id)
+	s.mutex.Unlock()
+	defer os.RemoveAll(session.dir)
+
+	fields := data.WithField("image", session.artifact.Name).WithField("ext", session.artifact.Ext)
+	reply := completeMsg{Success: true}
+	msg := completeMsg{}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		reply = completeMsg{Success: false, ServerReason: "invalid complete message: " + err.Error()}
+	} else if !msg.Success {
+		logs.WithF(fields.WithField("reason", msg.Reason)).Warn("Upload failed on client side")
+		reply = completeMsg{Success: false, ServerReason: "upload aborted"}
+	} else if err := s.storeUpload(session); err != nil {
+		logs.WithEF(err, fields).Error("Failed to store upload")
+		reply = completeMsg{Success: false, ServerReason: err.Error()}
+	} else {
+		logs.WithF(fields).Info("Upload completed")
+	}
+
+	if !reply.Success {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(reply)
+}
+
+func (s *ImageServer) storeUpload(session *uploadSession) error {
+	fields := data.WithField("image", session.artifact.Name)
+	if _, err := os.Stat(session.artifact.File); err != nil {
+		return errs.WithEF(err, fields, "Image was not uploaded")
+	}
+	if err := s.checkManifest(session); err != nil {
+		return err
+	}
+
+	artifact := common.NewPushArtifact(session.artifact.Name, session.artifact.File, session.artifact.Ext,
+		session.artifact.Os, session.artifact.Arch)
+	return directoryPushBackend{config: PushConfig{Path: s.dir}}.Push(artifact)
+}
+
+// checkManifest verifies that the uploaded manifest is the one of the pushed name
+func (s *ImageServer) checkManifest(session *uploadSession) error {
+	fields := data.WithField("image", session.artifact.Name)
+	content, err := ioutil.ReadFile(session.dir + "/manifest")
+	if err != nil {
+		return errs.WithEF(err, fields, "Manifest was not uploaded")
+	}
+
+	if session.artifact.Ext == common.PodArtifactExt {
+		manifest := schema.BlankPodManifest()
+		if err := manifest.UnmarshalJSON(content); err != nil {
+			return errs.WithEF(err, fields, "Invalid pod manifest")
+		}
+		name, err := common.PodArtifactName(manifest)
+		if err != nil {
+			return errs.WithEF(err, fields, "Invalid pod manifest")
+		}
+		if name.Name() != session.artifact.Name.Name() {
+			return errs.WithF(fields.WithField("manifest", name), "Pod manifest is not the one of the pushed name")
+		}
+		return nil
+	}
+
+	manifest := schema.BlankImageManifest()
+	if err := manifest.UnmarshalJSON(content); err != nil {
+		return errs.WithEF(err, fields, "Invalid image manifest")
+	}
+	if string(manifest.Name) != session.artifact.Name.Name() {
+		return errs.WithF(fields.WithField("manifest", manifest.Name), "Image manifest is not the one of the pushed name")
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blablacar/dgr/dgr/common"
+	. "github.com/onsi/gomega"
+)
+
+func TestImageServerSessionExpiry(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "serve")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	server, err := NewImageServer(dir, "", time.Hour)
+	Expect(err).NotTo(HaveOccurred())
+
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, httptest.NewRequest("POST", servePathPush+"initiate?name=aci.example.com/app&version=1&os=linux&arch=amd64&ext=aci", nil))
+	Expect(res.Code).To(Equal(http.StatusOK))
+	Expect(server.sessions).To(HaveLen(1))
+	var session *uploadSession
+	for _, s := range server.sessions {
+		session = s
+	}
+
+	server.expireSessions(time.Now().Add(time.Minute))
+	Expect(server.sessions).To(HaveLen(1))
+	server.expireSessions(time.Now().Add(2 * time.Hour))
+	Expect(server.sessions).To(BeEmpty())
+	_, err = os.Stat(session.dir)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+}
+
+func TestImageServerAuth(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "serve")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	Home.Config.Auths = common.Auths{{Hosts: []string{"aci.example.com"}, Type: common.AuthTypeBearer, Token: "secret"}}
+	defer func() { Home.Config.Auths = nil }()
+
+	_, err = NewImageServer(dir, "aci.example.org", time.Hour)
+	Expect(err).To(HaveOccurred())
+	server, err := NewImageServer(dir, "aci.example.com", time.Hour)
+	Expect(err).NotTo(HaveOccurred())
+
+	initiate := servePathPush + "initiate?name=aci.example.com/app&version=1&os=linux&arch=amd64&ext=aci"
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, httptest.NewRequest("POST", initiate, nil))
+	Expect(res.Code).To(Equal(http.StatusUnauthorized))
+
+	req := httptest.NewRequest("POST", initiate, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	res = httptest.NewRecorder()
+	server.ServeHTTP(res, req)
+	Expect(res.Code).To(Equal(http.StatusOK))
+	for _, session := range server.sessions {
+		os.RemoveAll(session.dir)
+	}
+
+	res = httptest.NewRecorder()
+	server.ServeHTTP(res, httptest.NewRequest("GET", "/app?ac-discovery=1", nil))
+	Expect(res.Code).To(Equal(http.StatusOK))
+}
+
+func TestImageServerDiscovery(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "serve")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	Expect(ioutil.WriteFile(dir+servePathPubkeys, []byte("keys"), 0644)).To(Succeed())
+	server, err := NewImageServer(dir, "", time.Hour)
+	Expect(err).NotTo(HaveOccurred())
+
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, httptest.NewRequest("GET", "http://localhost:8080/app?ac-discovery=1", nil))
+	Expect(res.Code).To(Equal(http.StatusOK))
+	var metas []string
+	for _, line := range strings.Split(res.Body.String(), "\n") {
+		if strings.HasPrefix(line, "<meta ") {
+			metas = append(metas, line)
+		}
+	}
+	Expect(metas).To(Equal([]string{
+		`<meta name="ac-discovery" content="localhost http://localhost:8080/{name}-{version}-{os}-{arch}.{ext}">`,
+		`<meta name="ac-discovery-pubkeys" content="localhost http://localhost:8080/pubkeys.gpg">`,
+		`<meta name="ac-push-discovery" content="localhost http://localhost:8080/_push/initiate?name={name}&version={version}&os={os}&arch={arch}&ext={ext}">`,
+	}))
+}
+
+func TestImageServerLatest(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "serve")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	Expect(os.MkdirAll(dir+"/localhost", 0755)).To(Succeed())
+	for _, name := range []string{"app-1.2-linux-amd64.aci", "app-1.10-linux-amd64.aci", "app-other-2-linux-amd64.aci"} {
+		Expect(ioutil.WriteFile(dir+"/localhost/"+name, []byte(name), 0644)).To(Succeed())
+	}
+	server, err := NewImageServer(dir, "", time.Hour)
+	Expect(err).NotTo(HaveOccurred())
+
+	res := httptest.NewRecorder()
+	server.ServeHTTP(res, httptest.NewRequest("GET", "/localhost/app-latest-linux-amd64.aci", nil))
+	Expect(res.Code).To(Equal(http.StatusFound))
+	Expect(res.Header().Get("Location")).To(Equal("/localhost/app-1.10-linux-amd64.aci"))
+
+	res = httptest.NewRecorder()
+	server.ServeHTTP(res, httptest.NewRequest("GET", "/localhost/app-latest-linux-arm64.aci", nil))
+	Expect(res.Code).To(Equal(http.StatusNotFound))
+}
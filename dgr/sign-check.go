@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+)
+
+// signCheck prints the sign entry matching the domain of the name, and the key selected in its keyring
+func signCheck(name string) error {
+	domain := common.NewACFullName(name).DomainName()
+	sign, pattern, err := Home.Config.MatchSignRule(domain)
+	if err != nil {
+		return err
+	}
+	if pattern == "" {
+		pattern = "(entry without domains)"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "domain:\t%s\n", domain)
+	fmt.Fprintf(w, "matched:\t%s\n", pattern)
+	fmt.Fprintf(w, "domains:\t%s\n", strings.Join(sign.Domains, ", "))
+	fmt.Fprintf(w, "disabled:\t%t\n", sign.Disabled)
+	fmt.Fprintf(w, "required:\t%t\n", sign.Required)
+	if sign.Disabled {
+		w.Flush()
+		_, err := signEnabled(sign)
+		return err
+	}
+
+	backend := sign.backend()
+	files := sign.Files
+	if files == "" {
+		files = "file of the command (aci for sign, gz for push)"
+	}
+	passphrase := sign.Passphrase
+	if passphrase == "" {
+		passphrase = "none"
+	}
+	fmt.Fprintf(w, "backend:\t%s\n", backend)
+	fmt.Fprintf(w, "keyring:\t%s\n", sign.Keyring)
+	fmt.Fprintf(w, "keyId:\t%s\n", sign.KeyId)
+	fmt.Fprintf(w, "passphrase:\t%s\n", passphrase)
+	fmt.Fprintf(w, "files:\t%s\n", files)
+	if _, err := signEnabled(sign); err != nil {
+		w.Flush()
+		return err
+	}
+	if backend == common.SignBackendGpg {
+		return w.Flush()
+	}
+
+	keyring, err := common.ReadKeyringFile(sign.Keyring)
+	if err != nil {
+		w.Flush()
+		return err
+	}
+	for _, key := range keyring {
+		if key.PrivateKey == nil || (sign.KeyId != "" && !common.MatchKeyId(key, sign.KeyId)) {
+			continue
+		}
+		fmt.Fprintf(w, "key:\t%s\n", common.KeyIdentity(key))
+		fmt.Fprintf(w, "fingerprint:\t%s\n", common.KeyFingerprint(key))
+		fmt.Fprintf(w, "encrypted:\t%t\n", key.PrivateKey.Encrypted)
+		return w.Flush()
+	}
+	w.Flush()
+	return errs.WithF(data.WithField("keyring", sign.Keyring).WithField("keyId", sign.KeyId), "No private key found in keyring to sign with")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+)
+
+const signFilesAci = "aci"
+const signFilesGz = "gz"
+const signFilesBoth = "both"
+
+func validateSign(sign Sign) error {
+	fields := data.WithField("domains", sign.Domains)
+	switch sign.Backend {
+	case "", common.SignBackendOpenpgp, common.SignBackendGpg:
+	default:
+		return errs.WithF(fields.WithField("backend", sign.Backend), "Unknown sign backend")
+	}
+	switch sign.Files {
+	case "", signFilesAci, signFilesGz, signFilesBoth:
+	default:
+		return errs.WithF(fields.WithField("files", sign.Files), "Unknown sign files, use aci, gz or both")
+	}
+	if _, err := common.NewPassphraseFunc(sign.Passphrase); err != nil {
+		return errs.WithEF(err, fields, "Invalid passphrase")
+	}
+	return nil
+}
+
+// signEnabled tells if images are signed with the sign entry, failing when signing is required but not possible
+func signEnabled(sign *Sign) (bool, error) {
+	if sign.Required && sign.Disabled {
+		return false, errs.WithF(data.WithField("domains", sign.Domains), "Signing is required but disabled")
+	}
+	if sign.Required && sign.Keyring == "" {
+		return false, errs.WithF(data.WithField("domains", sign.Domains), "Signing is required but no keyring is set")
+	}
+	return !sign.Disabled, nil
+}
+
+// signedImages returns the image files to sign when one is requested, as set by files
+func (sign Sign) signedImages(target string, requested string) []string {
+	switch sign.Files {
+	case signFilesAci:
+		return []string{target + pathImageAci}
+	case signFilesGz:
+		return []string{target + pathImageGzAci}
+	case signFilesBoth:
+		return []string{target + pathImageAci, target + pathImageGzAci}
+	}
+	return []string{requested}
+}
+
+// backend is gpg when not set, as before the openpgp backend existed
+func (sign Sign) backend() string {
+	if sign.Backend == "" {
+		return common.SignBackendGpg
+	}
+	return sign.Backend
+}
+
+// signFile writes the armored detached signature of the file next to it
+func signFile(sign *Sign, file string) error {
+	fields := data.WithField("file", file).WithField("keyring", sign.Keyring)
+	switch sign.backend() {
+	case common.SignBackendGpg:
+		return gpgSignFile(sign, file)
+	case common.SignBackendOpenpgp:
+		passphrase, err := common.NewPassphraseFunc(sign.Passphrase)
+		if err != nil {
+			return err
+		}
+		keyring, err := common.ReadKeyringFile(sign.Keyring)
+		if err != nil {
+			return err
+		}
+		signer, err := common.SigningKey(keyring, sign.KeyId, passphrase)
+		if err != nil {
+			return errs.WithEF(err, fields, "Cannot get signing key, keyring must contain a private key with backend openpgp")
+		}
+		logs.WithF(fields.WithField("key", common.KeyIdentity(signer))).Debug("Signing")
+		return common.SignFile(signer, file, file+suffixAsc)
+	}
+	return errs.WithF(fields.WithField("backend", sign.Backend), "Unknown sign backend")
+}
+
+// gpgSignFile gives the passphrase to gpg on stdin, unless the gpg-agent is used
+func gpgSignFile(sign *Sign, file string) error {
+	fields := data.WithField("file", file).WithField("keyring", sign.Keyring)
+	args := []string{"--yes", "--no-default-keyring", "--armor", "--keyring", sign.Keyring}
+	if sign.KeyId != "" {
+		args = append(args, "--local-user", sign.KeyId)
+	}
+	var input *bytes.Reader
+	if sign.Passphrase != "" && sign.Passphrase != common.PassphraseAgent {
+		passphrase, err := common.NewPassphraseFunc(sign.Passphrase)
+		if err != nil {
+			return err
+		}
+		pass, err := passphrase(nil)
+		if err != nil {
+			return errs.WithEF(err, fields, "Failed to get passphrase")
+		}
+		input = bytes.NewReader(pass)
+		args = append(args, "--batch", "--pinentry-mode", "loopback", "--passphrase-fd", "0")
+	}
+	args = append(args, "--output", file+suffixAsc, "--detach-sig", file)
+
+	var err error
+	if input != nil {
+		err = common.ExecCmdWithInput(input, "gpg", args...)
+	} else {
+		err = common.ExecCmd("gpg", args...)
+	}
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to sign with gpg")
+	}
+	return nil
+}
+
+// verifyFile checks the signature made by signFile, with the public keys of the signing keyring
+func verifyFile(sign *Sign, file string) error {
+	fields := data.WithField("file", file).WithField("keyring", sign.Keyring)
+	switch sign.backend() {
+	case common.SignBackendGpg:
+		if err := common.ExecCmd("gpg", "--no-default-keyring", "--keyring", sign.Keyring,
+			"--verify", file+suffixAsc, file); err != nil {
+			return errs.WithEF(err, fields, "Failed to verify with gpg")
+		}
+		return nil
+	case common.SignBackendOpenpgp:
+		keyring, err := common.ReadKeyringFile(sign.Keyring)
+		if err != nil {
+			return err
+		}
+		signer, err := common.VerifyFile(keyring, file, file+suffixAsc)
+		if err != nil {
+			return errs.WithEF(err, fields, "Signature does not match signing keyring")
+		}
+		if sign.KeyId != "" && !common.MatchKeyId(signer, sign.KeyId) {
+			return errs.WithF(fields.WithField("keyId", sign.KeyId).WithField("key", common.KeyIdentity(signer)),
+				"Signature is not made by the configured key")
+		}
+		logs.WithF(fields.WithField("key", common.KeyIdentity(signer))).Debug("Signature verified")
+		return nil
+	}
+	return errs.WithF(fields.WithField("backend", sign.Backend), "Unknown sign backend")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/appc/spec/schema"
+	"github.com/blablacar/dgr/dgr/common"
+	"github.com/blablacar/dgr/dgr/discovery"
+	"github.com/n0rad/go-erlog/data"
+	"github.com/n0rad/go-erlog/errs"
+	"github.com/n0rad/go-erlog/logs"
+	"golang.org/x/crypto/openpgp"
+)
+
+// verifyImage checks the signature of an aci or of a pod manifest pushed by dgr. Keys are the ones trusted
+// by rkt for its name, the ones of the keyring file, or the ones discovered for its name.
+func verifyImage(file string, keyringFile string, discover bool) error {
+	fields := data.WithField("file", file)
+	name, err := signedImageName(file)
+	if err != nil {
+		return errs.WithEF(err, fields, "Cannot read image name")
+	}
+	fields = fields.WithField("image", name)
+
+	var keyring openpgp.EntityList
+	switch {
+	case keyringFile != "":
+		keyring, err = common.ReadKeyringFile(keyringFile)
+	case discover:
+		keyring, err = discoverPublicKeys(name)
+	default:
+		systemConf, localConf := rktConfigDirs()
+		keyring, err = common.TrustedKeyring([]string{systemConf, localConf}, name.Name())
+	}
+	if err != nil {
+		return errs.WithEF(err, fields, "Failed to get keys")
+	}
+
+	signer, err := common.VerifyFile(keyring, file, file+suffixAsc)
+	if err != nil {
+		return errs.WithEF(err, fields, "Signature verification failed")
+	}
+	logs.WithF(fields.WithField("key", common.KeyIdentity(signer)).WithField("fingerprint", common.KeyFingerprint(signer))).
+		Info("Signature verified")
+	return nil
+}
+
+// signedImageName reads the name of an aci, or of a pod manifest pushed by dgr
+func signedImageName(file string) (*common.ACFullname, error) {
+	if im, err := common.ExtractManifestFromAci(file); err == nil {
+		return common.ExtractNameVersionFromManifest(im), nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errs.WithEF(err, data.WithField("file", file), "Failed to read file")
+	}
+	manifest := schema.BlankPodManifest()
+	if err := manifest.UnmarshalJSON(content); err != nil {
+		return nil, errs.WithEF(err, data.WithField("file", file), "File is neither an aci nor a pod manifest")
+	}
+	return common.PodArtifactName(manifest)
+}
+
+// discoverPublicKeys downloads the keys of ac-discovery-pubkeys. They are as trusted as the discovery is.
+func discoverPublicKeys(name *common.ACFullname) (openpgp.EntityList, error) {
+	fields := data.WithField("image", name)
+	insecure := Home.Config.Rkt.InsecureOptions.ToDiscoveryInsecureOption()
+	app, err := discovery.NewAppFromString(name.Name())
+	if err != nil {
+		return nil, errs.WithEF(err, fields, "Invalid image name")
+	}
+	endpoints, _, err := discoverEndpoints(*app, true)
+	if err != nil {
+		return nil, errs.WithEF(err, fields, "Failed to discover public keys")
+	}
+	if len(endpoints.Keys) == 0 {
+		return nil, errs.WithF(fields, "No public keys discovered")
+	}
+
+	keyring := openpgp.EntityList{}
+	for _, url := range endpoints.Keys {
+		content, err := httpGet(url, insecure)
+		if err != nil {
+			return nil, errs.WithEF(err, fields.WithField("url", url), "Failed to download public keys")
+		}
+		keys, err := common.ReadKeyring(content)
+		if err != nil {
+			return nil, errs.WithEF(err, fields.WithField("url", url), "Failed to read public keys")
+		}
+		for _, key := range keys {
+			logs.WithF(fields.WithField("url", url).WithField("fingerprint", common.KeyFingerprint(key))).Warn("Using discovered key")
+		}
+		keyring = append(keyring, keys...)
+	}
+	return keyring, nil
+}
@@ -0,0 +1,13 @@
+#!/dgr/bin/busybox sh
+set -e
+. /dgr/bin/functions.sh
+isLevelEnabled "debug" && set -x
+
+jar=$(ls ${ACI_HOME}/build/*.jar 2> /dev/null | head -1)
+if [ -z "${jar}" ]; then
+    echo_red "No jar found in ${ACI_HOME}/build, put the jar of the service there before building"
+    exit 1
+fi
+
+mkdir -p ${ROOTFS}/opt/app
+cp ${jar} ${ROOTFS}/opt/app/app.jar
@@ -0,0 +1,10 @@
+#!/dgr/bin/bats
+
+@test "Builder should install the jar" {
+  [ -f /opt/app/app.jar ]
+}
+
+@test "Prestart should template jvm options" {
+  result="$(cat /etc/app/jvm.options)"
+  [ "$result" == "-Xms64m -Xmx256m" ]
+}
@@ -0,0 +1,8 @@
+#!/dgr/bin/busybox sh
+set -e
+. /dgr/bin/functions.sh
+isLevelEnabled "debug" && set -x
+
+apt-get update
+apt-get install -y nodejs
+apt-get clean
@@ -0,0 +1,9 @@
+#!/dgr/bin/bats
+
+@test "Nodejs should be installed" {
+  [ -x /usr/bin/nodejs ]
+}
+
+@test "Prestart should template the configuration" {
+  grep -q '"port": 8080' /etc/app/config.json
+}
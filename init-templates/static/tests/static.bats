@@ -0,0 +1,10 @@
+#!/dgr/bin/bats
+
+@test "Files should be served from /var/www" {
+  [ -f /var/www/index.html ]
+}
+
+@test "Prestart should template httpd configuration" {
+  result="$(cat /etc/httpd.conf | head -1)"
+  [ "$result" == "A:*" ]
+}